@@ -429,7 +429,11 @@ class ServerManager {
     const wsUrl = `${protocol}://${server.url.replace(/^https?:\/\//, "")}`;
 
     // Create WebSocket connection directly for this server
-    const wsConnection = new WebSocket(`${wsUrl}/ws?token=${token}`);
+    // (token travels as a subprotocol so it stays out of URLs and proxy logs)
+    const wsConnection = new WebSocket(`${wsUrl}/ws`, [
+      "chowkidar",
+      `bearer.${token}`,
+    ]);
 
     const wsClient = {
       id,
@@ -71,10 +71,11 @@ class WebSocketStatsClient {
       }
       const parsedBase = new URL(baseUrl);
       const protocol = parsedBase.protocol === "https:" ? "wss" : "ws";
-      const wsUrl = `${protocol}://${parsedBase.host}/ws?token=${token}`;
+      const wsUrl = `${protocol}://${parsedBase.host}/ws`;
 
       console.log("🔌 Connecting to WebSocket...");
-      this.ws = new WebSocket(wsUrl);
+      // Token travels as a subprotocol so it stays out of URLs and proxy logs
+      this.ws = new WebSocket(wsUrl, ["chowkidar", `bearer.${token}`]);
 
       // Set a timeout for connection establishment
       const connectionTimeout = setTimeout(() => {
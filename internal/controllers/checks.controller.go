@@ -0,0 +1,44 @@
+package controllers
+
+import (
+	"chowkidar/internal/models"
+	"chowkidar/internal/services"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetChecks returns the latest result of every configured check
+// Query params: state=OK,WARNING,CRITICAL,UNKNOWN,PENDING (default: all)
+func GetChecks(c *gin.Context) {
+	states := map[string]bool{}
+	for _, state := range strings.Split(c.Query("state"), ",") {
+		if state = strings.ToUpper(strings.TrimSpace(state)); state != "" {
+			states[state] = true
+		}
+	}
+
+	checks := []models.CheckResult{}
+	for _, check := range services.GetChecks() {
+		if len(states) == 0 || states[check.State] {
+			checks = append(checks, check)
+		}
+	}
+	respond(c, http.StatusOK, gin.H{
+		"checks": checks,
+		"count":  len(checks),
+	})
+}
+
+// GetCheck returns one check's latest result
+func GetCheck(c *gin.Context) {
+	name := c.Param("name")
+	check, err := services.GetCheck(name)
+	if errors.Is(err, services.ErrCheckNotFound) {
+		respond(c, http.StatusNotFound, gin.H{"error": "check not found: " + name})
+		return
+	}
+	respond(c, http.StatusOK, check)
+}
@@ -0,0 +1,31 @@
+package controllers
+
+import (
+	"chowkidar/internal/services"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+)
+
+// respond writes obj as JSON, MessagePack or CBOR depending on the Accept header.
+// JSON stays the default when Accept is missing or does not name a binary format.
+func respond(c *gin.Context, code int, obj interface{}) {
+	c.Header("Vary", "Accept")
+
+	mime := c.NegotiateFormat(binding.MIMEJSON, services.MIMEMsgPack, services.MIMEMsgPackLegacy, services.MIMECBOR)
+	encoding := services.EncodingForMIME(mime)
+	if encoding == services.EncodingJSON {
+		c.JSON(code, obj)
+		return
+	}
+
+	data, err := services.Encode(encoding, obj)
+	if err != nil {
+		log.Printf("Failed to encode response as %s: %v", encoding, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to encode response"})
+		return
+	}
+	c.Data(code, mime, data)
+}
@@ -0,0 +1,85 @@
+package controllers
+
+import (
+	"chowkidar/internal/models"
+	"chowkidar/internal/services"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetEvents returns recent agent events from the event bus
+// Query params: since=RFC3339|duration (e.g. 15m), type=auth_failed,threshold_crossed, limit (default 100, max 1000)
+func GetEvents(c *gin.Context) {
+	filter := models.EventFilter{Limit: 100}
+
+	var err error
+	if filter.Since, err = parseTimeParam(c.Query("since")); err != nil {
+		respond(c, http.StatusBadRequest, gin.H{"error": "invalid since: " + err.Error()})
+		return
+	}
+
+	if types := c.Query("type"); types != "" {
+		for _, t := range strings.Split(types, ",") {
+			if trimmed := strings.TrimSpace(t); trimmed != "" {
+				filter.Types = append(filter.Types, trimmed)
+			}
+		}
+	}
+
+	if limitStr := c.Query("limit"); limitStr != "" {
+		limit, err := strconv.Atoi(limitStr)
+		if err != nil || limit < 1 {
+			respond(c, http.StatusBadRequest, gin.H{"error": "invalid limit"})
+			return
+		}
+		if limit > 1000 {
+			limit = 1000
+		}
+		filter.Limit = limit
+	}
+
+	events := services.RecentEvents(filter)
+	respond(c, http.StatusOK, gin.H{
+		"events": events,
+		"count":  len(events),
+	})
+}
+
+// GetKernelEvents returns recent kernel log events (OOM kills, segfaults, hung tasks, I/O errors, read-only remounts)
+// Query params: since=RFC3339|duration (e.g. 15m), type=oom_kill|segfault|hung_task|io_error|fs_readonly, limit (default 100, max 200)
+func GetKernelEvents(c *gin.Context) {
+	since, err := parseTimeParam(c.Query("since"))
+	if err != nil {
+		respond(c, http.StatusBadRequest, gin.H{"error": "invalid since: " + err.Error()})
+		return
+	}
+
+	eventType := c.Query("type")
+	switch eventType {
+	case "", models.EventOOMKill, models.EventSegfault, models.EventHungTask, models.EventIOError, models.EventFilesystemReadOnly:
+	default:
+		respond(c, http.StatusBadRequest, gin.H{"error": "type must be oom_kill, segfault, hung_task, io_error or fs_readonly"})
+		return
+	}
+
+	limit := 100
+	if limitStr := c.Query("limit"); limitStr != "" {
+		limit, err = strconv.Atoi(limitStr)
+		if err != nil || limit < 1 {
+			respond(c, http.StatusBadRequest, gin.H{"error": "invalid limit"})
+			return
+		}
+		if limit > 200 {
+			limit = 200
+		}
+	}
+
+	events := services.GetKernelEvents(since, eventType, limit)
+	respond(c, http.StatusOK, gin.H{
+		"events": events,
+		"count":  len(events),
+	})
+}
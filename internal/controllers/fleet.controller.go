@@ -0,0 +1,154 @@
+package controllers
+
+import (
+	"chowkidar/internal/middleware"
+	"chowkidar/internal/models"
+	"chowkidar/internal/services"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// addFleetServerRequest is the body of POST /fleet/servers
+type addFleetServerRequest struct {
+	Name  string `json:"name"`
+	URL   string `json:"url"`
+	Token string `json:"token"`
+}
+
+// GetFleetServers lists registered agents and their connection state
+func GetFleetServers(c *gin.Context) {
+	servers := services.GetFleet().Servers(false)
+	respond(c, http.StatusOK, gin.H{
+		"servers": servers,
+		"count":   len(servers),
+	})
+}
+
+// AddFleetServer registers an agent with the hub and starts streaming from it
+// Body: {"name":"web-1","url":"http://10.0.0.5:8080","token":"..."}
+func AddFleetServer(c *gin.Context) {
+	var req addFleetServerRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respond(c, http.StatusBadRequest, gin.H{"error": "invalid body: " + err.Error()})
+		return
+	}
+	if !middleware.NewInputValidator().ValidateServerName(req.Name) {
+		respond(c, http.StatusBadRequest, gin.H{"error": "invalid server name format"})
+		return
+	}
+
+	status, err := services.GetFleet().AddServer(models.FleetServer{
+		Name:  req.Name,
+		URL:   req.URL,
+		Token: req.Token,
+	})
+	if errors.Is(err, services.ErrFleetServerExists) {
+		respond(c, http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		respond(c, http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	respond(c, http.StatusCreated, status)
+}
+
+// DeleteFleetServer unregisters the agent named in the path
+func DeleteFleetServer(c *gin.Context) {
+	name := c.Param("name")
+	err := services.GetFleet().RemoveServer(name)
+	if errors.Is(err, services.ErrFleetServerNotFound) {
+		respond(c, http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		respond(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	respond(c, http.StatusOK, gin.H{"removed": name})
+}
+
+// GetFleetMetrics returns the latest stats received from every agent
+// Query params: server=name (optional, a single agent)
+func GetFleetMetrics(c *gin.Context) {
+	if name := c.Query("server"); name != "" {
+		status, ok := services.GetFleet().Server(name, true)
+		if !ok {
+			respond(c, http.StatusNotFound, gin.H{"error": "server not found"})
+			return
+		}
+		respond(c, http.StatusOK, status)
+		return
+	}
+
+	servers := services.GetFleet().Servers(true)
+	respond(c, http.StatusOK, gin.H{
+		"servers": servers,
+		"count":   len(servers),
+	})
+}
+
+// HandleFleetWebSocket streams every agent's stats, alerts and events over one
+// socket. Messages carry a "server" field; auth and subscriptions work as on /ws.
+func HandleFleetWebSocket(c *gin.Context) {
+	serveWebSocket(c, services.GetFleet().Hub())
+}
+
+// GetFleetServerAPI forwards a GET to an agent's REST API and returns its answer.
+// Push agents are reached through their outbound connection.
+// Example: /fleet/servers/web-1/api/metrics/cpu
+func GetFleetServerAPI(c *gin.Context) {
+	path := c.Param("path")
+	if c.Request.URL.RawQuery != "" {
+		path += "?" + c.Request.URL.RawQuery
+	}
+
+	resp, err := services.GetFleet().Request(c.Param("name"), path)
+	if errors.Is(err, services.ErrFleetServerNotFound) {
+		respond(c, http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if errors.Is(err, services.ErrInvalidAgentPath) {
+		respond(c, http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		respond(c, http.StatusBadGateway, gin.H{"error": err.Error()})
+		return
+	}
+	c.Data(resp.Status, resp.ContentType, []byte(resp.Body))
+}
+
+// HandleFleetPush accepts an outbound connection from a push-mode agent. The agent
+// authenticates with a hub token and is listed under the token's server name; an
+// X-Chowkidar-Server header, when sent, must match it.
+func HandleFleetPush(c *gin.Context) {
+	claims, _ := c.MustGet(middleware.ClaimsContextKey).(*services.CustomClaims)
+	if claims == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "authorization required"})
+		return
+	}
+	name := claims.ServerName
+	if !middleware.NewInputValidator().ValidateServerName(name) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "token has an invalid server name"})
+		return
+	}
+	if header := c.GetHeader("X-Chowkidar-Server"); header != "" && header != name {
+		c.JSON(http.StatusForbidden, gin.H{"error": "X-Chowkidar-Server does not match the token's server name " + name})
+		return
+	}
+	if status, exists := services.GetFleet().Server(name, false); exists && status.Mode != services.FleetModePush {
+		c.JSON(http.StatusConflict, gin.H{"error": services.ErrFleetServerExists.Error()})
+		return
+	}
+
+	ws, err := newUpgrader(services.GetFleet().Hub()).Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		log.Printf("[FLEET] Push upgrade error: %v", err)
+		return
+	}
+	go services.GetFleet().ServePush(name, c.ClientIP(), ws)
+}
@@ -17,17 +17,17 @@ func GetMetricHistory(c *gin.Context) {
 	// Parse duration
 	duration, err := time.ParseDuration(durationStr)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid duration format"})
+		respond(c, http.StatusBadRequest, gin.H{"error": "invalid duration format"})
 		return
 	}
 
 	data := services.GetHistoricalData(metric, duration)
 	if data == nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid metric"})
+		respond(c, http.StatusBadRequest, gin.H{"error": "invalid metric"})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{
+	respond(c, http.StatusOK, gin.H{
 		"metric":   metric,
 		"duration": durationStr,
 		"data":     data,
@@ -41,12 +41,12 @@ func GetAllHistory(c *gin.Context) {
 
 	duration, err := time.ParseDuration(durationStr)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid duration format"})
+		respond(c, http.StatusBadRequest, gin.H{"error": "invalid duration format"})
 		return
 	}
 
 	window := services.GetAllHistoricalData(duration)
-	c.JSON(http.StatusOK, gin.H{
+	respond(c, http.StatusOK, gin.H{
 		"duration": durationStr,
 		"data":     window,
 	})
@@ -127,5 +127,5 @@ func GetDashboard(c *gin.Context) {
 		"timestamp":       time.Now(),
 	}
 
-	c.JSON(http.StatusOK, dashboard)
+	respond(c, http.StatusOK, dashboard)
 }
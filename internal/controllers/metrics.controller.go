@@ -1,8 +1,13 @@
 package controllers
 
 import (
+	"chowkidar/internal/models"
 	"chowkidar/internal/services"
+	"errors"
+	"fmt"
 	"net/http"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
@@ -11,74 +16,89 @@ import (
 func GetAllMetrics(c *gin.Context) {
 	status, err := services.GetSystemStatus()
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		respond(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
-	c.JSON(http.StatusOK, status)
+	respond(c, http.StatusOK, status)
 }
 
 func GetCPU(c *gin.Context) {
+	if !requireCollector(c, "cpu") {
+		return
+	}
 	cpu, err := services.GetCachedCPU()
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		respond(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
-	c.JSON(http.StatusOK, cpu)
+	respond(c, http.StatusOK, cpu)
 }
 
 func GetCPUInfo(c *gin.Context) {
 	cpuInfo, err := services.GetCPUInfo()
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		respond(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
-	c.JSON(http.StatusOK, cpuInfo)
+	respond(c, http.StatusOK, cpuInfo)
 }
 
 func GetCPUCompatibility(c *gin.Context) {
 	cpuInfo, err := services.GetCPUInfo()
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		respond(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 	compatibility := services.GetSoftwareCompatibility(cpuInfo)
-	c.JSON(http.StatusOK, compatibility)
+	respond(c, http.StatusOK, compatibility)
 }
 
 func GetMemory(c *gin.Context) {
+	if !requireCollector(c, "memory") {
+		return
+	}
 	memory, err := services.GetCachedMemory()
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		respond(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
-	c.JSON(http.StatusOK, memory)
+	respond(c, http.StatusOK, memory)
 }
 
 func GetDisk(c *gin.Context) {
+	if !requireCollector(c, "disk") {
+		return
+	}
 	disk, err := services.GetCachedDisk()
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		respond(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
-	c.JSON(http.StatusOK, disk)
+	respond(c, http.StatusOK, disk)
 }
 
 func GetNetwork(c *gin.Context) {
+	if !requireCollector(c, "network") {
+		return
+	}
 	network, err := services.GetCachedNetwork()
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		respond(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
-	c.JSON(http.StatusOK, network)
+	respond(c, http.StatusOK, network)
 }
 
 func GetAggregatedNetwork(c *gin.Context) {
+	if !requireCollector(c, "network") {
+		return
+	}
 	network, err := services.GetAggregatedNetwork()
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		respond(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
-	c.JSON(http.StatusOK, network)
+	respond(c, http.StatusOK, network)
 }
 
 // GetStatus returns a consolidated summary of all 4 system metrics
@@ -94,5 +114,140 @@ func GetStatus(c *gin.Context) {
 		"disk":    diskSimple["disk_percent"],
 		"network": networkSimple,
 	}
-	c.JSON(http.StatusOK, response)
+	respond(c, http.StatusOK, response)
+}
+
+// GetQueues returns depth and drop counters for the outbound queues (push, exporters)
+func GetQueues(c *gin.Context) {
+	queues := services.OutboundQueues()
+	respond(c, http.StatusOK, gin.H{
+		"queues": queues,
+		"count":  len(queues),
+	})
+}
+
+// Custom metric ingestion limits
+const (
+	maxCustomBatch     = 1000
+	maxCustomBodyBytes = 1 << 20
+)
+
+// customMetricsRequest is the body of POST /metrics/custom
+type customMetricsRequest struct {
+	Metrics []customMetricInput `json:"metrics"`
+}
+
+// customMetricInput is one posted value
+type customMetricInput struct {
+	Name      string            `json:"name"`
+	Type      string            `json:"type"` // gauge (default) or counter
+	Value     *float64          `json:"value"`
+	Labels    map[string]string `json:"labels"`
+	Timestamp *time.Time        `json:"timestamp"` // RFC 3339, default now
+}
+
+// GetCustomMetrics returns the latest value of every application metric series
+// (StatsD and POST /metrics/custom) and the StatsD listener counters
+// Query params: prefix=checkout. (only series whose name starts with it)
+func GetCustomMetrics(c *gin.Context) {
+	prefix := c.Query("prefix")
+	metrics := []models.CustomMetric{}
+	for _, metric := range services.GetCustomMetrics() {
+		if strings.HasPrefix(metric.Name, prefix) {
+			metrics = append(metrics, metric)
+		}
+	}
+
+	response := gin.H{
+		"metrics": metrics,
+		"count":   len(metrics),
+	}
+	if stats := services.GetStatsDStats(); stats != nil {
+		response["statsd"] = stats
+	}
+	respond(c, http.StatusOK, response)
+}
+
+// PostCustomMetrics stores a batch of application metrics, e.g. from cron jobs
+// Body: {"metrics":[{"name":"backup.size_bytes","value":1.2e9,"labels":{"db":"main"}},
+// {"name":"jobs.failed","type":"counter","value":1}]}
+func PostCustomMetrics(c *gin.Context) {
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxCustomBodyBytes)
+
+	var req customMetricsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respond(c, http.StatusBadRequest, gin.H{"error": "invalid body: " + err.Error()})
+		return
+	}
+	if len(req.Metrics) == 0 || len(req.Metrics) > maxCustomBatch {
+		respond(c, http.StatusBadRequest, gin.H{"error": fmt.Sprintf("metrics must hold 1-%d values", maxCustomBatch)})
+		return
+	}
+
+	metrics := make([]models.CustomMetric, len(req.Metrics))
+	for i, input := range req.Metrics {
+		if input.Value == nil {
+			respond(c, http.StatusBadRequest, gin.H{"error": fmt.Sprintf("metrics[%d]: value is required", i)})
+			return
+		}
+		metrics[i] = models.CustomMetric{Name: input.Name, Type: input.Type, Tags: input.Labels, Value: *input.Value}
+		if input.Timestamp != nil {
+			metrics[i].Timestamp = *input.Timestamp
+		}
+	}
+
+	accepted, err := services.IngestCustomMetrics(metrics)
+	if errors.Is(err, services.ErrInvalidCustomMetric) {
+		respond(c, http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		respond(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	respond(c, http.StatusOK, gin.H{
+		"accepted": accepted,
+		"dropped":  len(metrics) - accepted, // New series beyond CHOWKIDAR_CUSTOM_MAX_SERIES
+	})
+}
+
+// GetCollectors lists registered collectors, whether they are enabled and their last run
+func GetCollectors(c *gin.Context) {
+	collectors := services.CollectorStatuses()
+	respond(c, http.StatusOK, gin.H{
+		"collectors": collectors,
+		"count":      len(collectors),
+	})
+}
+
+// GetCollectorSamples returns the latest samples of the collector named in the path
+func GetCollectorSamples(c *gin.Context) {
+	name := c.Param("name")
+	samples, collectedAt, err := services.CollectorSamples(name)
+	if errors.Is(err, services.ErrCollectorNotFound) || errors.Is(err, services.ErrCollectorDisabled) {
+		respond(c, http.StatusNotFound, gin.H{"error": fmt.Sprintf("%s: %s", err.Error(), name)})
+		return
+	}
+	if err != nil {
+		respond(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if samples == nil {
+		samples = []models.Sample{}
+	}
+	respond(c, http.StatusOK, gin.H{
+		"collector": name,
+		"timestamp": collectedAt,
+		"samples":   samples,
+	})
+}
+
+// requireCollector answers 404 and returns false when the collector behind an endpoint
+// is disabled (CHOWKIDAR_COLLECTORS / CHOWKIDAR_DISABLE_COLLECTORS)
+func requireCollector(c *gin.Context, name string) bool {
+	if services.CollectorEnabled(name) {
+		return true
+	}
+	respond(c, http.StatusNotFound, gin.H{"error": "collector " + name + " is disabled"})
+	return false
 }
@@ -1,16 +1,21 @@
 package controllers
 
 import (
+	"chowkidar/internal/models"
 	"chowkidar/internal/services"
 	"net/http"
+	"strconv"
 
 	"github.com/gin-gonic/gin"
 )
 
 // GetTopProcesses returns the top 20 processes by CPU + memory usage with totals
 func GetTopProcesses(c *gin.Context) {
+	if !requireCollector(c, "processes") {
+		return
+	}
 	processes, totalCPU, totalMem, lastUpdated := services.GetCachedProcesses()
-	c.JSON(http.StatusOK, gin.H{
+	respond(c, http.StatusOK, gin.H{
 		"processes":         processes,
 		"total_cpu_percent": totalCPU,
 		"total_mem_percent": totalMem,
@@ -20,6 +25,43 @@ func GetTopProcesses(c *gin.Context) {
 
 // GetProcessStatus returns a simple process status summary (total count)
 func GetProcessStatus(c *gin.Context) {
+	if !requireCollector(c, "processes") {
+		return
+	}
 	status := services.GetProcessCountSimple()
-	c.JSON(http.StatusOK, status)
+	respond(c, http.StatusOK, status)
+}
+
+// GetProcessEvents returns recent process start/exit events
+// Query params: since=RFC3339|duration (e.g. 15m), type=process_started|process_exited, limit (default 100, max 500)
+func GetProcessEvents(c *gin.Context) {
+	since, err := parseTimeParam(c.Query("since"))
+	if err != nil {
+		respond(c, http.StatusBadRequest, gin.H{"error": "invalid since: " + err.Error()})
+		return
+	}
+
+	eventType := c.Query("type")
+	if eventType != "" && eventType != models.EventProcessStarted && eventType != models.EventProcessExited {
+		respond(c, http.StatusBadRequest, gin.H{"error": "type must be process_started or process_exited"})
+		return
+	}
+
+	limit := 100
+	if limitStr := c.Query("limit"); limitStr != "" {
+		limit, err = strconv.Atoi(limitStr)
+		if err != nil || limit < 1 {
+			respond(c, http.StatusBadRequest, gin.H{"error": "invalid limit"})
+			return
+		}
+		if limit > 500 {
+			limit = 500
+		}
+	}
+
+	events := services.GetProcessEvents(since, eventType, limit)
+	respond(c, http.StatusOK, gin.H{
+		"events": events,
+		"count":  len(events),
+	})
 }
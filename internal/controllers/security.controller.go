@@ -0,0 +1,97 @@
+package controllers
+
+import (
+	"chowkidar/internal/models"
+	"chowkidar/internal/services"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetBans returns all active IP bans issued by the lockout service
+func GetBans(c *gin.Context) {
+	bans := services.ListBans()
+	respond(c, http.StatusOK, gin.H{
+		"bans":  bans,
+		"count": len(bans),
+	})
+}
+
+// DeleteBan lifts the ban for the IP in the path and resets its strikes
+func DeleteBan(c *gin.Context) {
+	ip := c.Param("ip")
+	removed, err := services.Unban(ip)
+	if err != nil {
+		respond(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if !removed {
+		respond(c, http.StatusNotFound, gin.H{"error": "no ban for ip"})
+		return
+	}
+	respond(c, http.StatusOK, gin.H{"unbanned": ip})
+}
+
+// GetAuditEvents queries the security audit log
+// Query params: since=RFC3339|duration (e.g. 1h), until=RFC3339|duration, type=a,b, ip=addr, limit=100 (max 1000)
+func GetAuditEvents(c *gin.Context) {
+	filter := models.AuditFilter{
+		IP:    c.Query("ip"),
+		Limit: 100,
+	}
+
+	var err error
+	if filter.Since, err = parseTimeParam(c.Query("since")); err != nil {
+		respond(c, http.StatusBadRequest, gin.H{"error": "invalid since: " + err.Error()})
+		return
+	}
+	if filter.Until, err = parseTimeParam(c.Query("until")); err != nil {
+		respond(c, http.StatusBadRequest, gin.H{"error": "invalid until: " + err.Error()})
+		return
+	}
+
+	if types := c.Query("type"); types != "" {
+		for _, t := range strings.Split(types, ",") {
+			if trimmed := strings.TrimSpace(t); trimmed != "" {
+				filter.Types = append(filter.Types, trimmed)
+			}
+		}
+	}
+
+	if limitStr := c.Query("limit"); limitStr != "" {
+		limit, err := strconv.Atoi(limitStr)
+		if err != nil || limit < 1 {
+			respond(c, http.StatusBadRequest, gin.H{"error": "invalid limit"})
+			return
+		}
+		if limit > 1000 {
+			limit = 1000
+		}
+		filter.Limit = limit
+	}
+
+	events, err := services.QueryAudit(filter)
+	if err != nil {
+		respond(c, http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+		return
+	}
+
+	respond(c, http.StatusOK, gin.H{
+		"events": events,
+		"count":  len(events),
+	})
+}
+
+// parseTimeParam accepts an RFC3339 timestamp or a duration relative to now ("15m" means 15 minutes ago)
+func parseTimeParam(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if d, err := time.ParseDuration(value); err == nil {
+		return time.Now().Add(-d), nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
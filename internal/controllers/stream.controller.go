@@ -0,0 +1,214 @@
+package controllers
+
+import (
+	"chowkidar/internal/middleware"
+	"chowkidar/internal/models"
+	"chowkidar/internal/services"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// sseKeepAlive is how often a comment line is sent so proxies keep idle streams open
+const sseKeepAlive = 15 * time.Second
+
+// HandleStream serves the hub's messages as Server-Sent Events.
+// Query params: topics=cpu,memory (default: all), interval=5s (default: 1s).
+// Each SSE id is a cursor (see streamCursor). Reconnecting with Last-Event-ID
+// replays the buffered events and alerts published after it, then stored history
+// since its last stats message, before live messages resume.
+func HandleStream(c *gin.Context) {
+	hub := services.GetWebSocketHub()
+
+	var topics []string
+	if raw := c.Query("topics"); raw != "" {
+		topics = strings.Split(raw, ",")
+	}
+	var interval time.Duration
+	if raw := c.Query("interval"); raw != "" {
+		var err error
+		if interval, err = time.ParseDuration(raw); err != nil {
+			respond(c, http.StatusBadRequest, gin.H{"error": "invalid interval format"})
+			return
+		}
+	}
+
+	client := &services.ClientConnection{
+		ID:       fmt.Sprintf("%s-%d-sse", c.ClientIP(), atomic.AddUint64(&clientSeq, 1)),
+		IP:       c.ClientIP(),
+		Encoding: services.EncodingJSON,
+		Send:     make(chan services.WebSocketMessage, 256),
+		Close:    make(chan bool),
+	}
+	if err := client.Subscribe(topics, interval); err != nil {
+		respond(c, http.StatusBadRequest, gin.H{"error": err.Error(), "valid_topics": services.ValidTopics()})
+		return
+	}
+	if value, exists := c.Get(middleware.ClaimsContextKey); exists {
+		if claims, ok := value.(*services.CustomClaims); ok {
+			client.ServerName = claims.ServerName
+			client.TokenID = claims.ID
+			client.ID = client.ID + "-" + claims.ServerName
+		}
+	}
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no") // Disable nginx response buffering
+	c.Status(http.StatusOK)
+	fmt.Fprint(c.Writer, "retry: 3000\n\n")
+	c.Writer.Flush()
+
+	log.Printf("[SSE] New stream from %s for server: %s", client.IP, client.ServerName)
+	services.PublishEvent(models.Event{
+		Type:    models.EventClientConnected,
+		Source:  "stream",
+		Message: "client connected for server " + client.ServerName,
+		Attributes: map[string]interface{}{
+			"ip":          client.IP,
+			"server_name": client.ServerName,
+			"token_jti":   client.TokenID,
+			"transport":   "sse",
+		},
+	})
+	hub.Register(client)
+	defer func() {
+		hub.Unregister(client.ID)
+		services.PublishEvent(models.Event{
+			Type:    models.EventClientDisconnected,
+			Source:  "stream",
+			Message: "client disconnected: " + client.ID,
+			Attributes: map[string]interface{}{
+				"ip":        client.IP,
+				"client_id": client.ID,
+				"transport": "sse",
+			},
+		})
+	}()
+
+	// Live events already queue on client.Send; those up to cursor.event are covered
+	// by the replay, or predate the stream
+	cursor := streamCursor{event: services.LatestEventID()}
+	if resume, ok := parseStreamCursor(c.GetHeader("Last-Event-ID")); ok {
+		messages, since, newest := services.EventReplay(client, resume.event)
+		cursor.stats = resume.stats
+		for _, msg := range messages {
+			cursor.event = msg.Data.(models.Event).ID
+			if err := writeEvent(c, msg, cursor); err != nil {
+				return
+			}
+		}
+		cursor.event = newest
+		if !resume.stats.IsZero() {
+			since = resume.stats
+		}
+		if !since.IsZero() {
+			hub.ReplaySince(client, since)
+		}
+	}
+
+	keepAlive := time.NewTicker(sseKeepAlive)
+	defer keepAlive.Stop()
+	evicted := client.Evicted()
+	ctx := c.Request.Context()
+
+	for {
+		select {
+		case msg, ok := <-client.Send:
+			if !ok {
+				return
+			}
+			if event, isEvent := msg.Data.(models.Event); isEvent {
+				if event.ID <= cursor.event {
+					continue
+				}
+				cursor.event = event.ID
+			}
+			switch msg.Type {
+			case "stats", "stats_delta", "history":
+				cursor.stats = msg.Timestamp
+			}
+			if err := writeEvent(c, msg, cursor); err != nil {
+				return
+			}
+
+		case <-keepAlive.C:
+			if _, err := fmt.Fprint(c.Writer, ": keep-alive\n\n"); err != nil {
+				return
+			}
+			c.Writer.Flush()
+
+		case <-evicted:
+			_, reason := client.CloseReason()
+			writeEvent(c, services.WebSocketMessage{Type: "error", Timestamp: time.Now(), Error: reason}, cursor)
+			return
+
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// streamCursor is where a stream is up to, sent as the SSE id "<event>-<stats>":
+// the newest event bus id it has covered and the time, in Unix milliseconds, of
+// its newest stats or history message (0 before the first)
+type streamCursor struct {
+	event uint64
+	stats time.Time
+}
+
+func (s streamCursor) String() string {
+	stats := int64(0)
+	if !s.stats.IsZero() {
+		stats = s.stats.UnixMilli()
+	}
+	return strconv.FormatUint(s.event, 10) + "-" + strconv.FormatInt(stats, 10)
+}
+
+// parseStreamCursor parses a Last-Event-ID; a plain number is an event id
+func parseStreamCursor(id string) (streamCursor, bool) {
+	if id == "" {
+		return streamCursor{}, false
+	}
+	eventPart, statsPart, hasStats := strings.Cut(id, "-")
+	event, err := strconv.ParseUint(eventPart, 10, 64)
+	if err != nil {
+		return streamCursor{}, false
+	}
+	cursor := streamCursor{event: event}
+	if hasStats {
+		ms, err := strconv.ParseInt(statsPart, 10, 64)
+		if err != nil || ms < 0 {
+			return streamCursor{}, false
+		}
+		if ms > 0 {
+			cursor.stats = time.UnixMilli(ms)
+		}
+	}
+	return cursor, true
+}
+
+// writeEvent writes one message as an SSE event named after its type, with the
+// stream's cursor as its id
+func writeEvent(c *gin.Context, msg services.WebSocketMessage, cursor streamCursor) error {
+	if msg.Timestamp.IsZero() {
+		msg.Timestamp = time.Now()
+	}
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintf(c.Writer, "id: %s\nevent: %s\ndata: %s\n\n", cursor, msg.Type, data); err != nil {
+		return err
+	}
+	c.Writer.Flush()
+	return nil
+}
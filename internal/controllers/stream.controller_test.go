@@ -0,0 +1,36 @@
+package controllers
+
+import (
+	"testing"
+	"time"
+)
+
+func TestStreamCursor(t *testing.T) {
+	stats := time.UnixMilli(1767225600123)
+	tests := []struct {
+		id   string
+		want streamCursor
+		ok   bool
+	}{
+		{id: "42-1767225600123", want: streamCursor{event: 42, stats: stats}, ok: true},
+		{id: "0-1767225600123", want: streamCursor{stats: stats}, ok: true}, // Stats-only stream
+		{id: "42-0", want: streamCursor{event: 42}, ok: true},
+		{id: "42", want: streamCursor{event: 42}, ok: true}, // Plain event id
+		{id: ""},
+		{id: "abc"},
+		{id: "42-abc"},
+		{id: "-1767225600123"},
+		{id: "42--5"},
+	}
+	for _, tt := range tests {
+		got, ok := parseStreamCursor(tt.id)
+		if ok != tt.ok || got.event != tt.want.event || !got.stats.Equal(tt.want.stats) {
+			t.Errorf("parseStreamCursor(%q) = %+v, %v, want %+v, %v", tt.id, got, ok, tt.want, tt.ok)
+		}
+		if tt.ok && tt.id != "42" {
+			if id := got.String(); id != tt.id {
+				t.Errorf("cursor %q round-trips as %q", tt.id, id)
+			}
+		}
+	}
+}
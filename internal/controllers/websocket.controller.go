@@ -3,130 +3,248 @@ package controllers
 import (
 	"chowkidar/internal/middleware"
 	"chowkidar/internal/services"
+	"fmt"
 	"log"
+	"net"
 	"net/http"
 	"strings"
+	"sync/atomic"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/gorilla/websocket"
 )
 
-var upgrader = websocket.Upgrader{
-	ReadBufferSize:  1024,
-	WriteBufferSize: 1024,
-	CheckOrigin: func(r *http.Request) bool {
-		// Allow all origins for now (can be restricted based on config)
-		return true
-	},
+// newUpgrader builds the upgrader for the hub's settings
+func newUpgrader(hub *services.WebSocketHub) *websocket.Upgrader {
+	return &websocket.Upgrader{
+		ReadBufferSize:  1024,
+		WriteBufferSize: 1024,
+		// Selected when offered; clients passing "bearer.<token>" must also offer one.
+		// "chowkidar.msgpack" and "chowkidar.cbor" switch the socket to binary frames.
+		Subprotocols: services.WebSocketSubprotocols(),
+		// permessage-deflate is only used when the client offers it too
+		EnableCompression: hub.Compression,
+		CheckOrigin: func(r *http.Request) bool {
+			// Allow all origins for now (can be restricted based on config)
+			return true
+		},
+	}
 }
 
-// HandleWebSocket handles incoming WebSocket connections
+// clientSeq makes client IDs unique when one IP opens several sockets
+var clientSeq uint64
+
+// HandleWebSocket handles incoming WebSocket connections.
+// The token may come from the Authorization header, a "bearer.<token>" subprotocol
+// or ?token= (legacy). Without one, the socket is upgraded unauthenticated and must
+// send {"type":"auth","token":"..."} within the hub's AuthTimeout before any stats flow.
 func HandleWebSocket(c *gin.Context) {
-	// Extract and validate token from query parameter
-	token := c.Query("token")
-	if token == "" {
-		if middleware.GlobalSecurityLogger != nil {
-			middleware.GlobalSecurityLogger.LogFailedAuth(c.ClientIP(), "missing token")
-		}
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "missing token"})
-		return
+	serveWebSocket(c, services.GetWebSocketHub())
+}
+
+// serveWebSocket authenticates and upgrades a connection, then attaches it to a hub
+func serveWebSocket(c *gin.Context, hub *services.WebSocketHub) {
+	token, source := middleware.RequestToken(c)
+	if source == middleware.TokenSourceQuery && !hub.AllowQueryToken {
+		token, source = "", ""
 	}
 
-	// Validate the token
-	claims, err := services.ValidateToken(token)
-	if err != nil {
+	var claims *services.CustomClaims
+	if token != "" {
+		var err error
+		claims, err = services.ValidateToken(token)
+		if err != nil {
+			if middleware.GlobalSecurityLogger != nil {
+				middleware.GlobalSecurityLogger.LogFailedAuth(c.ClientIP(), "invalid token: "+err.Error())
+			}
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid token: " + err.Error()})
+			return
+		}
+		if source == middleware.TokenSourceQuery {
+			log.Printf("[WS] ⚠️  Token passed in URL by %s; prefer the Authorization header or subprotocol", c.ClientIP())
+		}
+	} else if hub.AuthTimeout <= 0 {
 		if middleware.GlobalSecurityLogger != nil {
-			middleware.GlobalSecurityLogger.LogFailedAuth(c.ClientIP(), "invalid token: "+err.Error())
+			middleware.GlobalSecurityLogger.LogMissingAuth(c.ClientIP(), "missing token")
 		}
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid token: " + err.Error()})
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "missing token"})
 		return
 	}
 
-	if middleware.GlobalSecurityLogger != nil {
-		middleware.GlobalSecurityLogger.LogWebSocketConnected(c.ClientIP(), claims.ServerName)
-	}
-	log.Printf("[WS] New connection from %s with token for server: %s", c.ClientIP(), claims.ServerName)
-
 	// Upgrade connection to WebSocket
-	ws, err := upgrader.Upgrade(c.Writer, c.Request, nil)
+	ws, err := newUpgrader(hub).Upgrade(c.Writer, c.Request, nil)
 	if err != nil {
 		log.Printf("[WS] Upgrade error: %v", err)
 		return
 	}
+	if hub.Compression {
+		if err := ws.SetCompressionLevel(hub.CompressionLevel); err != nil {
+			log.Printf("[WS] Invalid compression level %d: %v", hub.CompressionLevel, err)
+		}
+	}
 
 	// Create client connection
-	clientID := c.ClientIP() + "-" + claims.ServerName
 	client := &services.ClientConnection{
-		ID:    clientID,
-		Conn:  ws,
-		Send:  make(chan services.WebSocketMessage, 256),
-		Close: make(chan bool),
+		ID:       fmt.Sprintf("%s-%d", c.ClientIP(), atomic.AddUint64(&clientSeq, 1)),
+		IP:       c.ClientIP(),
+		Encoding: services.EncodingForSubprotocol(ws.Subprotocol()),
+		Conn:     ws,
+		Send:     make(chan services.WebSocketMessage, 256),
+		Close:    make(chan bool),
 	}
 
-	// Register with hub
-	hub := services.GetWebSocketHub()
-	hub.Register(client)
+	if claims != nil {
+		authenticateClient(client, hub, claims, source)
+	} else {
+		// Auth-first: nothing is sent until a valid auth message arrives
+		log.Printf("[WS] Unauthenticated connection from %s, waiting %s for auth message", client.IP, hub.AuthTimeout)
+		ws.SetReadDeadline(time.Now().Add(hub.AuthTimeout))
+	}
 
-	// Start read and write goroutines
+	// writePump starts once the client is authenticated (see authenticateClient)
 	go readPump(client, hub)
+}
+
+// authenticateClient attaches token details to the client, then starts its
+// writePump and registers it with the hub. The fields are set before either
+// goroutine can read them.
+func authenticateClient(client *services.ClientConnection, hub *services.WebSocketHub, claims *services.CustomClaims, source string) {
+	client.ServerName = claims.ServerName
+	client.TokenID = claims.ID
+	client.ID = client.ID + "-" + claims.ServerName
+
+	if middleware.GlobalSecurityLogger != nil {
+		middleware.GlobalSecurityLogger.LogWebSocketConnected(client.IP, claims.ServerName, claims.ID)
+	}
+	log.Printf("[WS] New connection from %s with token for server: %s (via %s)", client.IP, claims.ServerName, source)
+
 	go writePump(client, hub)
+	hub.Register(client)
 }
 
 // readPump reads messages from the WebSocket client
 func readPump(client *services.ClientConnection, hub *services.WebSocketHub) {
+	authenticated := client.TokenID != ""
+
 	defer func() {
-		hub.Unregister(client.ID)
+		if authenticated {
+			hub.Unregister(client.ID)
+		}
+		close(client.Close)
 		client.Conn.Close()
+		if middleware.GlobalSecurityLogger != nil {
+			middleware.GlobalSecurityLogger.LogWebSocketDisconnected(client.IP, client.ID)
+		}
 	}()
 
+	// Once authenticated, any pong or message keeps the socket alive for another PongWait.
+	// Before that, the auth deadline set on upgrade applies.
+	keepAlive := func() {
+		if authenticated {
+			client.Conn.SetReadDeadline(time.Now().Add(hub.PongWait))
+		}
+	}
+	keepAlive()
 	client.Conn.SetPongHandler(func(string) error {
+		keepAlive()
 		return nil
 	})
 
+	// Until authenticated no writePump runs, so replies are written from here
+	reply := func(msg services.WebSocketMessage) {
+		if authenticated {
+			select {
+			case client.Send <- msg:
+			default:
+			}
+			return
+		}
+		client.Conn.SetWriteDeadline(time.Now().Add(hub.WriteTimeout))
+		writeMessage(client, msg)
+	}
+
 	for {
-		var msg services.WebSocketMessage
-		err := client.Conn.ReadJSON(&msg)
+		messageType, data, err := client.Conn.ReadMessage()
 		if err != nil {
-			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
+			if netErr, ok := err.(net.Error); ok && netErr.Timeout() && !authenticated {
+				log.Printf("[WS-AUTH] Client %s did not authenticate in time", client.ID)
+				if middleware.GlobalSecurityLogger != nil {
+					middleware.GlobalSecurityLogger.LogMissingAuth(client.IP, "websocket auth timeout")
+				}
+				closeWithReason(client, websocket.ClosePolicyViolation, "authentication timeout")
+			} else if ok && netErr.Timeout() {
+				log.Printf("[WS] Client %s missed heartbeats for %s, disconnecting", client.ID, hub.PongWait)
+			} else if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
 				log.Printf("[WS] WebSocket error: %v", err)
 			}
 			return
 		}
+		keepAlive()
+
+		// Text frames are always JSON; binary frames use the negotiated encoding
+		var msg services.WebSocketMessage
+		encoding := services.EncodingJSON
+		if messageType == websocket.BinaryMessage {
+			encoding = client.Encoding
+		}
+		if err := services.Decode(encoding, data, &msg); err != nil {
+			reply(services.WebSocketMessage{Type: "error", Timestamp: time.Now(), Error: "malformed message: " + err.Error()})
+			continue
+		}
+
+		// Until authenticated, only auth messages are accepted
+		if !authenticated && msg.Type != "auth" {
+			reply(services.WebSocketMessage{Type: "auth_error", Error: "authentication required"})
+			continue
+		}
 
 		// Handle different message types
 		switch msg.Type {
 		case "auth":
 			// Client sending authentication token
-			if msg.Token != "" {
-				claims, err := services.ValidateToken(msg.Token)
-				if err != nil {
-					log.Printf("[WS-AUTH] ❌ Invalid token from client %s: %v", client.ID, err)
-					if middleware.GlobalSecurityLogger != nil {
-						middleware.GlobalSecurityLogger.LogFailedAuth(client.ID, "websocket auth message: "+err.Error())
-					}
-					// Send auth error response
-					select {
-					case client.Send <- services.WebSocketMessage{
-						Type: "auth_error",
-						Data: map[string]interface{}{"error": "invalid token"},
-					}:
-					case <-client.Close:
-						return
-					}
-				} else {
-					log.Printf("[WS-AUTH] ✓ Client %s authenticated via WebSocket message, server: %s", client.ID, claims.ServerName)
-					if middleware.GlobalSecurityLogger != nil {
-						middleware.GlobalSecurityLogger.LogTokenGenerated(client.ID, "websocket-auth-message")
-					}
-					// Send auth success response
-					select {
-					case client.Send <- services.WebSocketMessage{
-						Type: "auth_success",
-						Data: map[string]interface{}{"server": claims.ServerName},
-					}:
-					case <-client.Close:
-						return
-					}
+			if msg.Token == "" && authenticated {
+				continue
+			}
+			claims, err := services.ValidateToken(msg.Token)
+			if err != nil {
+				log.Printf("[WS-AUTH] ❌ Invalid token from client %s: %v", client.ID, err)
+				if middleware.GlobalSecurityLogger != nil {
+					middleware.GlobalSecurityLogger.LogFailedAuth(client.IP, "websocket auth message: "+err.Error())
+				}
+				if !authenticated {
+					// One attempt per auth-first socket; retrying means reconnecting
+					closeWithReason(client, websocket.ClosePolicyViolation, "invalid token")
+					return
+				}
+				// Send auth error response
+				select {
+				case client.Send <- services.WebSocketMessage{
+					Type: "auth_error",
+					Data: map[string]interface{}{"error": "invalid token"},
+				}:
+				default:
+				}
+				continue
+			}
+
+			// Send auth success response (queued before registering so it precedes any stats)
+			select {
+			case client.Send <- services.WebSocketMessage{
+				Type: "auth_success",
+				Data: map[string]interface{}{"server": claims.ServerName},
+			}:
+			default:
+			}
+
+			if !authenticated {
+				authenticated = true
+				keepAlive()
+				authenticateClient(client, hub, claims, "auth message")
+			} else {
+				log.Printf("[WS-AUTH] ✓ Client %s authenticated via WebSocket message, server: %s", client.ID, claims.ServerName)
+				if middleware.GlobalSecurityLogger != nil {
+					middleware.GlobalSecurityLogger.LogTokenGenerated(client.IP, "websocket-auth-message")
 				}
 			}
 
@@ -134,6 +252,7 @@ func readPump(client *services.ClientConnection, hub *services.WebSocketHub) {
 			// Respond with pong
 			pong := services.WebSocketMessage{
 				Type: "pong",
+				Data: map[string]interface{}{"dropped": client.Dropped()},
 			}
 			select {
 			case client.Send <- pong:
@@ -144,12 +263,50 @@ func readPump(client *services.ClientConnection, hub *services.WebSocketHub) {
 			}
 
 		case "subscribe":
-			// Client is subscribing to updates (no-op, already subscribed)
-			log.Printf("[WS] Client %s subscribed to updates", client.ID)
+			// {"type":"subscribe","topics":["cpu","memory"],"interval_ms":5000,"mode":"delta"}
+			interval := time.Duration(msg.IntervalMs) * time.Millisecond
+			if err := client.Subscribe(msg.Topics, interval); err != nil {
+				sendSubscriptionError(client, err)
+				continue
+			}
+			if msg.Mode != "" {
+				if err := client.SetStreamMode(msg.Mode); err != nil {
+					sendSubscriptionError(client, err)
+					continue
+				}
+			}
+			sendSubscription(client)
+			log.Printf("[WS] Client %s subscribed to %v", client.ID, msg.Topics)
+
+		case "replay":
+			// {"type":"replay","duration":"15m"} backfills history, then live stats continue
+			durationStr := msg.Duration
+			if durationStr == "" {
+				durationStr = "10m"
+			}
+			duration, err := time.ParseDuration(durationStr)
+			if err != nil {
+				sendError(client, "invalid duration format")
+				continue
+			}
+			if err := hub.Replay(client, duration); err != nil {
+				sendError(client, err.Error())
+			}
+
+		case "resync":
+			// Delta clients that lost track of the state ask for a fresh snapshot
+			client.RequestResync()
 
 		case "unsubscribe":
-			// Client unsubscribing (will close connection)
-			return
+			// Without topics, unsubscribing closes the connection (legacy behaviour)
+			if len(msg.Topics) == 0 {
+				return
+			}
+			if err := client.Unsubscribe(msg.Topics); err != nil {
+				sendSubscriptionError(client, err)
+				continue
+			}
+			sendSubscription(client)
 
 		default:
 			log.Printf("[WS] Unknown message type: %s", msg.Type)
@@ -157,9 +314,58 @@ func readPump(client *services.ClientConnection, hub *services.WebSocketHub) {
 	}
 }
 
-// writePump writes messages to the WebSocket client
+// sendSubscription confirms the client's current topics and interval
+func sendSubscription(client *services.ClientConnection) {
+	topics, interval := client.Subscription()
+	select {
+	case client.Send <- services.WebSocketMessage{
+		Type:       "subscribed",
+		Timestamp:  time.Now(),
+		Topics:     topics,
+		IntervalMs: interval.Milliseconds(),
+		Mode:       client.StreamMode(),
+	}:
+	default:
+	}
+}
+
+// sendSubscriptionError reports an invalid subscribe/unsubscribe request
+func sendSubscriptionError(client *services.ClientConnection, err error) {
+	select {
+	case client.Send <- services.WebSocketMessage{
+		Type:      "error",
+		Timestamp: time.Now(),
+		Error:     err.Error(),
+		Data:      map[string]interface{}{"valid_topics": services.ValidTopics()},
+	}:
+	default:
+	}
+}
+
+// sendError reports a rejected client message
+func sendError(client *services.ClientConnection, message string) {
+	select {
+	case client.Send <- services.WebSocketMessage{
+		Type:      "error",
+		Timestamp: time.Now(),
+		Error:     message,
+	}:
+	default:
+	}
+}
+
+// closeWithReason sends a close frame with a code and reason before the socket is torn down
+func closeWithReason(client *services.ClientConnection, code int, reason string) {
+	message := websocket.FormatCloseMessage(code, reason)
+	client.Conn.WriteControl(websocket.CloseMessage, message, time.Now().Add(time.Second))
+}
+
+// writePump writes messages to the WebSocket client and pings it every PingPeriod
 func writePump(client *services.ClientConnection, hub *services.WebSocketHub) {
+	ticker := time.NewTicker(hub.PingPeriod)
+	evicted := client.Evicted()
 	defer func() {
+		ticker.Stop()
 		client.Conn.Close()
 	}()
 
@@ -168,25 +374,50 @@ func writePump(client *services.ClientConnection, hub *services.WebSocketHub) {
 		case msg, ok := <-client.Send:
 			if !ok {
 				// Channel closed, close connection
-				client.Conn.WriteMessage(websocket.CloseMessage, []byte{})
+				closeWithReason(client, websocket.CloseNormalClosure, "")
 				return
 			}
 
-			err := client.Conn.WriteJSON(msg)
+			client.Conn.SetWriteDeadline(time.Now().Add(hub.WriteTimeout))
+			err := writeMessage(client, msg)
 			if err != nil {
-				if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
+				if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+					log.Printf("[WS] Write to %s timed out after %s, disconnecting", client.ID, hub.WriteTimeout)
+				} else if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
 					log.Printf("[WS] Write error: %v", err)
 				}
 				return
 			}
 
+		case <-ticker.C:
+			if err := client.Conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(hub.WriteTimeout)); err != nil {
+				return
+			}
+
+		case <-evicted:
+			code, reason := client.CloseReason()
+			closeWithReason(client, code, reason)
+			return
+
 		case <-client.Close:
-			client.Conn.WriteMessage(websocket.CloseMessage, []byte{})
+			closeWithReason(client, websocket.CloseNormalClosure, "")
 			return
 		}
 	}
 }
 
+// writeMessage sends a message as a JSON text frame or, for binary subprotocols, a binary frame
+func writeMessage(client *services.ClientConnection, msg services.WebSocketMessage) error {
+	if client.Encoding == services.EncodingJSON {
+		return client.Conn.WriteJSON(msg)
+	}
+	data, err := services.Encode(client.Encoding, msg)
+	if err != nil {
+		return err
+	}
+	return client.Conn.WriteMessage(websocket.BinaryMessage, data)
+}
+
 // HandleGetToken generates a new JWT token
 func HandleGetToken(c *gin.Context) {
 	hostname := c.DefaultQuery("server_name", "chowkidar-agent")
@@ -256,7 +487,7 @@ func HandleTokenStatus(c *gin.Context) {
 
 	if token == "" {
 		if middleware.GlobalSecurityLogger != nil {
-			middleware.GlobalSecurityLogger.LogFailedAuth(c.ClientIP(), "missing token in header or query")
+			middleware.GlobalSecurityLogger.LogMissingAuth(c.ClientIP(), "missing token in header or query")
 		}
 		c.JSON(http.StatusBadRequest, gin.H{"error": "token required in Authorization header or query parameter"})
 		return
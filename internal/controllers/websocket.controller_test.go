@@ -0,0 +1,44 @@
+package controllers
+
+import (
+	"chowkidar/internal/services"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestWebSocketQueryTokenOptOut(t *testing.T) {
+	// Without auth-first, a socket with no usable token is refused before the
+	// upgrade, so the response shows whether the token was considered at all
+	tests := []struct {
+		name       string
+		allowQuery bool
+		query      string
+		header     string
+		wantError  string
+	}{
+		{name: "query allowed", allowQuery: true, query: "token=forged", wantError: "invalid token"},
+		{name: "query ignored when disabled", query: "token=forged", wantError: "missing token"},
+		{name: "header still used when disabled", header: "Bearer forged", wantError: "invalid token"},
+	}
+	gin.SetMode(gin.TestMode)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hub := &services.WebSocketHub{AllowQueryToken: tt.allowQuery}
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request = httptest.NewRequest(http.MethodGet, "/ws?"+tt.query, nil)
+			if tt.header != "" {
+				c.Request.Header.Set("Authorization", tt.header)
+			}
+
+			serveWebSocket(c, hub)
+			if w.Code != http.StatusUnauthorized || !strings.Contains(w.Body.String(), tt.wantError) {
+				t.Errorf("got %d %s, want 401 with %q", w.Code, w.Body.String(), tt.wantError)
+			}
+		})
+	}
+}
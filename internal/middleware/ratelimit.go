@@ -0,0 +1,288 @@
+package middleware
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/time/rate"
+)
+
+// Rate limit route groups
+const (
+	RateLimitMetrics = "metrics" // /metrics/*, /processes/*
+	RateLimitHistory = "history" // /metrics/history*, /dashboard
+	RateLimitWS      = "ws"      // WebSocket upgrades
+	RateLimitAuth    = "auth"    // /security/*, /audit
+	RateLimitDefault = "default" // Anything without a group, e.g. unknown paths (404s)
+)
+
+// RateLimitPolicy is a token bucket: Rate requests per second refilling up to Burst
+type RateLimitPolicy struct {
+	Name  string
+	Rate  rate.Limit
+	Burst int
+}
+
+// defaultRateLimitPolicies are used when CHOWKIDAR_RATE_LIMIT_<GROUP> is unset
+var defaultRateLimitPolicies = map[string]RateLimitPolicy{
+	RateLimitMetrics: {Name: RateLimitMetrics, Rate: 50, Burst: 100},
+	RateLimitHistory: {Name: RateLimitHistory, Rate: 10, Burst: 20},
+	RateLimitWS:      {Name: RateLimitWS, Rate: rate.Every(2 * time.Second), Burst: 5},
+	RateLimitAuth:    {Name: RateLimitAuth, Rate: rate.Every(12 * time.Second), Burst: 10},
+	RateLimitDefault: {Name: RateLimitDefault, Rate: 5, Burst: 20},
+}
+
+// limiterEntry is a bucket plus the last time it was used (for idle eviction)
+type limiterEntry struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+// RateLimiter keeps one token bucket per key (client IP or token) for a single policy
+type RateLimiter struct {
+	policy     RateLimitPolicy
+	entries    map[string]*limiterEntry
+	maxEntries int // Hard cap; least recently used entries are evicted beyond it
+	mu         sync.Mutex
+}
+
+// NewRateLimiter creates a new rate limiter for a policy
+func NewRateLimiter(policy RateLimitPolicy) *RateLimiter {
+	return &RateLimiter{
+		policy:     policy,
+		entries:    make(map[string]*limiterEntry),
+		maxEntries: 10000,
+	}
+}
+
+// reserve takes one token from the key's bucket. The reservation is returned with
+// the tokens left so callers can report headers or cancel if another bucket rejects.
+func (rl *RateLimiter) reserve(key string, now time.Time) (*rate.Reservation, float64) {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	entry, exists := rl.entries[key]
+	if !exists {
+		if len(rl.entries) >= rl.maxEntries {
+			rl.evictOldest(len(rl.entries) - rl.maxEntries + 1)
+		}
+		entry = &limiterEntry{limiter: rate.NewLimiter(rl.policy.Rate, rl.policy.Burst)}
+		rl.entries[key] = entry
+	}
+	entry.lastSeen = now
+
+	reservation := entry.limiter.ReserveN(now, 1)
+	return reservation, entry.limiter.TokensAt(now)
+}
+
+// refillTime is how long an empty bucket takes to fill up again
+func (rl *RateLimiter) refillTime() time.Duration {
+	if rl.policy.Rate <= 0 || rl.policy.Rate == rate.Inf {
+		return 0
+	}
+	return time.Duration(float64(rl.policy.Burst) / float64(rl.policy.Rate) * float64(time.Second))
+}
+
+// EvictIdle drops buckets idle for longer than their refill time. Such buckets are
+// full again, so recreating them later is indistinguishable from keeping them.
+func (rl *RateLimiter) EvictIdle(now time.Time) int {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	idle := rl.refillTime()
+	if idle < time.Minute {
+		idle = time.Minute
+	}
+
+	evicted := 0
+	for key, entry := range rl.entries {
+		if now.Sub(entry.lastSeen) > idle {
+			delete(rl.entries, key)
+			evicted++
+		}
+	}
+	return evicted
+}
+
+// evictOldest drops the n least recently used buckets. Caller must hold rl.mu.
+func (rl *RateLimiter) evictOldest(n int) {
+	keys := make([]string, 0, len(rl.entries))
+	for key := range rl.entries {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return rl.entries[keys[i]].lastSeen.Before(rl.entries[keys[j]].lastSeen)
+	})
+	for i := 0; i < n && i < len(keys); i++ {
+		delete(rl.entries, keys[i])
+	}
+}
+
+// Len returns the number of tracked buckets
+func (rl *RateLimiter) Len() int {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	return len(rl.entries)
+}
+
+var (
+	rateLimiters   = map[string]*RateLimiter{}
+	rateLimitersMu sync.RWMutex
+)
+
+// InitRateLimiters builds one limiter per route group and starts idle eviction.
+// Policies can be overridden with CHOWKIDAR_RATE_LIMIT_<GROUP>="<rate per second>,<burst>"
+// (e.g. CHOWKIDAR_RATE_LIMIT_HISTORY="2,10"); "off" disables a group.
+func InitRateLimiters() {
+	rateLimitersMu.Lock()
+	for group, policy := range defaultRateLimitPolicies {
+		envName := "CHOWKIDAR_RATE_LIMIT_" + strings.ToUpper(group)
+		if spec := strings.TrimSpace(os.Getenv(envName)); spec != "" {
+			parsed, err := parseRateLimitPolicy(group, spec)
+			if err != nil {
+				log.Printf("⚠️  Invalid %s (%v), using default", envName, err)
+			} else {
+				policy = parsed
+			}
+		}
+		rateLimiters[group] = NewRateLimiter(policy)
+	}
+	rateLimitersMu.Unlock()
+
+	go func() {
+		ticker := time.NewTicker(time.Minute)
+		defer ticker.Stop()
+
+		for now := range ticker.C {
+			rateLimitersMu.RLock()
+			for _, limiter := range rateLimiters {
+				limiter.EvictIdle(now)
+			}
+			rateLimitersMu.RUnlock()
+		}
+	}()
+}
+
+// parseRateLimitPolicy parses "<rate per second>,<burst>" or "off"
+func parseRateLimitPolicy(group string, spec string) (RateLimitPolicy, error) {
+	if spec == "off" || spec == "0" {
+		return RateLimitPolicy{Name: group, Rate: rate.Inf}, nil
+	}
+
+	parts := strings.SplitN(spec, ",", 2)
+	if len(parts) != 2 {
+		return RateLimitPolicy{}, fmt.Errorf("expected <rate>,<burst>")
+	}
+	perSecond, err := strconv.ParseFloat(strings.TrimSpace(parts[0]), 64)
+	if err != nil || perSecond <= 0 {
+		return RateLimitPolicy{}, fmt.Errorf("invalid rate %q", parts[0])
+	}
+	burst, err := strconv.Atoi(strings.TrimSpace(parts[1]))
+	if err != nil || burst < 1 {
+		return RateLimitPolicy{}, fmt.Errorf("invalid burst %q", parts[1])
+	}
+	return RateLimitPolicy{Name: group, Rate: rate.Limit(perSecond), Burst: burst}, nil
+}
+
+// GetRateLimiter returns the limiter for a route group (nil if not initialized)
+func GetRateLimiter(group string) *RateLimiter {
+	rateLimitersMu.RLock()
+	defer rateLimitersMu.RUnlock()
+	return rateLimiters[group]
+}
+
+// RateLimit enforces a route group's policy per client IP and, when the request
+// carries a token, per token as well. Both buckets must have room.
+func RateLimit(group string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		limiter := GetRateLimiter(group)
+		if limiter == nil || limiter.policy.Rate == rate.Inf {
+			c.Next()
+			return
+		}
+		RateLimitMiddleware(limiter)(c)
+	}
+}
+
+// RateLimitMiddleware enforces rate limiting with a specific limiter
+func RateLimitMiddleware(limiter *RateLimiter) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		now := time.Now()
+		ip := c.ClientIP()
+
+		keys := []string{"ip:" + ip}
+		if token, _ := RequestToken(c); token != "" {
+			sum := sha256.Sum256([]byte(token))
+			keys = append(keys, "token:"+hex.EncodeToString(sum[:8]))
+		}
+
+		reservations := make([]*rate.Reservation, 0, len(keys))
+		remaining := math.Inf(1)
+		var wait time.Duration
+		for _, key := range keys {
+			reservation, tokens := limiter.reserve(key, now)
+			reservations = append(reservations, reservation)
+			if tokens < remaining {
+				remaining = tokens
+			}
+			if !reservation.OK() {
+				wait = time.Duration(math.MaxInt64)
+			} else if delay := reservation.DelayFrom(now); delay > wait {
+				wait = delay
+			}
+		}
+
+		policy := limiter.policy
+		if remaining < 0 {
+			remaining = 0
+		}
+		reset := time.Duration(0)
+		if policy.Rate > 0 {
+			reset = time.Duration((float64(policy.Burst) - remaining) / float64(policy.Rate) * float64(time.Second))
+		}
+		c.Header("RateLimit-Limit", strconv.Itoa(policy.Burst))
+		c.Header("RateLimit-Remaining", strconv.Itoa(int(math.Floor(remaining))))
+		c.Header("RateLimit-Reset", strconv.Itoa(ceilSeconds(reset)))
+		c.Header("RateLimit-Policy", fmt.Sprintf("%d;w=%d", policy.Burst, ceilSeconds(limiter.refillTime())))
+
+		if wait > 0 {
+			// Give the tokens back; a rejected request should not push the wait further out
+			for _, reservation := range reservations {
+				reservation.CancelAt(now)
+			}
+			retryAfter := ceilSeconds(wait)
+			if wait == time.Duration(math.MaxInt64) {
+				retryAfter = ceilSeconds(limiter.refillTime())
+			}
+
+			log.Printf("[SECURITY] Rate limit (%s) exceeded for IP: %s", policy.Name, ip)
+			c.Header("Retry-After", strconv.Itoa(retryAfter))
+			c.JSON(http.StatusTooManyRequests, gin.H{
+				"error":       "rate limit exceeded",
+				"retry_after": retryAfter,
+			})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// ceilSeconds rounds a duration up to whole seconds
+func ceilSeconds(d time.Duration) int {
+	if d <= 0 {
+		return 0
+	}
+	return int(math.Ceil(d.Seconds()))
+}
@@ -0,0 +1,207 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/time/rate"
+)
+
+// useRateLimiters installs limiters for the test and restores the previous ones afterwards
+func useRateLimiters(t *testing.T, policies ...RateLimitPolicy) {
+	t.Helper()
+	rateLimitersMu.Lock()
+	previous := rateLimiters
+	rateLimiters = map[string]*RateLimiter{}
+	for _, policy := range policies {
+		rateLimiters[policy.Name] = NewRateLimiter(policy)
+	}
+	rateLimitersMu.Unlock()
+
+	t.Cleanup(func() {
+		rateLimitersMu.Lock()
+		rateLimiters = previous
+		rateLimitersMu.Unlock()
+	})
+}
+
+// newRateLimitRouter routes /metrics and /history to their groups, /ws to a
+// disabled group and everything else to the default group
+func newRateLimitRouter() *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	ok := func(c *gin.Context) { c.Status(http.StatusOK) }
+	r.GET("/metrics", RateLimit(RateLimitMetrics), ok)
+	r.GET("/history", RateLimit(RateLimitHistory), ok)
+	r.GET("/ws", RateLimit(RateLimitWS), ok)
+	r.NoRoute(RateLimit(RateLimitDefault))
+	return r
+}
+
+// rateLimitRequest sends a GET from ip, with a bearer token if one is given
+func rateLimitRequest(r http.Handler, path string, ip string, token string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	req.RemoteAddr = ip + ":40000"
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestRateLimitGroups(t *testing.T) {
+	slow := rate.Every(time.Hour)
+	useRateLimiters(t,
+		RateLimitPolicy{Name: RateLimitMetrics, Rate: slow, Burst: 2},
+		RateLimitPolicy{Name: RateLimitHistory, Rate: slow, Burst: 1},
+		RateLimitPolicy{Name: RateLimitWS, Rate: rate.Inf},
+		RateLimitPolicy{Name: RateLimitDefault, Rate: slow, Burst: 2},
+	)
+	r := newRateLimitRouter()
+
+	steps := []struct {
+		path string
+		ip   string
+		want int
+	}{
+		{"/metrics", "192.0.2.1", http.StatusOK},
+		{"/metrics", "192.0.2.1", http.StatusOK},
+		{"/metrics", "192.0.2.1", http.StatusTooManyRequests},
+		{"/metrics", "192.0.2.2", http.StatusOK},              // Buckets are per IP
+		{"/history", "192.0.2.1", http.StatusOK},              // Groups do not share buckets
+		{"/history", "192.0.2.1", http.StatusTooManyRequests}, // ... and have their own burst
+		{"/ws", "192.0.2.1", http.StatusOK},                   // "off"
+		{"/ws", "192.0.2.1", http.StatusOK},
+		{"/ws", "192.0.2.1", http.StatusOK},
+		{"/unknown", "192.0.2.1", http.StatusNotFound}, // Unmatched paths use the default group
+		{"/also/unknown", "192.0.2.1", http.StatusNotFound},
+		{"/unknown", "192.0.2.1", http.StatusTooManyRequests},
+		{"/metrics", "192.0.2.3", http.StatusOK}, // A 404 scan does not eat into other groups
+	}
+	for i, step := range steps {
+		if got := rateLimitRequest(r, step.path, step.ip, "").Code; got != step.want {
+			t.Errorf("step %d: GET %s from %s = %d, want %d", i+1, step.path, step.ip, got, step.want)
+		}
+	}
+}
+
+func TestRateLimitTokenKey(t *testing.T) {
+	useRateLimiters(t, RateLimitPolicy{Name: RateLimitMetrics, Rate: rate.Every(time.Hour), Burst: 2})
+	r := newRateLimitRouter()
+
+	steps := []struct {
+		ip    string
+		token string
+		want  int
+	}{
+		{"192.0.2.1", "alpha", http.StatusOK},
+		{"192.0.2.2", "alpha", http.StatusOK},
+		{"192.0.2.3", "alpha", http.StatusTooManyRequests}, // Same token from a new IP
+		{"192.0.2.3", "", http.StatusOK},                   // The rejection gave the IP's token back
+		{"192.0.2.3", "beta", http.StatusOK},
+		{"192.0.2.3", "gamma", http.StatusTooManyRequests}, // A fresh token does not lift the IP limit
+	}
+	for i, step := range steps {
+		if got := rateLimitRequest(r, "/metrics", step.ip, step.token).Code; got != step.want {
+			t.Errorf("step %d: GET from %s with token %q = %d, want %d", i+1, step.ip, step.token, got, step.want)
+		}
+	}
+
+	// Tokens are keyed by a hash, never stored as-is
+	for key := range GetRateLimiter(RateLimitMetrics).entries {
+		if key == "token:alpha" || key == "token:beta" {
+			t.Errorf("raw token used as a bucket key: %s", key)
+		}
+	}
+}
+
+func TestRateLimitHeaders(t *testing.T) {
+	useRateLimiters(t, RateLimitPolicy{Name: RateLimitMetrics, Rate: 1, Burst: 3})
+	r := newRateLimitRouter()
+
+	tests := []struct {
+		code       int
+		remaining  string
+		reset      string
+		retryAfter string
+	}{
+		{code: http.StatusOK, remaining: "2", reset: "1"},
+		{code: http.StatusOK, remaining: "1", reset: "2"},
+		{code: http.StatusOK, remaining: "0", reset: "3"},
+		{code: http.StatusTooManyRequests, remaining: "0", reset: "3", retryAfter: "1"},
+	}
+	for i, tt := range tests {
+		w := rateLimitRequest(r, "/metrics", "192.0.2.1", "")
+		headers := map[string]string{
+			"RateLimit-Limit":     "3",
+			"RateLimit-Remaining": tt.remaining,
+			"RateLimit-Reset":     tt.reset,
+			"RateLimit-Policy":    "3;w=3",
+			"Retry-After":         tt.retryAfter,
+		}
+		if w.Code != tt.code {
+			t.Errorf("request %d: status %d, want %d", i+1, w.Code, tt.code)
+		}
+		for name, want := range headers {
+			if got := w.Header().Get(name); got != want {
+				t.Errorf("request %d: %s = %q, want %q", i+1, name, got, want)
+			}
+		}
+	}
+}
+
+func TestRateLimiterEviction(t *testing.T) {
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	t.Run("idle", func(t *testing.T) {
+		// Refills in 10m, so buckets idle for longer are full and can go
+		rl := NewRateLimiter(RateLimitPolicy{Name: RateLimitMetrics, Rate: rate.Every(time.Minute), Burst: 10})
+		rl.reserve("ip:192.0.2.1", start)
+		rl.reserve("ip:192.0.2.2", start.Add(5*time.Minute))
+
+		if evicted := rl.EvictIdle(start.Add(10 * time.Minute)); evicted != 0 {
+			t.Errorf("evicted %d buckets before they refilled", evicted)
+		}
+		if evicted := rl.EvictIdle(start.Add(11 * time.Minute)); evicted != 1 || rl.Len() != 1 {
+			t.Errorf("evicted %d, %d left, want 1 evicted and 1 left", evicted, rl.Len())
+		}
+		if _, exists := rl.entries["ip:192.0.2.2"]; !exists {
+			t.Error("evicted the recently used bucket")
+		}
+	})
+
+	t.Run("minimum idle time", func(t *testing.T) {
+		// Refills in 1s, but buckets are kept for at least a minute
+		rl := NewRateLimiter(RateLimitPolicy{Name: RateLimitMetrics, Rate: 10, Burst: 10})
+		rl.reserve("ip:192.0.2.1", start)
+		if evicted := rl.EvictIdle(start.Add(30 * time.Second)); evicted != 0 {
+			t.Errorf("evicted %d buckets idle for under a minute", evicted)
+		}
+		if evicted := rl.EvictIdle(start.Add(61 * time.Second)); evicted != 1 {
+			t.Errorf("evicted %d buckets, want 1", evicted)
+		}
+	})
+
+	t.Run("least recently used", func(t *testing.T) {
+		rl := NewRateLimiter(RateLimitPolicy{Name: RateLimitMetrics, Rate: 1, Burst: 10})
+		rl.maxEntries = 3
+		rl.reserve("a", start)
+		rl.reserve("b", start.Add(time.Second))
+		rl.reserve("c", start.Add(2*time.Second))
+		rl.reserve("a", start.Add(3*time.Second)) // a is now the most recent
+		rl.reserve("d", start.Add(4*time.Second)) // Over the cap: b goes
+
+		if rl.Len() != 3 {
+			t.Errorf("%d buckets, want the cap of 3", rl.Len())
+		}
+		for key, want := range map[string]bool{"a": true, "b": false, "c": true, "d": true} {
+			if _, exists := rl.entries[key]; exists != want {
+				t.Errorf("bucket %s kept = %v, want %v", key, exists, want)
+			}
+		}
+	})
+}
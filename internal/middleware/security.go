@@ -6,101 +6,30 @@ import (
 	"net"
 	"net/http"
 	"net/url"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
 
+	"chowkidar/internal/models"
 	"chowkidar/internal/services"
 
 	"github.com/gin-gonic/gin"
-	"golang.org/x/time/rate"
 )
 
 // Package-level security logger instance
 var GlobalSecurityLogger *SecurityLogger
 
-// RateLimiter implements token bucket rate limiting per IP
-type RateLimiter struct {
-	limiters map[string]*rate.Limiter
-	mu       sync.RWMutex
-}
-
-// NewRateLimiter creates a new rate limiter
-func NewRateLimiter() *RateLimiter {
-	return &RateLimiter{
-		limiters: make(map[string]*rate.Limiter),
-	}
-}
-
-// GetLimiter gets or creates a limiter for an IP address
-func (rl *RateLimiter) GetLimiter(ip string) *rate.Limiter {
-	rl.mu.Lock()
-	defer rl.mu.Unlock()
-
-	if limiter, exists := rl.limiters[ip]; exists {
-		return limiter
-	}
-
-	// 100 requests per second per IP, burst of 200
-	limiter := rate.NewLimiter(rate.Limit(100), 200)
-	rl.limiters[ip] = limiter
-	return limiter
-}
-
-// RateLimitMiddleware enforces rate limiting per IP
-func RateLimitMiddleware(limiter *RateLimiter) gin.HandlerFunc {
-	return func(c *gin.Context) {
-		ip := c.ClientIP()
-		if !limiter.GetLimiter(ip).Allow() {
-			log.Printf("[SECURITY] Rate limit exceeded for IP: %s", ip)
-			c.JSON(http.StatusTooManyRequests, gin.H{
-				"error":       "rate limit exceeded",
-				"retry_after": 60,
-			})
-			c.Abort()
-			return
-		}
-		c.Next()
-	}
-}
-
-// TokenRateLimiter limits token generation per IP (stricter than general rate limiting)
-type TokenRateLimiter struct {
-	limiters map[string]*rate.Limiter
-	mu       sync.RWMutex
-}
-
-// NewTokenRateLimiter creates a new token-specific rate limiter
-func NewTokenRateLimiter() *TokenRateLimiter {
-	return &TokenRateLimiter{
-		limiters: make(map[string]*rate.Limiter),
-	}
-}
-
-// GetLimiter gets or creates a limiter for an IP address
-func (tr *TokenRateLimiter) GetLimiter(ip string) *rate.Limiter {
-	tr.mu.Lock()
-	defer tr.mu.Unlock()
-
-	if limiter, exists := tr.limiters[ip]; exists {
-		return limiter
-	}
-
-	// 5 token requests per minute per IP, burst of 10
-	limiter := rate.NewLimiter(rate.Every(12*time.Second), 10)
-	tr.limiters[ip] = limiter
-	return limiter
-}
-
-// TokenRateLimitMiddleware enforces stricter rate limiting on token endpoints
-func TokenRateLimitMiddleware(limiter *TokenRateLimiter) gin.HandlerFunc {
+// BanMiddleware rejects requests from IPs banned by the lockout service
+func BanMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		ip := c.ClientIP()
-		if !limiter.GetLimiter(ip).Allow() {
-			log.Printf("[SECURITY] Token rate limit exceeded for IP: %s (possible token enumeration attempt)", ip)
-			c.JSON(http.StatusTooManyRequests, gin.H{
-				"error":       "token endpoint rate limited",
-				"retry_after": 60,
+		if ban, banned := services.IsBanned(ip); banned {
+			retryAfter := int(time.Until(ban.ExpiresAt).Seconds()) + 1
+			c.Header("Retry-After", strconv.Itoa(retryAfter))
+			c.JSON(http.StatusForbidden, gin.H{
+				"error":       "too many failed authentication attempts",
+				"retry_after": retryAfter,
 			})
 			c.Abort()
 			return
@@ -167,7 +96,7 @@ func CORSMiddleware(allowedOrigins []string) gin.HandlerFunc {
 				c.Header("Access-Control-Allow-Origin", normalizedOrigin)
 			}
 			c.Header("Access-Control-Allow-Credentials", "true")
-			c.Header("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
+			c.Header("Access-Control-Allow-Methods", "GET, POST, DELETE, OPTIONS")
 			c.Header("Access-Control-Allow-Headers", "Content-Type, Authorization")
 			c.Header("Access-Control-Max-Age", "86400")
 		}
@@ -181,13 +110,16 @@ func CORSMiddleware(allowedOrigins []string) gin.HandlerFunc {
 	}
 }
 
+// ClaimsContextKey is the gin context key holding the validated *services.CustomClaims
+const ClaimsContextKey = "chowkidar.claims"
+
 // AuthMiddleware enforces Bearer token authentication
 func AuthMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		authHeader := c.GetHeader("Authorization")
 		if authHeader == "" || !strings.HasPrefix(authHeader, "Bearer ") {
 			if GlobalSecurityLogger != nil {
-				GlobalSecurityLogger.LogFailedAuth(c.ClientIP(), "missing bearer token")
+				GlobalSecurityLogger.LogMissingAuth(c.ClientIP(), "missing bearer token")
 			}
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "authorization required"})
 			c.Abort()
@@ -197,14 +129,15 @@ func AuthMiddleware() gin.HandlerFunc {
 		token := strings.TrimSpace(strings.TrimPrefix(authHeader, "Bearer "))
 		if token == "" {
 			if GlobalSecurityLogger != nil {
-				GlobalSecurityLogger.LogFailedAuth(c.ClientIP(), "empty token")
+				GlobalSecurityLogger.LogMissingAuth(c.ClientIP(), "empty token")
 			}
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "authorization required"})
 			c.Abort()
 			return
 		}
 
-		if _, err := services.ValidateToken(token); err != nil {
+		claims, err := services.ValidateToken(token)
+		if err != nil {
 			if GlobalSecurityLogger != nil {
 				GlobalSecurityLogger.LogFailedAuth(c.ClientIP(), "invalid token: "+err.Error())
 			}
@@ -213,57 +146,188 @@ func AuthMiddleware() gin.HandlerFunc {
 			return
 		}
 
+		// Expose claims to handlers (audit, per-token limits)
+		c.Set(ClaimsContextKey, claims)
 		c.Next()
 	}
 }
 
-// IPWhitelistMiddleware restricts access to whitelisted IPs
+// Token sources reported by RequestToken
+const (
+	TokenSourceHeader      = "header"      // Authorization: Bearer <token>
+	TokenSourceSubprotocol = "subprotocol" // Sec-WebSocket-Protocol: chowkidar, bearer.<token>
+	TokenSourceQuery       = "query"       // ?token=<token> (leaks into proxy/access logs)
+)
+
+// WebSocketBearerPrefix marks the Sec-WebSocket-Protocol entry that carries a token.
+// Browsers cannot set headers on WebSocket upgrades, so the token rides in the
+// subprotocol list next to the real "chowkidar" protocol the server selects.
+const WebSocketBearerPrefix = "bearer."
+
+// RequestToken extracts a token from the Authorization header, the WebSocket
+// subprotocol list or the ?token= query, in that order of preference
+func RequestToken(c *gin.Context) (string, string) {
+	if authHeader := c.GetHeader("Authorization"); strings.HasPrefix(authHeader, "Bearer ") {
+		if token := strings.TrimSpace(strings.TrimPrefix(authHeader, "Bearer ")); token != "" {
+			return token, TokenSourceHeader
+		}
+	}
+
+	for _, header := range c.Request.Header.Values("Sec-WebSocket-Protocol") {
+		for _, protocol := range strings.Split(header, ",") {
+			protocol = strings.TrimSpace(protocol)
+			if strings.HasPrefix(protocol, WebSocketBearerPrefix) && len(protocol) > len(WebSocketBearerPrefix) {
+				return strings.TrimPrefix(protocol, WebSocketBearerPrefix), TokenSourceSubprotocol
+			}
+		}
+	}
+
+	if token := c.Query("token"); token != "" {
+		return token, TokenSourceQuery
+	}
+	return "", ""
+}
+
+// IPWhitelist restricts access by client address. Entries may be single IPv4/IPv6
+// addresses or CIDR ranges. Deny entries always win; an empty allow list allows
+// every address that is not denied.
 type IPWhitelist struct {
-	ips map[string]bool
-	mu  sync.RWMutex
+	allow []*net.IPNet
+	deny  []*net.IPNet
+	mu    sync.RWMutex
 }
 
-// NewIPWhitelist creates a new IP whitelist
-func NewIPWhitelist(ips []string) *IPWhitelist {
-	wl := &IPWhitelist{
-		ips: make(map[string]bool),
+// NewIPWhitelist creates a new IP whitelist from allow and deny entries
+func NewIPWhitelist(allow []string, deny []string) (*IPWhitelist, error) {
+	wl := &IPWhitelist{}
+	if err := wl.Update(allow, deny); err != nil {
+		return nil, err
 	}
-	for _, ip := range ips {
-		wl.ips[ip] = true
+	return wl, nil
+}
+
+// Update atomically replaces the allow and deny entries
+func (wl *IPWhitelist) Update(allow []string, deny []string) error {
+	allowNets, err := parseIPNets(allow)
+	if err != nil {
+		return err
+	}
+	denyNets, err := parseIPNets(deny)
+	if err != nil {
+		return err
 	}
-	return wl
+
+	wl.mu.Lock()
+	defer wl.mu.Unlock()
+	wl.allow = allowNets
+	wl.deny = denyNets
+	return nil
 }
 
-// IsAllowed checks if an IP is whitelisted
+// IsAllowed checks if an IP is permitted by the deny and allow entries
 func (wl *IPWhitelist) IsAllowed(ip string) bool {
 	wl.mu.RLock()
 	defer wl.mu.RUnlock()
 
-	// Allow localhost always
-	if ip == "127.0.0.1" || ip == "::1" || ip == "localhost" {
-		return true
+	// Strip port from IP if present
+	ipOnly, _, err := net.SplitHostPort(ip)
+	if err != nil {
+		ipOnly = ip
+	}
+
+	// Drop IPv6 zone (fe80::1%eth0) before parsing
+	if zone := strings.IndexByte(ipOnly, '%'); zone != -1 {
+		ipOnly = ipOnly[:zone]
+	}
+
+	parsed := net.ParseIP(strings.TrimSpace(ipOnly))
+	if parsed == nil {
+		// Unparseable client addresses only pass when nothing is configured
+		return len(wl.allow) == 0 && len(wl.deny) == 0
+	}
+
+	// Normalise IPv4-mapped IPv6 (::ffff:10.0.0.1) so IPv4 CIDRs match
+	if v4 := parsed.To4(); v4 != nil {
+		parsed = v4
+	}
+
+	for _, n := range wl.deny {
+		if n.Contains(parsed) {
+			return false
+		}
 	}
 
 	// If no whitelist configured, allow all
-	if len(wl.ips) == 0 {
+	if len(wl.allow) == 0 {
 		return true
 	}
 
-	// Strip port from IP if present
-	ipOnly, _, _ := net.SplitHostPort(ip)
-	if ipOnly == "" {
-		ipOnly = ip
+	for _, n := range wl.allow {
+		if n.Contains(parsed) {
+			return true
+		}
 	}
+	return false
+}
 
-	return wl.ips[ipOnly]
+// IsEmpty reports whether the list has neither allow nor deny entries
+func (wl *IPWhitelist) IsEmpty() bool {
+	wl.mu.RLock()
+	defer wl.mu.RUnlock()
+	return len(wl.allow) == 0 && len(wl.deny) == 0
 }
 
-// IPWhitelistMiddleware enforces IP whitelisting
+// parseIPNets converts addresses and CIDR ranges into networks.
+// A bare address becomes a single-host network (/32 or /128).
+func parseIPNets(entries []string) ([]*net.IPNet, error) {
+	nets := []*net.IPNet{}
+	for _, entry := range entries {
+		trimmed := strings.TrimSpace(entry)
+		if trimmed == "" {
+			continue
+		}
+		if trimmed == "localhost" {
+			trimmed = "127.0.0.1"
+			nets = append(nets, &net.IPNet{IP: net.IPv6loopback, Mask: net.CIDRMask(128, 128)})
+		}
+
+		if strings.Contains(trimmed, "/") {
+			_, n, err := net.ParseCIDR(trimmed)
+			if err != nil {
+				return nil, fmt.Errorf("invalid CIDR %q: %w", trimmed, err)
+			}
+			if v4 := n.IP.To4(); v4 != nil && len(n.Mask) == net.IPv4len {
+				n.IP = v4
+			}
+			nets = append(nets, n)
+			continue
+		}
+
+		ip := net.ParseIP(trimmed)
+		if ip == nil {
+			return nil, fmt.Errorf("invalid IP address %q", trimmed)
+		}
+		if v4 := ip.To4(); v4 != nil {
+			nets = append(nets, &net.IPNet{IP: v4, Mask: net.CIDRMask(32, 32)})
+		} else {
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(128, 128)})
+		}
+	}
+	return nets, nil
+}
+
+// IPWhitelistMiddleware enforces IP whitelisting.
+// The client IP comes from gin's ClientIP, which only honours X-Forwarded-For /
+// X-Real-IP when the direct peer is listed in CHOWKIDAR_TRUSTED_PROXIES.
 func IPWhitelistMiddleware(whitelist *IPWhitelist) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		ip := c.ClientIP()
-		if !whitelist.IsAllowed(ip) {
-			log.Printf("[SECURITY] Access denied for non-whitelisted IP: %s", ip)
+		// Push tunnel requests are authenticated by the tunnel token instead
+		if !whitelist.IsAllowed(ip) && !services.IsTunnelled(c.Request) {
+			log.Printf("[SECURITY] Access denied for non-whitelisted IP: %s (%s %s)", ip, c.Request.Method, c.Request.URL.Path)
+			if GlobalSecurityLogger != nil {
+				GlobalSecurityLogger.LogAccessDenied(ip, "ip_denied", "ip not allowed", c.Request.URL.Path)
+			}
 			c.JSON(http.StatusForbidden, gin.H{"error": "access denied"})
 			c.Abort()
 			return
@@ -287,14 +351,39 @@ func (sl *SecurityLogger) LogTokenShared(token string, ip string) {
 		tokenPreview = token[:10] + "..."
 	}
 	log.Printf("[SECURITY-WARNING] Possible token sharing: %s from IP %s", tokenPreview, ip)
+	services.RecordAudit(models.AuditEvent{
+		Type:    "token_shared",
+		Outcome: services.AuditFailure,
+		IP:      ip,
+		Reason:  "possible token sharing",
+	})
 }
 
-// LogFailedAuth logs failed authentication attempts
+// LogFailedAuth logs a presented-but-invalid credential and feeds the lockout service
 func (sl *SecurityLogger) LogFailedAuth(ip string, reason string) {
+	sl.logAuthFailure(ip, reason)
+	services.RecordAuthFailure(ip, reason)
+}
+
+// LogMissingAuth logs a request that presented no credential. It is not counted
+// towards lockout, so dashboards before login and health probes are never banned.
+func (sl *SecurityLogger) LogMissingAuth(ip string, reason string) {
+	sl.logAuthFailure(ip, reason)
+}
+
+// logAuthFailure logs and publishes an auth_failed event
+func (sl *SecurityLogger) logAuthFailure(ip string, reason string) {
 	sl.mu.Lock()
 	defer sl.mu.Unlock()
 
 	log.Printf("[SECURITY-WARNING] Failed authentication from IP %s: %s", ip, reason)
+	services.PublishEvent(models.Event{
+		Type:       models.EventAuthFailed,
+		Severity:   models.SeverityWarning,
+		Source:     "security",
+		Message:    "authentication failed: " + reason,
+		Attributes: map[string]interface{}{"ip": ip, "reason": reason},
+	})
 }
 
 // LogTokenGenerated logs successful token generation
@@ -303,14 +392,31 @@ func (sl *SecurityLogger) LogTokenGenerated(ip string, serverName string) {
 	defer sl.mu.Unlock()
 
 	log.Printf("[SECURITY] Token generated for server %s from IP %s", serverName, ip)
+	services.RecordAudit(models.AuditEvent{
+		Type:       "token_generated",
+		Outcome:    services.AuditSuccess,
+		IP:         ip,
+		ServerName: serverName,
+	})
 }
 
 // LogWebSocketConnected logs successful WebSocket connections
-func (sl *SecurityLogger) LogWebSocketConnected(ip string, serverName string) {
+func (sl *SecurityLogger) LogWebSocketConnected(ip string, serverName string, tokenID string) {
 	sl.mu.Lock()
 	defer sl.mu.Unlock()
 
 	log.Printf("[SECURITY] WebSocket connected for server %s from IP %s", serverName, ip)
+	services.PublishEvent(models.Event{
+		Type:    models.EventClientConnected,
+		Source:  "websocket",
+		Message: "client connected for server " + serverName,
+		Attributes: map[string]interface{}{
+			"ip":          ip,
+			"server_name": serverName,
+			"token_jti":   tokenID,
+			"transport":   "ws",
+		},
+	})
 }
 
 // LogWebSocketDisconnected logs WebSocket disconnections
@@ -319,6 +425,27 @@ func (sl *SecurityLogger) LogWebSocketDisconnected(ip string, clientID string) {
 	defer sl.mu.Unlock()
 
 	log.Printf("[SECURITY] WebSocket disconnected: %s from IP %s", clientID, ip)
+	services.PublishEvent(models.Event{
+		Type:    models.EventClientDisconnected,
+		Source:  "websocket",
+		Message: "client disconnected: " + clientID,
+		Attributes: map[string]interface{}{
+			"ip":        ip,
+			"client_id": clientID,
+			"transport": "ws",
+		},
+	})
+}
+
+// LogAccessDenied logs requests rejected by IP lists or rate limits
+func (sl *SecurityLogger) LogAccessDenied(ip string, eventType string, reason string, path string) {
+	services.RecordAudit(models.AuditEvent{
+		Type:    eventType,
+		Outcome: services.AuditDenied,
+		IP:      ip,
+		Reason:  reason,
+		Details: map[string]string{"path": path},
+	})
 }
 
 // NewSecurityLogger creates a new security logger
@@ -0,0 +1,197 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestIPWhitelist(t *testing.T) {
+	tests := []struct {
+		name    string
+		allow   []string
+		deny    []string
+		allowed map[string]bool // Client address -> expected
+	}{
+		{
+			name:    "empty lists allow everything",
+			allowed: map[string]bool{"203.0.113.7": true, "::1": true, "not-an-ip": true},
+		},
+		{
+			name:  "cidr and single addresses",
+			allow: []string{"10.0.0.0/8", " 192.168.1.5 ", "2001:db8::/32", ""},
+			allowed: map[string]bool{
+				"10.1.2.3":      true,
+				"10.1.2.3:5555": true, // Port stripped
+				"11.0.0.1":      false,
+				"192.168.1.5":   true,
+				"192.168.1.6":   false,
+				"2001:db8::1":   true,
+				"2001:db9::1":   false,
+				"not-an-ip":     false,
+			},
+		},
+		{
+			name:  "localhost is not implicitly allowed",
+			allow: []string{"10.0.0.0/8"},
+			allowed: map[string]bool{
+				"127.0.0.1": false,
+				"::1":       false,
+			},
+		},
+		{
+			name:  "localhost entry covers both loopbacks",
+			allow: []string{"localhost"},
+			allowed: map[string]bool{
+				"127.0.0.1":   true,
+				"[::1]:8080":  true,
+				"127.0.0.2":   false,
+				"192.168.0.1": false,
+			},
+		},
+		{
+			name:  "ipv4-mapped ipv6 matches ipv4 entries",
+			allow: []string{"10.0.0.0/8"},
+			deny:  []string{"10.0.0.9"},
+			allowed: map[string]bool{
+				"::ffff:10.0.0.1":       true,
+				"[::ffff:10.0.0.1]:443": true,
+				"::ffff:10.0.0.9":       false,
+				"::ffff:172.16.0.1":     false,
+			},
+		},
+		{
+			name:  "ipv6 zones are stripped",
+			allow: []string{"fe80::/10"},
+			allowed: map[string]bool{
+				"fe80::1%eth0":        true,
+				"[fe80::1%eth0]:8080": true,
+				"fe90::1%eth0":        true,
+				"2001:db8::1%eth0":    false,
+			},
+		},
+		{
+			name:  "deny wins over allow",
+			allow: []string{"10.0.0.0/8"},
+			deny:  []string{"10.0.5.0/24"},
+			allowed: map[string]bool{
+				"10.0.4.1": true,
+				"10.0.5.1": false,
+			},
+		},
+		{
+			name: "deny only",
+			deny: []string{"203.0.113.0/24", "2001:db8::1"},
+			allowed: map[string]bool{
+				"203.0.113.9":  false,
+				"198.51.100.1": true,
+				"2001:db8::1":  false,
+				"2001:db8::2":  true,
+				"not-an-ip":    false, // Unparseable addresses fail once anything is configured
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			wl, err := NewIPWhitelist(tt.allow, tt.deny)
+			if err != nil {
+				t.Fatalf("NewIPWhitelist(%q, %q): %v", tt.allow, tt.deny, err)
+			}
+			if empty := len(tt.allow) == 0 && len(tt.deny) == 0; wl.IsEmpty() != empty {
+				t.Errorf("IsEmpty() = %v, want %v", wl.IsEmpty(), empty)
+			}
+			for ip, want := range tt.allowed {
+				if got := wl.IsAllowed(ip); got != want {
+					t.Errorf("IsAllowed(%q) = %v, want %v", ip, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestParseIPNets(t *testing.T) {
+	tests := []struct {
+		entries []string
+		want    []string // Networks, as strings
+		wantErr bool
+	}{
+		{entries: []string{"10.0.0.1"}, want: []string{"10.0.0.1/32"}},
+		{entries: []string{"2001:db8::1"}, want: []string{"2001:db8::1/128"}},
+		{entries: []string{"10.1.2.3/8"}, want: []string{"10.0.0.0/8"}},
+		{entries: []string{"::ffff:10.0.0.1"}, want: []string{"10.0.0.1/32"}},
+		{entries: []string{"localhost"}, want: []string{"::1/128", "127.0.0.1/32"}},
+		{entries: []string{"", "  "}, want: []string{}},
+		{entries: []string{"10.0.0.0/33"}, wantErr: true},
+		{entries: []string{"10.0.0.256"}, wantErr: true},
+		{entries: []string{"example.com"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		nets, err := parseIPNets(tt.entries)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("parseIPNets(%q) = %v, want an error", tt.entries, nets)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parseIPNets(%q): %v", tt.entries, err)
+			continue
+		}
+		got := []string{}
+		for _, n := range nets {
+			got = append(got, n.String())
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parseIPNets(%q) = %q, want %q", tt.entries, got, tt.want)
+		}
+	}
+
+	if _, err := NewIPWhitelist([]string{"10.0.0.1"}, []string{"bad"}); err == nil {
+		t.Error("NewIPWhitelist accepted an invalid deny entry")
+	}
+}
+
+func TestRequestToken(t *testing.T) {
+	tests := []struct {
+		name       string
+		header     string   // Authorization
+		protocols  []string // Sec-WebSocket-Protocol header values
+		query      string
+		wantToken  string
+		wantSource string
+	}{
+		{name: "none"},
+		{name: "header", header: "Bearer abc", wantToken: "abc", wantSource: TokenSourceHeader},
+		{name: "header whitespace", header: "Bearer  abc ", wantToken: "abc", wantSource: TokenSourceHeader},
+		{name: "header beats subprotocol and query", header: "Bearer abc", protocols: []string{"chowkidar, bearer.def"}, query: "token=ghi", wantToken: "abc", wantSource: TokenSourceHeader},
+		{name: "empty bearer falls through", header: "Bearer  ", query: "token=ghi", wantToken: "ghi", wantSource: TokenSourceQuery},
+		{name: "other scheme ignored", header: "Basic abc", wantToken: "", wantSource: ""},
+		{name: "subprotocol", protocols: []string{"chowkidar, bearer.def"}, wantToken: "def", wantSource: TokenSourceSubprotocol},
+		{name: "subprotocol in a later header", protocols: []string{"chowkidar", "bearer.def"}, wantToken: "def", wantSource: TokenSourceSubprotocol},
+		{name: "subprotocol beats query", protocols: []string{"bearer.def"}, query: "token=ghi", wantToken: "def", wantSource: TokenSourceSubprotocol},
+		{name: "bare subprotocol prefix ignored", protocols: []string{"chowkidar, bearer."}, query: "token=ghi", wantToken: "ghi", wantSource: TokenSourceQuery},
+		{name: "query", query: "token=ghi", wantToken: "ghi", wantSource: TokenSourceQuery},
+		{name: "empty query", query: "token=", wantToken: "", wantSource: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/ws?"+tt.query, nil)
+			if tt.header != "" {
+				req.Header.Set("Authorization", tt.header)
+			}
+			for _, protocol := range tt.protocols {
+				req.Header.Add("Sec-WebSocket-Protocol", protocol)
+			}
+			c, _ := gin.CreateTestContext(httptest.NewRecorder())
+			c.Request = req
+
+			token, source := RequestToken(c)
+			if token != tt.wantToken || source != tt.wantSource {
+				t.Errorf("RequestToken() = %q, %q, want %q, %q", token, source, tt.wantToken, tt.wantSource)
+			}
+		})
+	}
+}
@@ -0,0 +1,24 @@
+package models
+
+import "time"
+
+// AuditEvent is a single structured security event written to the audit log
+type AuditEvent struct {
+	Timestamp  time.Time         `json:"timestamp"`
+	Type       string            `json:"type"`    // e.g. "auth_failed", "ws_connected", "ip_banned"
+	Outcome    string            `json:"outcome"` // "success", "failure" or "denied"
+	IP         string            `json:"ip,omitempty"`
+	TokenID    string            `json:"token_jti,omitempty"`
+	ServerName string            `json:"server_name,omitempty"`
+	Reason     string            `json:"reason,omitempty"`
+	Details    map[string]string `json:"details,omitempty"`
+}
+
+// AuditFilter selects audit events for queries
+type AuditFilter struct {
+	Since time.Time
+	Until time.Time
+	Types []string
+	IP    string
+	Limit int
+}
@@ -0,0 +1,18 @@
+package models
+
+import "time"
+
+// BanEntry represents a temporary ban issued after repeated failed authentication
+type BanEntry struct {
+	IP         string    `json:"ip"`
+	Reason     string    `json:"reason"`
+	BannedAt   time.Time `json:"banned_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+	Strikes    int       `json:"strikes"`     // Number of bans issued in the current backoff period
+	LastStrike time.Time `json:"last_strike"` // Used to decay strikes after a quiet period
+}
+
+// Active reports whether the ban is still in effect at the given time
+func (b BanEntry) Active(now time.Time) bool {
+	return now.Before(b.ExpiresAt)
+}
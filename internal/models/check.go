@@ -0,0 +1,95 @@
+package models
+
+import "time"
+
+// Check states, indexed by Nagios plugin exit code
+const (
+	CheckOK       = "OK"
+	CheckWarning  = "WARNING"
+	CheckCritical = "CRITICAL"
+	CheckUnknown  = "UNKNOWN"
+	CheckPending  = "PENDING" // Not run yet
+)
+
+// CheckStates maps Nagios exit codes 0-3 to states; any other code is UNKNOWN
+var CheckStates = []string{CheckOK, CheckWarning, CheckCritical, CheckUnknown}
+
+// Check types
+const (
+	CheckTypeExec = "exec" // Nagios plugin command (the default)
+	CheckTypeHTTP = "http"
+	CheckTypeTCP  = "tcp"
+	CheckTypeDNS  = "dns"
+	CheckTypeTLS  = "tls" // Certificate expiry
+)
+
+// CheckConfig is one check in CHOWKIDAR_CHECKS_FILE
+type CheckConfig struct {
+	Name     string `json:"name"`
+	Type     string `json:"type,omitempty"`     // Default: exec
+	Interval string `json:"interval,omitempty"` // Default: CHOWKIDAR_CHECK_INTERVAL
+	Timeout  string `json:"timeout,omitempty"`  // Default: CHOWKIDAR_CHECK_TIMEOUT
+
+	// exec
+	Command []string `json:"command,omitempty"` // Program and arguments, run without a shell
+
+	// http
+	URL          string `json:"url,omitempty"`
+	Method       string `json:"method,omitempty"`        // Default: GET
+	ExpectStatus []int  `json:"expect_status,omitempty"` // Default: any 2xx or 3xx
+	ExpectBody   string `json:"expect_body,omitempty"`   // Regular expression the body must match
+
+	// tcp and tls
+	Address string `json:"address,omitempty"` // host:port
+
+	// dns
+	Host            string   `json:"host,omitempty"`             // Name to resolve
+	Server          string   `json:"server,omitempty"`           // Default: the system resolver
+	ExpectAddresses []string `json:"expect_addresses,omitempty"` // Addresses that must be returned
+
+	// http, tcp and dns: response time thresholds, e.g. "500ms"
+	WarnLatency string `json:"warn_latency,omitempty"`
+	CritLatency string `json:"crit_latency,omitempty"`
+
+	// tls: days left before the certificate expires (defaults: 30 and 7)
+	WarnDays int `json:"warn_days,omitempty"`
+	CritDays int `json:"crit_days,omitempty"`
+
+	// http and tls
+	InsecureSkipVerify bool `json:"insecure_skip_verify,omitempty"`
+}
+
+// ChecksFile is the layout of CHOWKIDAR_CHECKS_FILE
+type ChecksFile struct {
+	Checks []CheckConfig `json:"checks"`
+}
+
+// PerfData is one Nagios performance data value, as reported by the plugin
+type PerfData struct {
+	Label string   `json:"label"`
+	Value float64  `json:"value"`
+	Unit  string   `json:"unit,omitempty"` // e.g. s, ms, %, B, KB, c
+	Warn  string   `json:"warn,omitempty"` // Threshold range, e.g. "80" or "@10:20"
+	Crit  string   `json:"crit,omitempty"`
+	Min   *float64 `json:"min,omitempty"`
+	Max   *float64 `json:"max,omitempty"`
+}
+
+// CheckResult is a check's settings and latest result
+type CheckResult struct {
+	Name            string     `json:"name"`
+	Type            string     `json:"type"`
+	Command         []string   `json:"command,omitempty"`
+	Target          string     `json:"target,omitempty"` // URL, address or host of synthetic checks
+	Interval        string     `json:"interval"`
+	Timeout         string     `json:"timeout"`
+	State           string     `json:"state"`
+	ExitCode        *int       `json:"exit_code,omitempty"`   // exec checks
+	Output          string     `json:"output,omitempty"`      // First line of plugin output
+	LongOutput      string     `json:"long_output,omitempty"` // Remaining lines
+	PerfData        []PerfData `json:"perfdata,omitempty"`
+	Truncated       bool       `json:"truncated,omitempty"` // Output exceeded CHOWKIDAR_CHECK_OUTPUT_MAX
+	LastRun         *time.Time `json:"last_run,omitempty"`
+	Duration        string     `json:"duration,omitempty"`
+	LastStateChange *time.Time `json:"last_state_change,omitempty"`
+}
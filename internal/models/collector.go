@@ -0,0 +1,30 @@
+package models
+
+import "time"
+
+// Sample kinds
+const (
+	SampleGauge   = "gauge"   // A current value, e.g. usage percent
+	SampleCounter = "counter" // A monotonic total, e.g. bytes sent since boot
+)
+
+// Sample is one typed value produced by a collector
+type Sample struct {
+	Name   string            `json:"name"` // Relative to the collector, e.g. "usage_percent"
+	Kind   string            `json:"kind"`
+	Unit   string            `json:"unit,omitempty"` // UCUM, e.g. "%", "By", "By/s", "1"
+	Labels map[string]string `json:"labels,omitempty"`
+	Value  float64           `json:"value"`
+}
+
+// CollectorStatus describes a registered collector and its last run
+type CollectorStatus struct {
+	Name        string     `json:"name"`
+	Description string     `json:"description"`
+	Enabled     bool       `json:"enabled"`
+	Interval    string     `json:"interval"`
+	LastRun     *time.Time `json:"last_run,omitempty"`
+	Duration    string     `json:"duration,omitempty"` // How long the last run took
+	Samples     int        `json:"samples"`            // Samples in the last run
+	Error       string     `json:"error,omitempty"`    // Error of the last run
+}
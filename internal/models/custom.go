@@ -0,0 +1,23 @@
+package models
+
+import "time"
+
+// CustomMetric is one application-defined series value, e.g. from StatsD
+type CustomMetric struct {
+	Name      string            `json:"name"`           // Series name incl. tags, queried as custom:<name>
+	Type      string            `json:"type"`           // counter, gauge, timer, histogram, distribution, set
+	Tags      map[string]string `json:"tags,omitempty"` // Tags without a value map to ""
+	Value     float64           `json:"value"`
+	Timestamp time.Time         `json:"timestamp"`
+}
+
+// StatsDStats describes the StatsD listener
+type StatsDStats struct {
+	Address       string     `json:"address"`
+	FlushInterval string     `json:"flush_interval"`
+	Packets       uint64     `json:"packets"` // Datagrams received
+	Samples       uint64     `json:"samples"` // Valid samples aggregated
+	Invalid       uint64     `json:"invalid"` // Lines that could not be parsed
+	Dropped       uint64     `json:"dropped"` // Samples for new series beyond the series limit
+	LastFlush     *time.Time `json:"last_flush,omitempty"`
+}
@@ -0,0 +1,50 @@
+package models
+
+import "time"
+
+// Event types published on the agent's internal event bus
+const (
+	EventCollectorError     = "collector_error"
+	EventAuthFailed         = "auth_failed"
+	EventClientConnected    = "client_connected"
+	EventClientDisconnected = "client_disconnected"
+	EventThresholdCrossed   = "threshold_crossed"
+	EventProcessStarted     = "process_started"
+	EventProcessExited      = "process_exited"
+	EventMountAdded         = "mount_added"
+	EventMountRemoved       = "mount_removed"
+	EventCheckStateChanged  = "check_state_changed"
+
+	// Kernel log events (see KernelEvent)
+	EventOOMKill            = "oom_kill"
+	EventSegfault           = "segfault"
+	EventHungTask           = "hung_task"
+	EventIOError            = "io_error"
+	EventFilesystemReadOnly = "fs_readonly"
+)
+
+// Event severities
+const (
+	SeverityInfo     = "info"
+	SeverityWarning  = "warning"
+	SeverityCritical = "critical"
+)
+
+// Event is a typed agent-internal event. Attributes carry the type-specific
+// details (e.g. "ip" for auth_failed, "metric"/"value" for threshold_crossed).
+type Event struct {
+	ID         uint64                 `json:"id"`
+	Type       string                 `json:"type"`
+	Timestamp  time.Time              `json:"timestamp"`
+	Severity   string                 `json:"severity"`
+	Source     string                 `json:"source"` // Publishing component, e.g. "processes", "security"
+	Message    string                 `json:"message,omitempty"`
+	Attributes map[string]interface{} `json:"attributes,omitempty"`
+}
+
+// EventFilter selects events from the recent-events buffer
+type EventFilter struct {
+	Since time.Time
+	Types []string
+	Limit int
+}
@@ -0,0 +1,37 @@
+package models
+
+import "time"
+
+// FleetServer is an agent registered with a hub-mode instance
+type FleetServer struct {
+	Name    string    `json:"name"`
+	URL     string    `json:"url"`   // Agent base URL, e.g. http://10.0.0.5:8080
+	Token   string    `json:"token"` // Agent token; never returned by the API
+	AddedAt time.Time `json:"added_at"`
+}
+
+// FleetServerStatus is the hub's view of one agent connection
+type FleetServerStatus struct {
+	Name        string      `json:"name"`
+	URL         string      `json:"url,omitempty"`     // Dialled agents
+	Address     string      `json:"address,omitempty"` // Push agents: the IP they connected from
+	Mode        string      `json:"mode"`              // "dial" (hub connects out) or "push" (agent connects in)
+	Connected   bool        `json:"connected"`
+	ConnectedAt *time.Time  `json:"connected_at,omitempty"`
+	LastSeen    *time.Time  `json:"last_seen,omitempty"` // Last stats message received
+	LastError   string      `json:"last_error,omitempty"`
+	Stats       interface{} `json:"stats,omitempty"` // Latest stats payload (only on /fleet/metrics)
+}
+
+// TunnelRequest is an API call the hub forwards to a push-mode agent
+type TunnelRequest struct {
+	Method string `json:"method"`
+	Path   string `json:"path"` // Path and query, e.g. /metrics/cpu
+}
+
+// TunnelResponse is the agent's answer to a TunnelRequest
+type TunnelResponse struct {
+	Status      int    `json:"status"`
+	ContentType string `json:"content_type,omitempty"`
+	Body        string `json:"body"`
+}
@@ -47,3 +47,15 @@ type HistoricalDataWindow struct {
 	Disk    []DiskHistory    `json:"disk"`
 	Network []NetworkHistory `json:"network"`
 }
+
+// HistoryPoint joins the samples taken at one history tick (used for replay/resume)
+type HistoryPoint struct {
+	Timestamp time.Time       `json:"timestamp"`
+	CPU       *CPUHistory     `json:"cpu,omitempty"`
+	Memory    *MemoryHistory  `json:"memory,omitempty"`
+	Disk      *DiskHistory    `json:"disk,omitempty"`
+	Network   *NetworkHistory `json:"network,omitempty"`
+	// Latest samples of every enabled collector, by collector name; only set on
+	// live snapshots handed to the outputs
+	Samples map[string][]Sample `json:"samples,omitempty"`
+}
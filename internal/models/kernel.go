@@ -0,0 +1,14 @@
+package models
+
+import "time"
+
+// KernelEvent is a notable kernel log message parsed into structured fields
+type KernelEvent struct {
+	Type      string            `json:"type"` // oom_kill, segfault, hung_task, io_error or fs_readonly
+	Timestamp time.Time         `json:"timestamp"`
+	Process   string            `json:"process,omitempty"` // Victim or faulting process
+	PID       int32             `json:"pid,omitempty"`
+	Device    string            `json:"device,omitempty"`
+	Details   map[string]string `json:"details,omitempty"`
+	Message   string            `json:"message"` // Raw kernel log line
+}
@@ -1,5 +1,7 @@
 package models
 
+import "time"
+
 type ProcessStatus struct {
 	PID        int32   `json:"pid"`
 	Name       string  `json:"name"`
@@ -7,3 +9,17 @@ type ProcessStatus struct {
 	MemPercent float32 `json:"mem_percent"`
 	Status     string  `json:"status"`
 }
+
+// ProcessEvent records a process appearing or exiting between collector ticks
+type ProcessEvent struct {
+	Type            string    `json:"type"` // "process_started" or "process_exited"
+	Timestamp       time.Time `json:"timestamp"`
+	PID             int32     `json:"pid"`
+	Name            string    `json:"name"`
+	StartedAt       time.Time `json:"started_at,omitempty"`
+	LifetimeSeconds float64   `json:"lifetime_seconds,omitempty"` // Exits only
+	CPUPercent      float32   `json:"cpu_percent"`                // Last observed values
+	MemPercent      float32   `json:"mem_percent"`
+	Status          string    `json:"status"`
+	Zombie          bool      `json:"zombie,omitempty"` // Exited but not yet reaped by its parent
+}
@@ -0,0 +1,17 @@
+package models
+
+import "time"
+
+// QueueStats describes an outbound queue that buffers data while its remote is unreachable
+type QueueStats struct {
+	Name      string     `json:"name"`
+	Depth     int        `json:"depth"`     // Entries waiting to be sent
+	InMemory  int        `json:"in_memory"` // Waiting entries not written to disk
+	Bytes     int64      `json:"bytes"`     // Size of the waiting entries
+	MaxBytes  int64      `json:"max_bytes"` // Oldest entries are dropped beyond this
+	Enqueued  uint64     `json:"enqueued"`  // Since the agent started
+	Sent      uint64     `json:"sent"`      // Since the agent started
+	Dropped   uint64     `json:"dropped"`   // Evicted to stay under MaxBytes, since the agent started
+	OldestAt  *time.Time `json:"oldest_at,omitempty"`
+	Directory string     `json:"directory"`
+}
@@ -0,0 +1,14 @@
+package routes
+
+import (
+	"chowkidar/internal/controllers"
+	"chowkidar/internal/middleware"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RegisterCheckRoutes registers the check result endpoints
+func RegisterCheckRoutes(r gin.IRouter) {
+	r.GET("/checks", middleware.RateLimit(middleware.RateLimitMetrics), middleware.AuthMiddleware(), controllers.GetChecks)
+	r.GET("/checks/:name", middleware.RateLimit(middleware.RateLimitMetrics), middleware.AuthMiddleware(), controllers.GetCheck)
+}
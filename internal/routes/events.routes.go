@@ -0,0 +1,14 @@
+package routes
+
+import (
+	"chowkidar/internal/controllers"
+	"chowkidar/internal/middleware"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RegisterEventRoutes registers the agent event bus endpoints
+func RegisterEventRoutes(r gin.IRouter) {
+	r.GET("/events", middleware.RateLimit(middleware.RateLimitMetrics), middleware.AuthMiddleware(), controllers.GetEvents)
+	r.GET("/kernel/events", middleware.RateLimit(middleware.RateLimitMetrics), middleware.AuthMiddleware(), controllers.GetKernelEvents)
+}
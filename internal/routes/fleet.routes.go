@@ -0,0 +1,20 @@
+package routes
+
+import (
+	"chowkidar/internal/controllers"
+	"chowkidar/internal/middleware"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RegisterFleetRoutes registers the hub-mode endpoints for managing and reading agents
+func RegisterFleetRoutes(r gin.IRouter) {
+	fleet := r.Group("/fleet", middleware.RateLimit(middleware.RateLimitMetrics), middleware.AuthMiddleware())
+	{
+		fleet.GET("/servers", controllers.GetFleetServers)                   // Registered agents and connection state
+		fleet.POST("/servers", controllers.AddFleetServer)                   // Register an agent
+		fleet.DELETE("/servers/:name", controllers.DeleteFleetServer)        // Unregister an agent
+		fleet.GET("/metrics", controllers.GetFleetMetrics)                   // Latest stats from every agent
+		fleet.GET("/servers/:name/api/*path", controllers.GetFleetServerAPI) // Forward a GET to an agent's API
+	}
+}
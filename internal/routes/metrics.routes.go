@@ -9,8 +9,8 @@ import (
 
 // RegisterMonitorRoutes registers all system metrics endpoints
 // These endpoints provide real-time and historical system statistics
-func RegisterMonitorRoutes(r *gin.Engine) {
-	metrics := r.Group("/metrics", middleware.AuthMiddleware())
+func RegisterMonitorRoutes(r gin.IRouter) {
+	metrics := r.Group("/metrics", middleware.RateLimit(middleware.RateLimitMetrics), middleware.AuthMiddleware())
 	{
 		metrics.GET("/", controllers.GetStatus)                              // System status summary
 		metrics.GET("/cpu", controllers.GetCPU)                              // Current CPU metrics
@@ -20,10 +20,20 @@ func RegisterMonitorRoutes(r *gin.Engine) {
 		metrics.GET("/disk", controllers.GetDisk)                            // Disk I/O and usage
 		metrics.GET("/network", controllers.GetNetwork)                      // Network bandwidth
 		metrics.GET("/network/aggregated", controllers.GetAggregatedNetwork) // Total network stats
-		metrics.GET("/history", controllers.GetMetricHistory)                // Historical data
-		metrics.GET("/history/all", controllers.GetAllHistory)               // Complete history
+		metrics.GET("/queues", controllers.GetQueues)                        // Outbound queue depth and drops
+		metrics.GET("/custom", controllers.GetCustomMetrics)                 // Application metrics (StatsD, API)
+		metrics.POST("/custom", controllers.PostCustomMetrics)               // Report application metrics
+		metrics.GET("/collectors", controllers.GetCollectors)                // Registered collectors and their last run
+		metrics.GET("/collectors/:name", controllers.GetCollectorSamples)    // Latest samples of one collector
 	}
 
-	// Dashboard main endpoint
-	r.GET("/dashboard", middleware.AuthMiddleware(), controllers.GetDashboard)
+	// History endpoints are heavier and get their own rate limit policy
+	history := r.Group("/metrics/history", middleware.RateLimit(middleware.RateLimitHistory), middleware.AuthMiddleware())
+	{
+		history.GET("", controllers.GetMetricHistory)  // Historical data
+		history.GET("/all", controllers.GetAllHistory) // Complete history
+	}
+
+	// Dashboard main endpoint (current values + history)
+	r.GET("/dashboard", middleware.RateLimit(middleware.RateLimitHistory), middleware.AuthMiddleware(), controllers.GetDashboard)
 }
@@ -8,10 +8,11 @@ import (
 )
 
 // RegisterProcessRoutes registers process monitoring endpoints
-func RegisterProcessRoutes(r *gin.Engine) {
-	processes := r.Group("/processes", middleware.AuthMiddleware())
+func RegisterProcessRoutes(r gin.IRouter) {
+	processes := r.Group("/processes", middleware.RateLimit(middleware.RateLimitMetrics), middleware.AuthMiddleware())
 	{
 		processes.GET("/", controllers.GetTopProcesses)        // Top processes by resource usage
 		processes.GET("/status", controllers.GetProcessStatus) // Detailed process information
+		processes.GET("/events", controllers.GetProcessEvents) // Process start/exit history
 	}
 }
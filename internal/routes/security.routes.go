@@ -0,0 +1,20 @@
+package routes
+
+import (
+	"chowkidar/internal/controllers"
+	"chowkidar/internal/middleware"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RegisterSecurityRoutes registers endpoints for managing the agent's security state
+func RegisterSecurityRoutes(r gin.IRouter) {
+	security := r.Group("/security", middleware.RateLimit(middleware.RateLimitAuth), middleware.AuthMiddleware())
+	{
+		security.GET("/bans", controllers.GetBans)          // Active lockout bans
+		security.DELETE("/bans/:ip", controllers.DeleteBan) // Lift a ban
+	}
+
+	// Structured security audit log
+	r.GET("/audit", middleware.RateLimit(middleware.RateLimitAuth), middleware.AuthMiddleware(), controllers.GetAuditEvents)
+}
@@ -0,0 +1,242 @@
+package services
+
+import (
+	"chowkidar/internal/models"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// AlertRule fires a threshold_crossed event when a metric crosses a threshold,
+// written as "<metric><op><threshold>", e.g. "cpu>90" or "disk>=95"
+type AlertRule struct {
+	Metric    string
+	Operator  string // ">", ">=", "<" or "<="
+	Threshold float64
+}
+
+// String returns the rule in its config syntax
+func (r AlertRule) String() string {
+	return fmt.Sprintf("%s%s%g", r.Metric, r.Operator, r.Threshold)
+}
+
+// Matches reports whether a value is on the alerting side of the threshold
+func (r AlertRule) Matches(value float64) bool {
+	switch r.Operator {
+	case ">":
+		return value > r.Threshold
+	case ">=":
+		return value >= r.Threshold
+	case "<":
+		return value < r.Threshold
+	case "<=":
+		return value <= r.Threshold
+	}
+	return false
+}
+
+// ParseAlertRules parses a comma-separated list of rules. Commas inside braces
+// belong to a custom series name, e.g. "custom:jobs.failed{env=prod,job=backup}>0".
+func ParseAlertRules(spec string) ([]AlertRule, error) {
+	var rules []AlertRule
+	for _, part := range splitAlertRules(spec) {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		idx := strings.IndexAny(part, "<>")
+		if idx <= 0 {
+			return nil, fmt.Errorf("invalid alert rule %q (expected e.g. cpu>90)", part)
+		}
+		op := part[idx : idx+1]
+		rest := part[idx+1:]
+		if strings.HasPrefix(rest, "=") {
+			op += "="
+			rest = rest[1:]
+		}
+
+		threshold, err := strconv.ParseFloat(strings.TrimSpace(rest), 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid threshold in alert rule %q", part)
+		}
+		metric := strings.TrimSpace(part[:idx])
+		if !KnownMetric(metric) {
+			return nil, fmt.Errorf("unknown metric %q in alert rule %q", metric, part)
+		}
+		rules = append(rules, AlertRule{Metric: metric, Operator: op, Threshold: threshold})
+	}
+	return rules, nil
+}
+
+// splitAlertRules splits a rule list on commas that are not inside braces
+func splitAlertRules(spec string) []string {
+	var parts []string
+	depth, start := 0, 0
+	for i, r := range spec {
+		switch r {
+		case '{':
+			depth++
+		case '}':
+			if depth > 0 {
+				depth--
+			}
+		case ',':
+			if depth == 0 {
+				parts = append(parts, spec[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(parts, spec[start:])
+}
+
+// Metric sources for alerting. Built-in gauges are registered by name; families of
+// metrics (e.g. "custom:<name>") are resolved by prefix.
+var metricRegistry = struct {
+	sync.RWMutex
+	gauges   map[string]func() (float64, bool)
+	prefixes map[string]func(name string) (float64, bool)
+}{
+	gauges: map[string]func() (float64, bool){
+		"cpu": func() (float64, bool) {
+			cpu, err := GetCachedCPU()
+			if err != nil {
+				return 0, false
+			}
+			return cpu.UsagePercent, true
+		},
+		"memory": func() (float64, bool) {
+			memory, err := GetCachedMemory()
+			if err != nil {
+				return 0, false
+			}
+			return memory.UsagePercent, true
+		},
+		"disk": func() (float64, bool) {
+			disk, err := GetCachedDisk()
+			if err != nil {
+				return 0, false
+			}
+			return disk.UsagePercent, true
+		},
+	},
+	prefixes: map[string]func(name string) (float64, bool){},
+}
+
+// RegisterMetric makes a named gauge available to alert rules
+func RegisterMetric(name string, value func() (float64, bool)) {
+	metricRegistry.Lock()
+	defer metricRegistry.Unlock()
+	metricRegistry.gauges[name] = value
+}
+
+// RegisterMetricPrefix resolves every metric named "<prefix><name>" through one function
+func RegisterMetricPrefix(prefix string, value func(name string) (float64, bool)) {
+	metricRegistry.Lock()
+	defer metricRegistry.Unlock()
+	metricRegistry.prefixes[prefix] = value
+}
+
+// KnownMetric reports whether a metric name can be resolved
+func KnownMetric(name string) bool {
+	metricRegistry.RLock()
+	defer metricRegistry.RUnlock()
+	if _, ok := metricRegistry.gauges[name]; ok {
+		return true
+	}
+	for prefix := range metricRegistry.prefixes {
+		if strings.HasPrefix(name, prefix) && len(name) > len(prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// MetricValue returns the current value of a named metric
+func MetricValue(name string) (float64, bool) {
+	metricRegistry.RLock()
+	gauge, ok := metricRegistry.gauges[name]
+	var resolver func(string) (float64, bool)
+	if !ok {
+		for prefix, fn := range metricRegistry.prefixes {
+			if strings.HasPrefix(name, prefix) {
+				resolver = fn
+				break
+			}
+		}
+	}
+	metricRegistry.RUnlock()
+
+	if gauge != nil {
+		return gauge()
+	}
+	if resolver != nil {
+		return resolver(name)
+	}
+	return 0, false
+}
+
+// StartAlertEvaluator checks CHOWKIDAR_ALERT_RULES every CHOWKIDAR_ALERT_INTERVAL
+// (default 10s) and publishes threshold_crossed when a rule starts or stops firing
+func StartAlertEvaluator() error {
+	rules, err := ParseAlertRules(os.Getenv("CHOWKIDAR_ALERT_RULES"))
+	if err != nil {
+		return err
+	}
+	if len(rules) == 0 {
+		return nil
+	}
+	interval := durationFromEnv("CHOWKIDAR_ALERT_INTERVAL", 10*time.Second)
+
+	go func() {
+		firing := make([]bool, len(rules))
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			for i, rule := range rules {
+				value, ok := MetricValue(rule.Metric)
+				if !ok {
+					continue
+				}
+				matches := rule.Matches(value)
+				if matches == firing[i] {
+					continue
+				}
+				firing[i] = matches
+				publishThreshold(rule, value, matches)
+			}
+		}
+	}()
+
+	log.Printf("Alert evaluator started (%d rules, interval: %v)", len(rules), interval)
+	return nil
+}
+
+// publishThreshold publishes a rule's transition to firing or resolved
+func publishThreshold(rule AlertRule, value float64, firing bool) {
+	state, severity := "resolved", models.SeverityInfo
+	if firing {
+		state, severity = "firing", models.SeverityWarning
+	}
+
+	PublishEvent(models.Event{
+		Type:     models.EventThresholdCrossed,
+		Severity: severity,
+		Source:   "alerts",
+		Message:  fmt.Sprintf("%s %s (value: %.2f)", rule, state, value),
+		Attributes: map[string]interface{}{
+			"rule":      rule.String(),
+			"metric":    rule.Metric,
+			"operator":  rule.Operator,
+			"threshold": rule.Threshold,
+			"value":     value,
+			"state":     state,
+		},
+	})
+}
@@ -0,0 +1,286 @@
+package services
+
+import (
+	"bufio"
+	"chowkidar/internal/models"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Audit event outcomes
+const (
+	AuditSuccess = "success"
+	AuditFailure = "failure"
+	AuditDenied  = "denied"
+)
+
+// AuditLog writes security events as JSON lines with size-based rotation
+type AuditLog struct {
+	mu         sync.Mutex
+	path       string
+	file       *os.File
+	size       int64
+	maxBytes   int64 // Rotate once the active file would exceed this size
+	maxBackups int   // Rotated files kept as path.1 (newest) ... path.N (oldest)
+}
+
+var auditLog *AuditLog
+
+// InitAuditLog opens the audit log. Settings come from CHOWKIDAR_AUDIT_LOG,
+// CHOWKIDAR_AUDIT_MAX_SIZE_MB and CHOWKIDAR_AUDIT_MAX_BACKUPS.
+func InitAuditLog(path string) (*AuditLog, error) {
+	if path == "" {
+		path = strings.TrimSpace(os.Getenv("CHOWKIDAR_AUDIT_LOG"))
+	}
+	if path == "" {
+		path = defaultStateFile("audit.log")
+	}
+
+	maxMB := intFromEnv("CHOWKIDAR_AUDIT_MAX_SIZE_MB", 10)
+	maxBackups := intFromEnv("CHOWKIDAR_AUDIT_MAX_BACKUPS", 5)
+
+	al := &AuditLog{
+		path:       path,
+		maxBytes:   int64(maxMB) * 1024 * 1024,
+		maxBackups: maxBackups,
+	}
+	if err := al.open(); err != nil {
+		return nil, err
+	}
+
+	auditLog = al
+	auditSubscribeOnce.Do(func() {
+		OnEvent(recordAuditEvent, models.EventAuthFailed, models.EventClientConnected, models.EventClientDisconnected)
+	})
+	return al, nil
+}
+
+var auditSubscribeOnce sync.Once
+
+// recordAuditEvent writes security-relevant bus events to the audit log,
+// keeping the audit event names used before the event bus existed
+func recordAuditEvent(event models.Event) {
+	attr := func(key string) string {
+		value, _ := event.Attributes[key].(string)
+		return value
+	}
+
+	audit := models.AuditEvent{
+		Timestamp: event.Timestamp,
+		IP:        attr("ip"),
+	}
+	switch event.Type {
+	case models.EventAuthFailed:
+		audit.Type = "auth_failed"
+		audit.Outcome = AuditFailure
+		audit.Reason = attr("reason")
+	case models.EventClientConnected:
+		audit.Type = attr("transport") + "_connected"
+		audit.Outcome = AuditSuccess
+		audit.TokenID = attr("token_jti")
+		audit.ServerName = attr("server_name")
+	case models.EventClientDisconnected:
+		audit.Type = attr("transport") + "_disconnected"
+		audit.Outcome = AuditSuccess
+		audit.Details = map[string]string{"client_id": attr("client_id")}
+	default:
+		return
+	}
+	RecordAudit(audit)
+}
+
+// GetAuditLog returns the initialized audit log
+func GetAuditLog() *AuditLog {
+	return auditLog
+}
+
+// RecordAudit appends an event to the audit log. A no-op if the log is not initialized.
+func RecordAudit(event models.AuditEvent) {
+	al := auditLog
+	if al == nil {
+		return
+	}
+	if event.Timestamp.IsZero() {
+		event.Timestamp = time.Now().UTC()
+	}
+
+	line, err := json.Marshal(event)
+	if err != nil {
+		log.Printf("[AUDIT] Error marshaling event: %v", err)
+		return
+	}
+	line = append(line, '\n')
+
+	al.mu.Lock()
+	defer al.mu.Unlock()
+
+	if al.file == nil {
+		return
+	}
+	if al.maxBytes > 0 && al.size+int64(len(line)) > al.maxBytes && al.size > 0 {
+		if err := al.rotate(); err != nil {
+			log.Printf("[AUDIT] Rotation failed: %v", err)
+		}
+	}
+
+	n, err := al.file.Write(line)
+	al.size += int64(n)
+	if err != nil {
+		log.Printf("[AUDIT] Write failed: %v", err)
+	}
+}
+
+// QueryAudit returns matching events in chronological order, keeping the newest when limited
+func QueryAudit(filter models.AuditFilter) ([]models.AuditEvent, error) {
+	al := auditLog
+	if al == nil {
+		return nil, fmt.Errorf("audit log not initialized")
+	}
+
+	types := map[string]bool{}
+	for _, t := range filter.Types {
+		types[t] = true
+	}
+
+	al.mu.Lock()
+	files := []string{}
+	for i := al.maxBackups; i >= 1; i-- {
+		files = append(files, al.backupPath(i))
+	}
+	files = append(files, al.path)
+	al.mu.Unlock()
+
+	// With a limit, only the newest matches are kept in a ring, so memory stays
+	// bounded however large the rotated files are
+	events := []models.AuditEvent{}
+	head := 0
+	for _, name := range files {
+		f, err := os.Open(name)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		scanner := bufio.NewScanner(f)
+		scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+		for scanner.Scan() {
+			var event models.AuditEvent
+			if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+				continue
+			}
+			if !filter.Since.IsZero() && event.Timestamp.Before(filter.Since) {
+				continue
+			}
+			if !filter.Until.IsZero() && event.Timestamp.After(filter.Until) {
+				continue
+			}
+			if len(types) > 0 && !types[event.Type] {
+				continue
+			}
+			if filter.IP != "" && event.IP != filter.IP {
+				continue
+			}
+			if filter.Limit > 0 && len(events) == filter.Limit {
+				events[head] = event
+				head = (head + 1) % filter.Limit
+				continue
+			}
+			events = append(events, event)
+		}
+		err = scanner.Err()
+		f.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if head > 0 {
+		ordered := make([]models.AuditEvent, 0, len(events))
+		ordered = append(ordered, events[head:]...)
+		events = append(ordered, events[:head]...)
+	}
+	return events, nil
+}
+
+// CloseAuditLog flushes and closes the audit log
+func CloseAuditLog() {
+	al := auditLog
+	if al == nil {
+		return
+	}
+	al.mu.Lock()
+	defer al.mu.Unlock()
+	if al.file != nil {
+		al.file.Close()
+		al.file = nil
+	}
+}
+
+// open opens the active file for appending. Caller must hold al.mu (or own al exclusively).
+func (al *AuditLog) open() error {
+	if err := os.MkdirAll(filepath.Dir(al.path), 0700); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(al.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	al.file = f
+	al.size = info.Size()
+	return nil
+}
+
+// rotate shifts path -> path.1 -> ... -> path.N and reopens an empty file. Caller must hold al.mu.
+func (al *AuditLog) rotate() error {
+	if al.file != nil {
+		al.file.Close()
+		al.file = nil
+	}
+
+	if al.maxBackups > 0 {
+		os.Remove(al.backupPath(al.maxBackups))
+		for i := al.maxBackups - 1; i >= 1; i-- {
+			os.Rename(al.backupPath(i), al.backupPath(i+1))
+		}
+		if err := os.Rename(al.path, al.backupPath(1)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	} else {
+		os.Remove(al.path)
+	}
+
+	return al.open()
+}
+
+// backupPath returns the path of the n-th rotated file
+func (al *AuditLog) backupPath(n int) string {
+	return al.path + "." + strconv.Itoa(n)
+}
+
+// intFromEnv reads a non-negative integer from an environment variable, falling back on parse errors
+func intFromEnv(name string, fallback int) int {
+	value := strings.TrimSpace(os.Getenv(name))
+	if value == "" {
+		return fallback
+	}
+	parsed, err := strconv.Atoi(value)
+	if err != nil || parsed < 0 {
+		log.Printf("⚠️  Invalid %s=%q, using %d", name, value, fallback)
+		return fallback
+	}
+	return parsed
+}
@@ -0,0 +1,199 @@
+package services
+
+import (
+	"chowkidar/internal/models"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+var auditStart = time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// auditEvent returns the n-th test event; all of them marshal to the same length
+func auditEvent(n int) models.AuditEvent {
+	ip := "203.0.113.1"
+	if n%2 == 0 {
+		ip = "203.0.113.2"
+	}
+	return models.AuditEvent{
+		Timestamp: auditStart.Add(time.Duration(n) * time.Minute),
+		Type:      "event_" + strconv.Itoa(n),
+		Outcome:   AuditFailure,
+		IP:        ip,
+	}
+}
+
+// newTestAuditLog installs an audit log in a temp dir that rotates after
+// perFile test events and keeps backups rotated files
+func newTestAuditLog(t *testing.T, perFile int, backups int) *AuditLog {
+	t.Helper()
+	line, err := json.Marshal(auditEvent(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	al := &AuditLog{
+		path:       filepath.Join(t.TempDir(), "audit.log"),
+		maxBytes:   int64(perFile * (len(line) + 1)),
+		maxBackups: backups,
+	}
+	if err := al.open(); err != nil {
+		t.Fatal(err)
+	}
+
+	previous := auditLog
+	auditLog = al
+	t.Cleanup(func() {
+		CloseAuditLog()
+		auditLog = previous
+	})
+	return al
+}
+
+// auditTypes returns the types of the events, in order
+func auditTypes(events []models.AuditEvent) []string {
+	types := []string{}
+	for _, event := range events {
+		types = append(types, event.Type)
+	}
+	return types
+}
+
+// auditFileTypes returns the types of the events in an audit file, nil if it does not exist
+func auditFileTypes(t *testing.T, path string) []string {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	events := []models.AuditEvent{}
+	for _, line := range strings.Split(strings.TrimSuffix(string(data), "\n"), "\n") {
+		var event models.AuditEvent
+		if err := json.Unmarshal([]byte(line), &event); err != nil {
+			t.Fatalf("%s: %v", path, err)
+		}
+		events = append(events, event)
+	}
+	return auditTypes(events)
+}
+
+func TestAuditRotation(t *testing.T) {
+	al := newTestAuditLog(t, 2, 2)
+	for n := 1; n <= 7; n++ {
+		RecordAudit(auditEvent(n))
+	}
+
+	files := map[string][]string{
+		al.path:          {"event_7"},
+		al.backupPath(1): {"event_5", "event_6"},
+		al.backupPath(2): {"event_3", "event_4"},
+		al.backupPath(3): nil, // Oldest file dropped
+	}
+	for path, want := range files {
+		if got := auditFileTypes(t, path); !reflect.DeepEqual(got, want) {
+			t.Errorf("%s = %v, want %v", filepath.Base(path), got, want)
+		}
+	}
+
+	// Reopening picks up the active file's size, so the next event still rotates on time
+	CloseAuditLog()
+	if err := al.open(); err != nil {
+		t.Fatal(err)
+	}
+	RecordAudit(auditEvent(8))
+	RecordAudit(auditEvent(9))
+	if got, want := auditFileTypes(t, al.path), []string{"event_9"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("after reopening, audit.log = %v, want %v", got, want)
+	}
+	if got, want := auditFileTypes(t, al.backupPath(1)), []string{"event_7", "event_8"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("after reopening, audit.log.1 = %v, want %v", got, want)
+	}
+}
+
+func TestAuditRotationWithoutBackups(t *testing.T) {
+	al := newTestAuditLog(t, 2, 0)
+	for n := 1; n <= 3; n++ {
+		RecordAudit(auditEvent(n))
+	}
+	if got, want := auditFileTypes(t, al.path), []string{"event_3"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("audit.log = %v, want %v", got, want)
+	}
+	if _, err := os.Stat(al.backupPath(1)); !os.IsNotExist(err) {
+		t.Errorf("audit.log.1 exists with no backups configured: %v", err)
+	}
+}
+
+func TestQueryAudit(t *testing.T) {
+	newTestAuditLog(t, 2, 5)
+	for n := 1; n <= 9; n++ {
+		RecordAudit(auditEvent(n))
+	}
+
+	tests := []struct {
+		name   string
+		filter models.AuditFilter
+		want   []string
+	}{
+		{
+			name:   "all, across rotated files",
+			filter: models.AuditFilter{},
+			want:   []string{"event_1", "event_2", "event_3", "event_4", "event_5", "event_6", "event_7", "event_8", "event_9"},
+		},
+		{
+			name:   "limit keeps the newest",
+			filter: models.AuditFilter{Limit: 3},
+			want:   []string{"event_7", "event_8", "event_9"},
+		},
+		{
+			name:   "limit larger than matches",
+			filter: models.AuditFilter{Limit: 20, IP: "203.0.113.2"},
+			want:   []string{"event_2", "event_4", "event_6", "event_8"},
+		},
+		{
+			name:   "limit with filter",
+			filter: models.AuditFilter{Limit: 2, IP: "203.0.113.1"},
+			want:   []string{"event_7", "event_9"},
+		},
+		{
+			name:   "limit equal to matches",
+			filter: models.AuditFilter{Limit: 4, IP: "203.0.113.2"},
+			want:   []string{"event_2", "event_4", "event_6", "event_8"},
+		},
+		{
+			name: "time range",
+			filter: models.AuditFilter{
+				Since: auditStart.Add(3 * time.Minute),
+				Until: auditStart.Add(5 * time.Minute),
+			},
+			want: []string{"event_3", "event_4", "event_5"},
+		},
+		{
+			name:   "types",
+			filter: models.AuditFilter{Types: []string{"event_2", "event_9", "missing"}},
+			want:   []string{"event_2", "event_9"},
+		},
+		{
+			name:   "no matches",
+			filter: models.AuditFilter{IP: "198.51.100.1", Limit: 5},
+			want:   []string{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			events, err := QueryAudit(tt.filter)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := auditTypes(events); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("QueryAudit = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
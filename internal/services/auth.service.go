@@ -152,6 +152,12 @@ func GenerateToken(serverName string) (string, error) {
 	now := time.Now()
 	expiresAt := now.Add(authService.tokenExpiry)
 
+	// Unique token ID (jti) so audit events can be tied to a specific token
+	idBytes := make([]byte, 16)
+	if _, err := rand.Read(idBytes); err != nil {
+		return "", err
+	}
+
 	claims := CustomClaims{
 		ServerName: serverName,
 		UserAgent:  "chowkidar-agent",
@@ -160,6 +166,7 @@ func GenerateToken(serverName string) (string, error) {
 			IssuedAt:  jwt.NewNumericDate(now),
 			NotBefore: jwt.NewNumericDate(now),
 			Issuer:    "chowkidar-server",
+			ID:        hex.EncodeToString(idBytes),
 		},
 	}
 
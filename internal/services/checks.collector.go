@@ -0,0 +1,24 @@
+package services
+
+import (
+	"chowkidar/internal/models"
+	"time"
+)
+
+// checksCollectorName is also the WebSocket topic and series prefix of check results
+const checksCollectorName = "checks"
+
+// checksCollector reports the latest results of the configured checks
+type checksCollector struct{}
+
+func init() {
+	RegisterCollector(checksCollector{})
+}
+
+func (checksCollector) Name() string            { return checksCollectorName }
+func (checksCollector) Description() string     { return "Check states, durations and perfdata" }
+func (checksCollector) Interval() time.Duration { return 10 * time.Second }
+
+func (checksCollector) Collect() ([]models.Sample, error) {
+	return checkSamples(), nil
+}
@@ -0,0 +1,497 @@
+package services
+
+import (
+	"bytes"
+	"chowkidar/internal/models"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// checkWaitDelay is how long a finished or killed check may hold its output
+// pipes open (e.g. through a background child) before they are closed
+const checkWaitDelay = time.Second
+
+// ErrCheckNotFound is returned for unknown check names
+var ErrCheckNotFound = errors.New("check not found")
+
+// CheckRunner runs the checks from CHOWKIDAR_CHECKS_FILE (Nagios-compatible
+// commands and synthetic probes), each on its own interval, at most Concurrency at a time
+type CheckRunner struct {
+	Path        string
+	Concurrency int
+	OutputMax   int // Bytes of stdout kept per run
+
+	slots  chan struct{}
+	checks []*scheduledCheck // Sorted by name
+}
+
+// scheduledCheck is one configured check and its latest result
+type scheduledCheck struct {
+	config   models.CheckConfig
+	interval time.Duration
+	timeout  time.Duration
+
+	// Synthetic checks (see synthetic.service.go); probe is nil for exec checks
+	probe       func(ctx context.Context) (int, string, []models.PerfData)
+	warnLatency time.Duration
+	critLatency time.Duration
+	bodyPattern *regexp.Regexp
+	client      *http.Client
+	resolver    *net.Resolver
+
+	mu     sync.RWMutex
+	result models.CheckResult
+}
+
+var checkRunner *CheckRunner
+
+// StartChecks loads CHOWKIDAR_CHECKS_FILE when set and the checks collector is
+// enabled, then schedules every check. Defaults come from CHOWKIDAR_CHECK_INTERVAL
+// (1m), CHOWKIDAR_CHECK_TIMEOUT (10s), CHOWKIDAR_CHECK_CONCURRENCY (4) and
+// CHOWKIDAR_CHECK_OUTPUT_MAX (8192 bytes).
+func StartChecks() (*CheckRunner, error) {
+	path := strings.TrimSpace(os.Getenv("CHOWKIDAR_CHECKS_FILE"))
+	if path == "" || !CollectorEnabled(checksCollectorName) {
+		return nil, nil
+	}
+
+	runner := &CheckRunner{
+		Path:        path,
+		Concurrency: intFromEnv("CHOWKIDAR_CHECK_CONCURRENCY", 4),
+		OutputMax:   intFromEnv("CHOWKIDAR_CHECK_OUTPUT_MAX", 8192),
+	}
+	if runner.Concurrency < 1 {
+		runner.Concurrency = 1
+	}
+	checks, err := loadChecks(path,
+		durationFromEnv("CHOWKIDAR_CHECK_INTERVAL", time.Minute),
+		durationFromEnv("CHOWKIDAR_CHECK_TIMEOUT", 10*time.Second))
+	if err != nil {
+		return nil, err
+	}
+	runner.checks = checks
+	runner.slots = make(chan struct{}, runner.Concurrency)
+
+	for _, check := range checks {
+		go runner.schedule(check)
+	}
+	checkRunner = runner
+	return runner, nil
+}
+
+// Checks returns how many checks are scheduled
+func (r *CheckRunner) Checks() int {
+	return len(r.checks)
+}
+
+// loadChecks reads and validates the checks file
+func loadChecks(path string, interval, timeout time.Duration) ([]*scheduledCheck, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var file models.ChecksFile
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&file); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	checks := make([]*scheduledCheck, 0, len(file.Checks))
+	seen := map[string]bool{}
+	for _, config := range file.Checks {
+		if err := validateCustomName(config.Name, nil); err != nil {
+			return nil, fmt.Errorf("check %q: %v", config.Name, err)
+		}
+		if seen[config.Name] {
+			return nil, fmt.Errorf("check %q defined twice", config.Name)
+		}
+		seen[config.Name] = true
+
+		check := &scheduledCheck{config: config, interval: interval, timeout: timeout}
+		if err := configureCheck(check); err != nil {
+			return nil, fmt.Errorf("check %q: %v", config.Name, err)
+		}
+		if config.Interval != "" {
+			if check.interval, err = time.ParseDuration(config.Interval); err != nil || check.interval < MinCollectorInterval {
+				return nil, fmt.Errorf("check %q: interval must be a duration of at least %s", config.Name, MinCollectorInterval)
+			}
+		}
+		if config.Timeout != "" {
+			if check.timeout, err = time.ParseDuration(config.Timeout); err != nil || check.timeout <= 0 {
+				return nil, fmt.Errorf("check %q: invalid timeout %q", config.Name, config.Timeout)
+			}
+		}
+		check.result = models.CheckResult{
+			Name:     config.Name,
+			Type:     check.config.Type,
+			Command:  config.Command,
+			Interval: check.interval.String(),
+			Timeout:  check.timeout.String(),
+			State:    models.CheckPending,
+		}
+		if check.probe != nil {
+			check.result.Target = checkTarget(check.config)
+		}
+		checks = append(checks, check)
+	}
+	sort.Slice(checks, func(i, j int) bool {
+		return checks[i].config.Name < checks[j].config.Name
+	})
+	return checks, nil
+}
+
+// schedule runs a check right away and then on every interval; a check never
+// overlaps itself and waits for a free slot when Concurrency checks are running
+func (r *CheckRunner) schedule(check *scheduledCheck) {
+	ticker := time.NewTicker(check.interval)
+	defer ticker.Stop()
+	for {
+		r.slots <- struct{}{}
+		r.run(check)
+		<-r.slots
+		<-ticker.C
+	}
+}
+
+// run executes a check once, stores the result and publishes state changes
+func (r *CheckRunner) run(check *scheduledCheck) {
+	start := time.Now()
+	var code int
+	var text, long string
+	var perfData []models.PerfData
+	truncated := false
+	if check.probe != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), check.timeout)
+		code, text, perfData = check.probe(ctx)
+		cancel()
+	} else {
+		var output string
+		code, output, truncated = r.execute(check)
+		text, long, perfData = parseCheckOutput(output)
+	}
+	state := models.CheckUnknown
+	if code >= 0 && code < len(models.CheckStates) {
+		state = models.CheckStates[code]
+	} else if text == "" {
+		text = fmt.Sprintf("UNKNOWN - exit code %d is out of bounds", code)
+	}
+
+	check.mu.Lock()
+	previous := check.result.State
+	result := &check.result
+	result.State = state
+	if check.probe == nil {
+		result.ExitCode = &code
+	}
+	result.Output = text
+	result.LongOutput = long
+	result.PerfData = perfData
+	result.Truncated = truncated
+	result.LastRun = &start
+	result.Duration = time.Since(start).Round(time.Millisecond).String()
+	if previous != state {
+		result.LastStateChange = &start
+	}
+	snapshot := *result
+	check.mu.Unlock()
+
+	if previous != state && (previous != models.CheckPending || state != models.CheckOK) {
+		publishCheckStateChange(snapshot, previous)
+	}
+}
+
+// execute runs the check command and returns its exit code and stdout (stderr
+// when stdout is empty). Timeouts and start failures are reported as UNKNOWN.
+func (r *CheckRunner) execute(check *scheduledCheck) (int, string, bool) {
+	ctx, cancel := context.WithTimeout(context.Background(), check.timeout)
+	defer cancel()
+
+	command := check.config.Command
+	cmd := exec.CommandContext(ctx, command[0], command[1:]...)
+	stdout := &cappedBuffer{max: r.OutputMax}
+	stderr := &cappedBuffer{max: r.OutputMax}
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	cmd.WaitDelay = checkWaitDelay
+	setProcessGroup(cmd)
+
+	err := cmd.Run()
+	if ctx.Err() == context.DeadlineExceeded {
+		return 3, fmt.Sprintf("UNKNOWN - check timed out after %s", check.timeout), false
+	}
+
+	code := 0
+	var exitErr *exec.ExitError
+	switch {
+	case errors.As(err, &exitErr):
+		code = exitErr.ExitCode()
+	case errors.Is(err, exec.ErrWaitDelay):
+		code = cmd.ProcessState.ExitCode()
+	case err != nil:
+		return 3, "UNKNOWN - " + err.Error(), false
+	}
+
+	output := stdout
+	if strings.TrimSpace(stdout.buf.String()) == "" {
+		output = stderr
+	}
+	return code, strings.ToValidUTF8(output.buf.String(), "�"), output.truncated
+}
+
+// cappedBuffer keeps the first max bytes written to it and discards the rest
+type cappedBuffer struct {
+	buf       bytes.Buffer
+	max       int
+	truncated bool
+}
+
+func (b *cappedBuffer) Write(p []byte) (int, error) {
+	if room := b.max - b.buf.Len(); len(p) > room {
+		b.truncated = true
+		if room > 0 {
+			b.buf.Write(p[:room])
+		}
+		return len(p), nil
+	}
+	return b.buf.Write(p)
+}
+
+// parseCheckOutput splits plugin output per the Nagios plugin API: the first
+// line is "TEXT | PERFDATA", further lines are long output, and perfdata may
+// continue after a "|" in the long output
+func parseCheckOutput(output string) (string, string, []models.PerfData) {
+	lines := strings.Split(strings.TrimRight(output, "\r\n"), "\n")
+	text, perfSpec, _ := strings.Cut(lines[0], "|")
+	specs := []string{perfSpec}
+
+	long := []string{}
+	inPerfData := false
+	for _, line := range lines[1:] {
+		line = strings.TrimRight(line, "\r")
+		if inPerfData {
+			specs = append(specs, line)
+			continue
+		}
+		if before, after, found := strings.Cut(line, "|"); found {
+			long = append(long, before)
+			specs = append(specs, after)
+			inPerfData = true
+			continue
+		}
+		long = append(long, line)
+	}
+
+	perfData := []models.PerfData{}
+	for _, spec := range specs {
+		perfData = append(perfData, parsePerfData(spec)...)
+	}
+	return strings.TrimSpace(text), strings.TrimSpace(strings.Join(long, "\n")), perfData
+}
+
+// parsePerfData parses space-separated 'label'=value[UOM];[warn];[crit];[min];[max]
+// entries. Entries that cannot be parsed, or whose value is "U" or not finite, are skipped.
+func parsePerfData(spec string) []models.PerfData {
+	perfData := []models.PerfData{}
+	for {
+		spec = strings.TrimLeft(spec, " \t")
+		if spec == "" {
+			return perfData
+		}
+
+		var label string
+		if spec[0] == '\'' {
+			// Quoted label; '' is a literal quote
+			end := 1
+			for end < len(spec) {
+				if spec[end] == '\'' {
+					if end+1 < len(spec) && spec[end+1] == '\'' {
+						end += 2
+						continue
+					}
+					break
+				}
+				end++
+			}
+			if end >= len(spec) {
+				return perfData
+			}
+			label = strings.ReplaceAll(spec[1:end], "''", "'")
+			spec = spec[end+1:]
+		} else {
+			end := strings.IndexAny(spec, "= \t")
+			if end < 0 {
+				return perfData
+			}
+			label = spec[:end]
+			spec = spec[end:]
+		}
+
+		value := spec
+		if end := strings.IndexAny(spec, " \t"); end >= 0 {
+			value, spec = spec[:end], spec[end:]
+		} else {
+			spec = ""
+		}
+		if !strings.HasPrefix(value, "=") || label == "" {
+			continue
+		}
+		if entry, ok := parsePerfValue(label, value[1:]); ok {
+			perfData = append(perfData, entry)
+		}
+	}
+}
+
+// parsePerfValue parses "value[UOM];warn;crit;min;max"
+func parsePerfValue(label, raw string) (models.PerfData, bool) {
+	fields := strings.Split(raw, ";")
+	number := strings.TrimRight(fields[0], "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ%")
+	value, err := strconv.ParseFloat(number, 64)
+	if err != nil || !finite(value) { // "U", and NaN or ±Inf that JSON cannot carry
+		return models.PerfData{}, false
+	}
+
+	entry := models.PerfData{Label: label, Value: value, Unit: fields[0][len(number):]}
+	if len(fields) > 1 {
+		entry.Warn = fields[1]
+	}
+	if len(fields) > 2 {
+		entry.Crit = fields[2]
+	}
+	if len(fields) > 3 {
+		if min, err := strconv.ParseFloat(fields[3], 64); err == nil && finite(min) {
+			entry.Min = &min
+		}
+	}
+	if len(fields) > 4 {
+		if max, err := strconv.ParseFloat(fields[4], 64); err == nil && finite(max) {
+			entry.Max = &max
+		}
+	}
+	return entry, true
+}
+
+// publishCheckStateChange publishes a check_state_changed event
+func publishCheckStateChange(result models.CheckResult, previous string) {
+	severity := models.SeverityWarning
+	switch result.State {
+	case models.CheckOK:
+		severity = models.SeverityInfo
+	case models.CheckCritical:
+		severity = models.SeverityCritical
+	}
+	PublishEvent(models.Event{
+		Type:     models.EventCheckStateChanged,
+		Severity: severity,
+		Source:   "checks",
+		Message:  fmt.Sprintf("%s is %s (was %s): %s", result.Name, result.State, previous, result.Output),
+		Attributes: map[string]interface{}{
+			"check":          result.Name,
+			"state":          result.State,
+			"previous_state": previous,
+			"output":         result.Output,
+		},
+	})
+}
+
+// GetChecks returns every check's latest result, sorted by name
+func GetChecks() []models.CheckResult {
+	results := []models.CheckResult{}
+	if checkRunner == nil {
+		return results
+	}
+	for _, check := range checkRunner.checks {
+		check.mu.RLock()
+		results = append(results, check.result)
+		check.mu.RUnlock()
+	}
+	return results
+}
+
+// GetCheck returns one check's latest result
+func GetCheck(name string) (models.CheckResult, error) {
+	for _, result := range GetChecks() {
+		if result.Name == name {
+			return result, nil
+		}
+	}
+	return models.CheckResult{}, ErrCheckNotFound
+}
+
+// perfDataUnits converts byte and time perfdata to base units
+var perfDataUnits = map[string]struct {
+	unit  string
+	scale float64
+}{
+	"":   {"1", 1},
+	"%":  {"%", 1},
+	"s":  {"s", 1},
+	"ms": {"s", 1e-3},
+	"us": {"s", 1e-6},
+	"B":  {"By", 1},
+	"KB": {"By", 1 << 10},
+	"MB": {"By", 1 << 20},
+	"GB": {"By", 1 << 30},
+	"TB": {"By", 1 << 40},
+}
+
+// checkSamples turns the latest results into samples: each check's state
+// (0 OK, 1 WARNING, 2 CRITICAL, 3 UNKNOWN), run duration and perfdata values
+func checkSamples() []models.Sample {
+	samples := []models.Sample{}
+	for _, result := range GetChecks() {
+		if result.LastRun == nil {
+			continue
+		}
+		labels := map[string]string{"check": result.Name}
+		state := 3
+		for i, name := range models.CheckStates {
+			if name == result.State {
+				state = i
+			}
+		}
+		samples = append(samples, models.Sample{Name: "state", Kind: models.SampleGauge, Unit: "1", Labels: labels, Value: float64(state)})
+		if duration, err := time.ParseDuration(result.Duration); err == nil {
+			samples = append(samples, models.Sample{Name: "duration_seconds", Kind: models.SampleGauge, Unit: "s", Labels: labels, Value: duration.Seconds()})
+		}
+
+		for _, perf := range result.PerfData {
+			sample := models.Sample{
+				Name:   "perfdata",
+				Kind:   models.SampleGauge,
+				Unit:   perf.Unit,
+				Labels: map[string]string{"check": result.Name, "label": perfDataLabel(perf.Label)},
+				Value:  perf.Value,
+			}
+			if perf.Unit == "c" {
+				sample.Kind, sample.Unit = models.SampleCounter, "1"
+			} else if unit, known := perfDataUnits[perf.Unit]; known {
+				sample.Unit, sample.Value = unit.unit, perf.Value*unit.scale
+			}
+			samples = append(samples, sample)
+		}
+	}
+	return samples
+}
+
+// perfDataLabel replaces characters that cannot appear in a series label value
+func perfDataLabel(label string) string {
+	return strings.Map(func(r rune) rune {
+		if strings.ContainsRune("{},<>\r\n", r) {
+			return '_'
+		}
+		return r
+	}, label)
+}
@@ -0,0 +1,51 @@
+package services
+
+import (
+	"chowkidar/internal/models"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestExecuteKillsProcessGroup(t *testing.T) {
+	pidFile := filepath.Join(t.TempDir(), "pid")
+	check := &scheduledCheck{
+		config:  models.CheckConfig{Command: []string{"/bin/sh", "-c", "sleep 30 & echo $! > " + pidFile + "; wait"}},
+		timeout: 200 * time.Millisecond,
+	}
+	runner := &CheckRunner{OutputMax: 1024}
+
+	start := time.Now()
+	code, output, _ := runner.execute(check)
+	if code != 3 || !strings.Contains(output, "timed out") {
+		t.Fatalf("execute() = %d %q, want UNKNOWN timeout", code, output)
+	}
+	if elapsed := time.Since(start); elapsed >= checkWaitDelay {
+		t.Errorf("execute() took %s; the background child held the output open", elapsed)
+	}
+
+	data, err := os.ReadFile(pidFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Killed children may linger as zombies until reaped
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		stat, err := os.ReadFile("/proc/" + strconv.Itoa(pid) + "/stat")
+		if err != nil {
+			return
+		}
+		if fields := strings.Fields(string(stat)); len(fields) > 2 && fields[2] == "Z" {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Errorf("background child %d survived the timeout", pid)
+}
@@ -0,0 +1,81 @@
+package services
+
+import (
+	"chowkidar/internal/models"
+	"reflect"
+	"testing"
+)
+
+func TestParseCheckOutput(t *testing.T) {
+	tests := []struct {
+		name     string
+		output   string
+		text     string
+		long     string
+		perfData []string // Labels
+	}{
+		{name: "text only", output: "DISK OK\n", text: "DISK OK"},
+		{name: "perfdata", output: "DISK OK - free space: / 3326 MB | /=2643MB;5948;5958;0;5968", text: "DISK OK - free space: / 3326 MB", perfData: []string{"/"}},
+		{
+			name:   "long output",
+			output: "DISK OK | /=2643MB\n/ 15272 MB (77%);\n/boot 68 MB (69%);\r\n",
+			text:   "DISK OK", long: "/ 15272 MB (77%);\n/boot 68 MB (69%);", perfData: []string{"/"},
+		},
+		{
+			name:   "perfdata continues in long output",
+			output: "DISK OK | /=2643MB\n/ 15272 MB (77%);\n/boot 68 MB (69%); | /boot=68MB\n/home=69357MB\n/var/log=819MB",
+			text:   "DISK OK", long: "/ 15272 MB (77%);\n/boot 68 MB (69%);", perfData: []string{"/", "/boot", "/home", "/var/log"},
+		},
+		{name: "empty", output: "", text: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			text, long, perfData := parseCheckOutput(tt.output)
+			if text != tt.text || long != tt.long {
+				t.Errorf("parseCheckOutput(%q) = %q, %q, want %q, %q", tt.output, text, long, tt.text, tt.long)
+			}
+			labels := []string{}
+			for _, entry := range perfData {
+				labels = append(labels, entry.Label)
+			}
+			if len(tt.perfData) == 0 {
+				tt.perfData = []string{}
+			}
+			if !reflect.DeepEqual(labels, tt.perfData) {
+				t.Errorf("parseCheckOutput(%q) perfdata labels = %q, want %q", tt.output, labels, tt.perfData)
+			}
+		})
+	}
+}
+
+func TestParsePerfData(t *testing.T) {
+	float := func(v float64) *float64 { return &v }
+	tests := []struct {
+		spec string
+		want []models.PerfData
+	}{
+		{spec: "", want: []models.PerfData{}},
+		{spec: "time=0.012s", want: []models.PerfData{{Label: "time", Value: 0.012, Unit: "s"}}},
+		{
+			spec: "load1=0.42;4;8;0 load5=1;;;0;16",
+			want: []models.PerfData{
+				{Label: "load1", Value: 0.42, Warn: "4", Crit: "8", Min: float(0)},
+				{Label: "load5", Value: 1, Min: float(0), Max: float(16)},
+			},
+		},
+		{spec: "'free space'=85%;@10:20;~:5", want: []models.PerfData{{Label: "free space", Value: 85, Unit: "%", Warn: "@10:20", Crit: "~:5"}}},
+		{spec: "'it''s'=1c", want: []models.PerfData{{Label: "it's", Value: 1, Unit: "c"}}},
+		{spec: "  a=1\tb=-2.5KB ", want: []models.PerfData{{Label: "a", Value: 1}, {Label: "b", Value: -2.5, Unit: "KB"}}},
+		{spec: "users=U;5;10 ok=1", want: []models.PerfData{{Label: "ok", Value: 1}}},                       // Unknown value
+		{spec: "load=nan x=inf y=-Infinity z=1e999 ok=2", want: []models.PerfData{{Label: "ok", Value: 2}}}, // Not finite
+		{spec: "range=1;;;-inf;NaN", want: []models.PerfData{{Label: "range", Value: 1}}},
+		{spec: "junk a=1 =2 b=x", want: []models.PerfData{{Label: "a", Value: 1}}}, // Missing "=", label or number
+		{spec: "'unterminated=1", want: []models.PerfData{}},                       // Quote never closed
+		{spec: "min=1;;;x;y", want: []models.PerfData{{Label: "min", Value: 1}}},   // Bad min and max are dropped
+	}
+	for _, tt := range tests {
+		if got := parsePerfData(tt.spec); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parsePerfData(%q) = %+v, want %+v", tt.spec, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,8 @@
+//go:build windows
+
+package services
+
+import "os/exec"
+
+// setProcessGroup is a no-op on Windows: a timed-out check is killed on its own
+func setProcessGroup(cmd *exec.Cmd) {}
@@ -0,0 +1,280 @@
+package services
+
+import (
+	"chowkidar/internal/models"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MinCollectorInterval is the shortest schedule a collector may run on
+const MinCollectorInterval = time.Second
+
+// Collector errors
+var (
+	ErrCollectorNotFound = errors.New("collector not found")
+	ErrCollectorDisabled = errors.New("collector disabled")
+)
+
+// Collector produces samples on a schedule. Each collector lives in its own
+// <name>.collector.go file and registers itself from init(). The registry feeds
+// its samples to /metrics/collectors, history, alert rules (as "<name>.<sample>"),
+// the WebSocket stats message and the outputs.
+type Collector interface {
+	// Name is unique; it is also the collector's WebSocket topic and series prefix
+	Name() string
+	Description() string
+	// Interval is the default schedule (CHOWKIDAR_COLLECTOR_INTERVALS overrides it)
+	Interval() time.Duration
+	Collect() ([]models.Sample, error)
+}
+
+// collectorEntry is a registered collector, its settings and its last run
+type collectorEntry struct {
+	collector Collector
+	enabled   bool
+	interval  time.Duration
+
+	mu       sync.RWMutex
+	samples  []models.Sample
+	lastRun  time.Time
+	duration time.Duration
+	err      error
+}
+
+var collectorRegistry = struct {
+	sync.RWMutex
+	entries map[string]*collectorEntry
+}{entries: map[string]*collectorEntry{}}
+
+// RegisterCollector adds a collector to the registry; call it from init().
+// Every collector is also a WebSocket stats topic.
+func RegisterCollector(c Collector) {
+	collectorRegistry.Lock()
+	defer collectorRegistry.Unlock()
+
+	name := c.Name()
+	if _, exists := collectorRegistry.entries[name]; exists {
+		panic("collector " + name + " registered twice")
+	}
+	collectorRegistry.entries[name] = &collectorEntry{collector: c, enabled: true, interval: c.Interval()}
+	validTopics[name] = true
+	statsTopics = append(statsTopics, name)
+}
+
+// StartCollectors applies CHOWKIDAR_COLLECTORS (run only these),
+// CHOWKIDAR_DISABLE_COLLECTORS and CHOWKIDAR_COLLECTOR_INTERVALS ("load=30s,disk=1m"),
+// then runs every enabled collector on its interval. It returns the enabled names.
+func StartCollectors() ([]string, error) {
+	only, err := collectorNames("CHOWKIDAR_COLLECTORS")
+	if err != nil {
+		return nil, err
+	}
+	disabled, err := collectorNames("CHOWKIDAR_DISABLE_COLLECTORS")
+	if err != nil {
+		return nil, err
+	}
+	intervals, err := collectorIntervals(os.Getenv("CHOWKIDAR_COLLECTOR_INTERVALS"))
+	if err != nil {
+		return nil, err
+	}
+
+	collectorRegistry.Lock()
+	defer collectorRegistry.Unlock()
+
+	names := []string{}
+	for _, name := range sortedCollectorNames() {
+		entry := collectorRegistry.entries[name]
+		entry.enabled = (len(only) == 0 || only[name]) && !disabled[name]
+		if interval, exists := intervals[name]; exists {
+			entry.interval = interval
+		}
+		if !entry.enabled {
+			continue
+		}
+		RegisterMetricPrefix(name+".", collectorMetricValue)
+		go entry.run(name)
+		names = append(names, name)
+	}
+	return names, nil
+}
+
+// run collects right away and then on every interval
+func (e *collectorEntry) run(name string) {
+	ticker := time.NewTicker(e.interval)
+	defer ticker.Stop()
+	for {
+		start := time.Now()
+		samples, err := e.collector.Collect()
+
+		e.mu.Lock()
+		if err == nil {
+			e.samples = samples
+		}
+		e.err = err
+		e.lastRun = start
+		e.duration = time.Since(start)
+		e.mu.Unlock()
+
+		if err != nil {
+			ReportCollectorError(name, err)
+		} else {
+			ReportCollectorOK(name)
+		}
+		<-ticker.C
+	}
+}
+
+// CollectorEnabled reports whether a collector is enabled. Names that are not
+// collectors (e.g. the alerts topic) are always enabled.
+func CollectorEnabled(name string) bool {
+	collectorRegistry.RLock()
+	defer collectorRegistry.RUnlock()
+	entry, exists := collectorRegistry.entries[name]
+	return !exists || entry.enabled
+}
+
+// CollectorStatuses describes every registered collector, sorted by name
+func CollectorStatuses() []models.CollectorStatus {
+	collectorRegistry.RLock()
+	defer collectorRegistry.RUnlock()
+
+	statuses := []models.CollectorStatus{}
+	for _, name := range sortedCollectorNames() {
+		entry := collectorRegistry.entries[name]
+		status := models.CollectorStatus{
+			Name:        name,
+			Description: entry.collector.Description(),
+			Enabled:     entry.enabled,
+			Interval:    entry.interval.String(),
+		}
+		entry.mu.RLock()
+		if !entry.lastRun.IsZero() {
+			lastRun := entry.lastRun
+			status.LastRun = &lastRun
+			status.Duration = entry.duration.Round(time.Microsecond).String()
+			status.Samples = len(entry.samples)
+		}
+		if entry.err != nil {
+			status.Error = entry.err.Error()
+		}
+		entry.mu.RUnlock()
+		statuses = append(statuses, status)
+	}
+	return statuses
+}
+
+// CollectorSamples returns a collector's latest samples and when they were taken
+func CollectorSamples(name string) ([]models.Sample, time.Time, error) {
+	collectorRegistry.RLock()
+	entry, exists := collectorRegistry.entries[name]
+	collectorRegistry.RUnlock()
+	if !exists {
+		return nil, time.Time{}, ErrCollectorNotFound
+	}
+	if !entry.enabled {
+		return nil, time.Time{}, ErrCollectorDisabled
+	}
+
+	entry.mu.RLock()
+	defer entry.mu.RUnlock()
+	return entry.samples, entry.lastRun, nil
+}
+
+// latestCollectorSamples returns the latest samples of every enabled collector
+func latestCollectorSamples() map[string][]models.Sample {
+	collectorRegistry.RLock()
+	defer collectorRegistry.RUnlock()
+
+	result := map[string][]models.Sample{}
+	for name, entry := range collectorRegistry.entries {
+		if !entry.enabled {
+			continue
+		}
+		entry.mu.RLock()
+		if len(entry.samples) > 0 {
+			result[name] = entry.samples
+		}
+		entry.mu.RUnlock()
+	}
+	return result
+}
+
+// CollectorSeriesName names a sample's history series, e.g. "load.load1" or
+// "network.bytes_sent{interface=eth0}"
+func CollectorSeriesName(collector string, sample models.Sample) string {
+	return CustomSeriesName(collector+"."+sample.Name, sample.Labels)
+}
+
+// collectorMetricValue resolves "<collector>.<series>" to the latest sample for alert rules
+func collectorMetricValue(name string) (float64, bool) {
+	collector, _, _ := strings.Cut(name, ".")
+	samples, _, err := CollectorSamples(collector)
+	if err != nil {
+		return 0, false
+	}
+	for _, sample := range samples {
+		if CollectorSeriesName(collector, sample) == name {
+			return sample.Value, true
+		}
+	}
+	return 0, false
+}
+
+// sortedCollectorNames returns registered names in order (caller holds the registry lock)
+func sortedCollectorNames() []string {
+	names := make([]string, 0, len(collectorRegistry.entries))
+	for name := range collectorRegistry.entries {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// collectorNames parses a comma-separated list of registered collector names
+func collectorNames(variable string) (map[string]bool, error) {
+	names := map[string]bool{}
+	for _, name := range strings.Split(os.Getenv(variable), ",") {
+		if name = strings.TrimSpace(name); name == "" {
+			continue
+		}
+		if !registeredCollector(name) {
+			return nil, fmt.Errorf("unknown collector %q in %s", name, variable)
+		}
+		names[name] = true
+	}
+	return names, nil
+}
+
+// collectorIntervals parses "name=duration" pairs
+func collectorIntervals(spec string) (map[string]time.Duration, error) {
+	intervals := map[string]time.Duration{}
+	for _, pair := range strings.Split(spec, ",") {
+		if pair = strings.TrimSpace(pair); pair == "" {
+			continue
+		}
+		name, raw, ok := strings.Cut(pair, "=")
+		name = strings.TrimSpace(name)
+		if !ok || !registeredCollector(name) {
+			return nil, fmt.Errorf("invalid CHOWKIDAR_COLLECTOR_INTERVALS entry %q (expected collector=duration)", pair)
+		}
+		interval, err := time.ParseDuration(strings.TrimSpace(raw))
+		if err != nil || interval < MinCollectorInterval {
+			return nil, fmt.Errorf("invalid interval for collector %s: must be a duration of at least %s", name, MinCollectorInterval)
+		}
+		intervals[name] = interval
+	}
+	return intervals, nil
+}
+
+// registeredCollector reports whether a collector name is known
+func registeredCollector(name string) bool {
+	collectorRegistry.RLock()
+	defer collectorRegistry.RUnlock()
+	_, exists := collectorRegistry.entries[name]
+	return exists
+}
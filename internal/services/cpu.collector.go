@@ -0,0 +1,41 @@
+package services
+
+import (
+	"chowkidar/internal/models"
+	"strconv"
+	"time"
+)
+
+// cpuCollector reports total and per-core CPU usage
+type cpuCollector struct{}
+
+func init() {
+	RegisterCollector(cpuCollector{})
+}
+
+func (cpuCollector) Name() string            { return TopicCPU }
+func (cpuCollector) Description() string     { return "CPU usage, in total and per core" }
+func (cpuCollector) Interval() time.Duration { return 10 * time.Second }
+
+// Collect reads the shared CPU cache, so it does not reset the usage baseline of other readers
+func (cpuCollector) Collect() ([]models.Sample, error) {
+	cpu, err := GetCachedCPU()
+	if err != nil {
+		return nil, err
+	}
+
+	samples := []models.Sample{
+		{Name: "usage_percent", Kind: models.SampleGauge, Unit: "%", Value: cpu.UsagePercent},
+		{Name: "cores", Kind: models.SampleGauge, Unit: "1", Value: float64(cpu.CoreCount)},
+	}
+	for i, usage := range cpu.PerCore {
+		samples = append(samples, models.Sample{
+			Name:   "core_usage_percent",
+			Kind:   models.SampleGauge,
+			Unit:   "%",
+			Labels: map[string]string{"core": strconv.Itoa(i)},
+			Value:  usage,
+		})
+	}
+	return samples, nil
+}
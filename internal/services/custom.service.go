@@ -0,0 +1,129 @@
+package services
+
+import (
+	"chowkidar/internal/models"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Custom metric limits
+const (
+	maxCustomNameLength = 200
+	maxCustomFutureSkew = 5 * time.Minute
+)
+
+// ErrInvalidCustomMetric marks a rejected custom metric value
+var ErrInvalidCustomMetric = errors.New("invalid custom metric")
+
+// customIngestMu serializes counter ingestion (API and StatsD) so increments are not lost
+var customIngestMu sync.Mutex
+
+// IngestCustomMetrics validates and stores application metrics posted over the API.
+// Gauges are stored as given; a counter's value is added to the series' current
+// total, so counter values cannot be backfilled before the series' latest value.
+// Nothing is stored if any value is invalid. Returns how many were accepted.
+func IngestCustomMetrics(metrics []models.CustomMetric) (int, error) {
+	now := time.Now()
+	latest := map[string]models.CustomMetric{} // Latest value per series, including this batch
+	for i := range metrics {
+		metric := &metrics[i]
+		if metric.Type == "" {
+			metric.Type = "gauge"
+		}
+		if metric.Timestamp.IsZero() {
+			metric.Timestamp = now
+		}
+
+		var err error
+		switch {
+		case metric.Type != "gauge" && metric.Type != "counter":
+			err = fmt.Errorf("type must be gauge or counter, got %q", metric.Type)
+		case metric.Timestamp.Before(now.Add(-seriesRetention)):
+			err = fmt.Errorf("timestamp is older than %s", seriesRetention)
+		case metric.Timestamp.After(now.Add(maxCustomFutureSkew)):
+			err = fmt.Errorf("timestamp is more than %s in the future", maxCustomFutureSkew)
+		case metric.Type == "counter" && metric.Value < 0:
+			err = errors.New("counter increments must not be negative")
+		default:
+			err = validateCustomName(metric.Name, metric.Tags)
+		}
+		if err == nil {
+			metric.Name = CustomSeriesName(metric.Name, metric.Tags)
+			previous, exists := latest[metric.Name]
+			if !exists {
+				previous, exists = customSeriesLatest(metric.Name)
+			}
+			switch {
+			case !exists:
+			case previous.Type != metric.Type:
+				err = fmt.Errorf("series %s is a %s, not a %s", metric.Name, previous.Type, metric.Type)
+			case metric.Type == "counter" && metric.Timestamp.Before(previous.Timestamp):
+				err = fmt.Errorf("counter %s has a value at %s; increments cannot be backfilled before it",
+					metric.Name, previous.Timestamp.Format(time.RFC3339))
+			}
+			if !exists || !metric.Timestamp.Before(previous.Timestamp) {
+				latest[metric.Name] = *metric
+			}
+		}
+		if err != nil {
+			return 0, fmt.Errorf("%w: metrics[%d]: %v", ErrInvalidCustomMetric, i, err)
+		}
+	}
+
+	accepted := recordCustomIncrements(metrics)
+	publishCustomMetrics(metrics, now)
+	return accepted, nil
+}
+
+// recordCustomIncrements turns counter increments into their series' running
+// totals, in place, and stores the metrics. Returns how many were accepted.
+func recordCustomIncrements(metrics []models.CustomMetric) int {
+	customIngestMu.Lock()
+	defer customIngestMu.Unlock()
+
+	totals := map[string]float64{}
+	for i := range metrics {
+		metric := &metrics[i]
+		if metric.Type != "counter" {
+			continue
+		}
+		total, seen := totals[metric.Name]
+		if !seen {
+			total, _ = customMetricValue(CustomMetricPrefix + metric.Name)
+		}
+		total += metric.Value
+		totals[metric.Name] = total
+		metric.Value = total
+	}
+	return RecordCustomMetrics(metrics)
+}
+
+// publishCustomMetrics pushes new custom values to WebSocket clients on the custom topic
+func publishCustomMetrics(metrics []models.CustomMetric, at time.Time) {
+	if hub := GetWebSocketHub(); hub != nil && len(metrics) > 0 {
+		hub.PublishToTopic(TopicCustom, WebSocketMessage{Type: "custom_metrics", Timestamp: at, Data: metrics})
+	}
+}
+
+// validateCustomName checks a metric name and its tags, which together form the
+// series name (see CustomSeriesName)
+func validateCustomName(name string, tags map[string]string) error {
+	if name == "" || len(name) > maxCustomNameLength {
+		return fmt.Errorf("name must be 1-%d characters", maxCustomNameLength)
+	}
+	if strings.ContainsAny(name, "{},=:|# \t\r\n") {
+		return fmt.Errorf("name %q contains reserved characters", name)
+	}
+	for key, value := range tags {
+		if key == "" || strings.ContainsAny(key, "{},=:|# \t\r\n") {
+			return fmt.Errorf("label name %q is empty or contains reserved characters", key)
+		}
+		if strings.ContainsAny(value, "{},<>\r\n") {
+			return fmt.Errorf("label %s value %q contains reserved characters", key, value)
+		}
+	}
+	return nil
+}
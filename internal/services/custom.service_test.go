@@ -0,0 +1,157 @@
+package services
+
+import (
+	"chowkidar/internal/models"
+	"errors"
+	"math"
+	"testing"
+	"time"
+)
+
+// customSeriesPoints returns a copy of a custom series' points
+func customSeriesPoints(name string) []models.MetricSnapshot {
+	historyCollector.mu.RLock()
+	defer historyCollector.mu.RUnlock()
+	return append([]models.MetricSnapshot(nil), historyCollector.customHistory[name]...)
+}
+
+func TestRecordCustomMetricsKinds(t *testing.T) {
+	now := time.Now()
+	metrics := []models.CustomMetric{
+		{Name: "test.kinds.jobs", Type: "counter", Value: 2, Timestamp: now},
+		{Name: "test.kinds.jobs", Type: "counter", Value: 3, Timestamp: now},
+		{Name: "test.kinds.jobs", Type: "gauge", Value: 1, Timestamp: now},
+	}
+	if accepted := recordCustomIncrements(metrics); accepted != 2 {
+		t.Errorf("accepted %d, want 2 (the gauge clashes with the counter)", accepted)
+	}
+	if value, _ := customMetricValue(CustomMetricPrefix + "test.kinds.jobs"); value != 5 {
+		t.Errorf("counter total = %v, want 5", value)
+	}
+
+	_, err := IngestCustomMetrics([]models.CustomMetric{{Name: "test.kinds.jobs", Type: "gauge", Value: 1}})
+	if !errors.Is(err, ErrInvalidCustomMetric) {
+		t.Errorf("IngestCustomMetrics accepted a gauge for a counter series (error %v)", err)
+	}
+	_, err = IngestCustomMetrics([]models.CustomMetric{
+		{Name: "test.kinds.batch", Type: "gauge", Value: 1},
+		{Name: "test.kinds.batch", Type: "counter", Value: 1},
+	})
+	if !errors.Is(err, ErrInvalidCustomMetric) {
+		t.Errorf("IngestCustomMetrics accepted a gauge and a counter for one series in a batch (error %v)", err)
+	}
+}
+
+func TestRecordCustomMetricsNonFinite(t *testing.T) {
+	now := time.Now()
+	metrics := []models.CustomMetric{
+		{Name: "test.finite.total", Type: "counter", Value: math.MaxFloat64, Timestamp: now},
+		{Name: "test.finite.total", Type: "counter", Value: math.MaxFloat64, Timestamp: now}, // Overflows to +Inf
+		{Name: "test.finite.gauge", Type: "gauge", Value: math.NaN(), Timestamp: now},
+	}
+	if accepted := recordCustomIncrements(metrics); accepted != 1 {
+		t.Errorf("accepted %d, want 1 (the overflowed total and NaN are dropped)", accepted)
+	}
+	if value, _ := customMetricValue(CustomMetricPrefix + "test.finite.total"); value != math.MaxFloat64 {
+		t.Errorf("counter total = %v, want the last finite total", value)
+	}
+	if points := customSeriesPoints("test.finite.gauge"); len(points) != 0 {
+		t.Errorf("NaN gauge stored as %+v", points)
+	}
+}
+
+func TestIngestCustomCounterBackfill(t *testing.T) {
+	now := time.Now().Truncate(time.Second)
+	tests := []struct {
+		name    string
+		offset  time.Duration // From now
+		value   float64
+		wantErr bool
+		total   float64 // Latest value afterwards
+	}{
+		{name: "first", offset: -10 * time.Minute, value: 1, total: 1},
+		{name: "later", offset: -5 * time.Minute, value: 2, total: 3},
+		{name: "same time", offset: -5 * time.Minute, value: 1, total: 4},
+		{name: "backfilled", offset: -8 * time.Minute, value: 5, wantErr: true, total: 4},
+		{name: "now", value: 1, total: 5},
+	}
+	for _, tt := range tests {
+		_, err := IngestCustomMetrics([]models.CustomMetric{
+			{Name: "test.backfill", Type: "counter", Value: tt.value, Timestamp: now.Add(tt.offset)},
+		})
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: error = %v, want error %v", tt.name, err, tt.wantErr)
+		}
+		if total, _ := customMetricValue(CustomMetricPrefix + "test.backfill"); total != tt.total {
+			t.Errorf("%s: total = %v, want %v", tt.name, total, tt.total)
+		}
+	}
+
+	// Every stored point includes the increments before it
+	want := []float64{1, 3, 4, 5}
+	points := customSeriesPoints("test.backfill")
+	if len(points) != len(want) {
+		t.Fatalf("%d points, want %d: %+v", len(points), len(want), points)
+	}
+	for i, point := range points {
+		if point.Value != want[i] {
+			t.Errorf("point %d = %v, want %v", i, point.Value, want[i])
+		}
+	}
+
+	// Within a batch too
+	_, err := IngestCustomMetrics([]models.CustomMetric{
+		{Name: "test.backfill.batch", Type: "counter", Value: 1, Timestamp: now},
+		{Name: "test.backfill.batch", Type: "counter", Value: 1, Timestamp: now.Add(-time.Minute)},
+	})
+	if !errors.Is(err, ErrInvalidCustomMetric) {
+		t.Errorf("batch with a backfilled counter: error = %v, want ErrInvalidCustomMetric", err)
+	}
+}
+
+func TestRecordCustomMetricsOrderAndCap(t *testing.T) {
+	limit := historyCollector.maxCustomPoints
+	historyCollector.maxCustomPoints = 4
+	defer func() { historyCollector.maxCustomPoints = limit }()
+
+	base := time.Now().Add(-30 * time.Minute)
+	gauge := func(minute int, value float64) models.CustomMetric {
+		return models.CustomMetric{Name: "test.order", Type: "gauge", Value: value, Timestamp: base.Add(time.Duration(minute) * time.Minute)}
+	}
+	tests := []struct {
+		name   string
+		metric models.CustomMetric
+		want   []float64 // Point values, oldest first
+		latest float64
+	}{
+		{name: "first", metric: gauge(1, 1), want: []float64{1}, latest: 1},
+		{name: "append", metric: gauge(3, 3), want: []float64{1, 3}, latest: 3},
+		{name: "backfill", metric: gauge(2, 2), want: []float64{1, 2, 3}, latest: 3},
+		{name: "same time appends", metric: gauge(3, 4), want: []float64{1, 2, 3, 4}, latest: 4},
+		{name: "cap drops oldest", metric: gauge(5, 5), want: []float64{2, 3, 4, 5}, latest: 5},
+		{name: "backfill at cap", metric: gauge(0, 0), want: []float64{2, 3, 4, 5}, latest: 5},
+	}
+	for _, tt := range tests {
+		if accepted := RecordCustomMetrics([]models.CustomMetric{tt.metric}); accepted != 1 {
+			t.Errorf("%s: accepted %d, want 1", tt.name, accepted)
+		}
+		points := customSeriesPoints("test.order")
+		values := make([]float64, len(points))
+		for i, point := range points {
+			values[i] = point.Value
+		}
+		if len(values) != len(tt.want) {
+			t.Errorf("%s: points %v, want %v", tt.name, values, tt.want)
+			continue
+		}
+		for i := range values {
+			if values[i] != tt.want[i] {
+				t.Errorf("%s: points %v, want %v", tt.name, values, tt.want)
+				break
+			}
+		}
+		if latest, _ := customMetricValue(CustomMetricPrefix + "test.order"); latest != tt.latest {
+			t.Errorf("%s: latest = %v, want %v", tt.name, latest, tt.latest)
+		}
+	}
+}
@@ -0,0 +1,137 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+)
+
+// Stream modes for the periodic stats message
+const (
+	StreamModeFull  = "full"  // Every update is a complete "stats" payload
+	StreamModeDelta = "delta" // A "stats" snapshot, then "stats_delta" merge patches
+)
+
+// SetStreamMode switches the client between full and delta updates.
+// Switching to delta (or re-selecting it) starts with a fresh snapshot.
+func (c *ClientConnection) SetStreamMode(mode string) error {
+	if mode != StreamModeFull && mode != StreamModeDelta {
+		return fmt.Errorf("unknown mode %q (use %q or %q)", mode, StreamModeFull, StreamModeDelta)
+	}
+
+	c.subMu.Lock()
+	defer c.subMu.Unlock()
+	c.deltaMode = mode == StreamModeDelta
+	c.lastSnapshot = nil
+	return nil
+}
+
+// StreamMode returns the client's current stream mode
+func (c *ClientConnection) StreamMode() string {
+	c.subMu.Lock()
+	defer c.subMu.Unlock()
+	if c.deltaMode {
+		return StreamModeDelta
+	}
+	return StreamModeFull
+}
+
+// RequestResync makes the next update a full snapshot
+func (c *ClientConnection) RequestResync() {
+	c.subMu.Lock()
+	defer c.subMu.Unlock()
+	c.lastSnapshot = nil
+}
+
+// statsMessage wraps a payload for this client, numbering it and, in delta mode,
+// reducing it to a JSON merge patch (RFC 7386) against the last snapshot sent
+func (c *ClientConnection) statsMessage(payload *StatsPayload) WebSocketMessage {
+	c.subMu.Lock()
+	defer c.subMu.Unlock()
+
+	c.seq++
+	msg := WebSocketMessage{
+		Type:      "stats",
+		Timestamp: payload.Timestamp,
+		Seq:       c.seq,
+		Data:      payload,
+	}
+	if !c.deltaMode {
+		return msg
+	}
+
+	current, err := toGenericMap(payload)
+	if err != nil {
+		c.lastSnapshot = nil
+		return msg
+	}
+
+	if c.lastSnapshot == nil {
+		msg.Mode = StreamModeFull
+		c.lastSnapshot, c.snapshotSeq = current, c.seq
+		return msg
+	}
+
+	// Other numbered messages (e.g. replayed history) may sit between two stats updates
+	msg.Type = "stats_delta"
+	msg.BaseSeq = c.snapshotSeq
+	msg.Data = mergeDiff(c.lastSnapshot, current)
+	c.lastSnapshot, c.snapshotSeq = current, c.seq
+	return msg
+}
+
+// statsDropped is called when an update could not be queued. A delta client
+// has missed a patch, so it gets a full snapshot next time.
+func (c *ClientConnection) statsDropped() {
+	c.subMu.Lock()
+	defer c.subMu.Unlock()
+	c.lastSnapshot = nil
+}
+
+// toGenericMap converts a value to the map form it has on the wire
+func toGenericMap(v interface{}) (map[string]interface{}, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	generic := map[string]interface{}{}
+	if err := json.Unmarshal(data, &generic); err != nil {
+		return nil, err
+	}
+	return generic, nil
+}
+
+// mergeDiff builds a JSON merge patch turning old into new: nested objects are
+// diffed recursively, changed scalars and arrays are replaced, and removed keys are null
+func mergeDiff(old, new map[string]interface{}) map[string]interface{} {
+	patch := map[string]interface{}{}
+
+	for key, newValue := range new {
+		oldValue, exists := old[key]
+		if !exists {
+			patch[key] = newValue
+			continue
+		}
+
+		oldMap, oldIsMap := oldValue.(map[string]interface{})
+		newMap, newIsMap := newValue.(map[string]interface{})
+		if oldIsMap && newIsMap {
+			if sub := mergeDiff(oldMap, newMap); len(sub) > 0 {
+				patch[key] = sub
+			}
+			continue
+		}
+
+		if !reflect.DeepEqual(oldValue, newValue) {
+			patch[key] = newValue
+		}
+	}
+
+	for key := range old {
+		if _, exists := new[key]; !exists {
+			patch[key] = nil
+		}
+	}
+
+	return patch
+}
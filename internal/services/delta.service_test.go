@@ -0,0 +1,189 @@
+package services
+
+import (
+	"chowkidar/internal/models"
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// applyMergePatch applies a JSON merge patch (RFC 7386) the way a client would
+func applyMergePatch(target map[string]interface{}, patch map[string]interface{}) map[string]interface{} {
+	result := map[string]interface{}{}
+	for key, value := range target {
+		result[key] = value
+	}
+	for key, value := range patch {
+		if value == nil {
+			delete(result, key)
+			continue
+		}
+		patchMap, patchIsMap := value.(map[string]interface{})
+		targetMap, targetIsMap := result[key].(map[string]interface{})
+		if patchIsMap {
+			if !targetIsMap {
+				targetMap = map[string]interface{}{}
+			}
+			result[key] = applyMergePatch(targetMap, patchMap)
+			continue
+		}
+		result[key] = value
+	}
+	return result
+}
+
+// wireMessage round-trips a message through JSON, as a client receives it
+func wireMessage(t *testing.T, msg WebSocketMessage) (WebSocketMessage, map[string]interface{}) {
+	t.Helper()
+	data, err := json.Marshal(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var wire struct {
+		WebSocketMessage
+		Data map[string]interface{} `json:"data"`
+	}
+	if err := json.Unmarshal(data, &wire); err != nil {
+		t.Fatal(err)
+	}
+	return wire.WebSocketMessage, wire.Data
+}
+
+func TestStatsMessageDelta(t *testing.T) {
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	load := func(value float64) map[string][]models.Sample {
+		return map[string][]models.Sample{"load": {{Name: "load1", Kind: "gauge", Value: value}}}
+	}
+	processes := []models.ProcessStatus{{PID: 1, Name: "init"}, {PID: 42, Name: "nginx", CPUPercent: 3}}
+
+	steps := []struct {
+		name    string
+		payload StatsPayload
+		history bool // A replayed history message is numbered before this update
+		dropped bool // The previous update could not be queued
+		resync  bool // The client asked for a resync
+		full    bool // Expect a snapshot rather than a patch
+		patch   map[string]interface{}
+	}{
+		{
+			name:    "first update is a snapshot",
+			payload: StatsPayload{CPU: &models.CPUStatus{UsagePercent: 10, CoreCount: 4}, Memory: &models.MemoryStatus{UsagePercent: 50}, Processes: processes, Collectors: load(0.5)},
+			full:    true,
+		},
+		{
+			name:    "changed scalars only",
+			payload: StatsPayload{CPU: &models.CPUStatus{UsagePercent: 12, CoreCount: 4}, Memory: &models.MemoryStatus{UsagePercent: 50}, Processes: processes, Collectors: load(0.5)},
+			patch:   map[string]interface{}{"cpu": map[string]interface{}{"usage_percent": 12.0}},
+		},
+		{
+			name:    "removed keys become null and arrays are replaced",
+			payload: StatsPayload{CPU: &models.CPUStatus{UsagePercent: 12, CoreCount: 4}, Processes: processes[:1], Collectors: map[string][]models.Sample{"custom": {{Name: "queue", Kind: "gauge", Value: 3}}}},
+			patch: map[string]interface{}{
+				"memory":     nil,
+				"processes":  []interface{}{map[string]interface{}{"pid": 1.0, "name": "init", "cpu_percent": 0.0, "mem_percent": 0.0, "status": ""}},
+				"collectors": map[string]interface{}{"load": nil, "custom": []interface{}{map[string]interface{}{"name": "queue", "kind": "gauge", "value": 3.0}}},
+			},
+		},
+		{
+			name:    "base_seq skips interleaved history",
+			payload: StatsPayload{CPU: &models.CPUStatus{UsagePercent: 12, CoreCount: 4}, Memory: &models.MemoryStatus{UsagePercent: 60}, Processes: processes[:1], Collectors: load(0.7)},
+			history: true,
+			patch: map[string]interface{}{
+				"memory":     map[string]interface{}{"usage_percent": 60.0, "used_gb": 0.0, "total_gb": 0.0, "available_gb": 0.0},
+				"collectors": map[string]interface{}{"custom": nil, "load": []interface{}{map[string]interface{}{"name": "load1", "kind": "gauge", "value": 0.7}}},
+			},
+		},
+		{
+			name:    "unchanged",
+			payload: StatsPayload{CPU: &models.CPUStatus{UsagePercent: 12, CoreCount: 4}, Memory: &models.MemoryStatus{UsagePercent: 60}, Processes: processes[:1], Collectors: load(0.7)},
+			patch:   map[string]interface{}{},
+		},
+		{
+			name:    "resync after a dropped update",
+			payload: StatsPayload{CPU: &models.CPUStatus{UsagePercent: 20, CoreCount: 4}, Collectors: load(0.9)},
+			dropped: true,
+			full:    true,
+		},
+		{
+			name:    "patches resume after the resync",
+			payload: StatsPayload{CPU: &models.CPUStatus{UsagePercent: 25, CoreCount: 4}, Collectors: load(0.9)},
+			patch:   map[string]interface{}{"cpu": map[string]interface{}{"usage_percent": 25.0}},
+		},
+		{
+			name:    "requested resync",
+			payload: StatsPayload{CPU: &models.CPUStatus{UsagePercent: 25, CoreCount: 4}, Collectors: load(0.9)},
+			resync:  true,
+			full:    true,
+		},
+	}
+
+	client := &ClientConnection{}
+	if err := client.SetStreamMode(StreamModeDelta); err != nil {
+		t.Fatal(err)
+	}
+
+	var state map[string]interface{} // What the client has rebuilt
+	var stateSeq, lastSeq uint64
+	for i, step := range steps {
+		payload := step.payload
+		payload.Timestamp = start.Add(time.Duration(i) * time.Second)
+		if step.history {
+			client.nextSeq()
+			lastSeq++
+		}
+		if step.dropped {
+			client.statsMessage(&payload) // Built, then never delivered
+			client.statsDropped()
+			lastSeq++
+		}
+		if step.resync {
+			client.RequestResync()
+		}
+
+		msg, data := wireMessage(t, client.statsMessage(&payload))
+		lastSeq++
+		if msg.Seq != lastSeq {
+			t.Errorf("%s: seq %d, want %d", step.name, msg.Seq, lastSeq)
+		}
+
+		if step.full {
+			if msg.Type != "stats" || msg.Mode != StreamModeFull || msg.BaseSeq != 0 {
+				t.Errorf("%s: got %s (mode %q, base_seq %d), want a full stats snapshot", step.name, msg.Type, msg.Mode, msg.BaseSeq)
+			}
+			state = data
+		} else {
+			if msg.Type != "stats_delta" || msg.BaseSeq != stateSeq {
+				t.Errorf("%s: got %s on base_seq %d, want stats_delta on %d", step.name, msg.Type, msg.BaseSeq, stateSeq)
+			}
+			step.patch["timestamp"] = payload.Timestamp.Format(time.RFC3339)
+			if !reflect.DeepEqual(data, step.patch) {
+				t.Errorf("%s: patch = %v, want %v", step.name, data, step.patch)
+			}
+			state = applyMergePatch(state, data)
+		}
+		stateSeq = msg.Seq
+
+		full, err := toGenericMap(&payload)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(state, full) {
+			t.Errorf("%s: rebuilt state = %v, want %v", step.name, state, full)
+		}
+	}
+}
+
+func TestStatsMessageFullMode(t *testing.T) {
+	client := &ClientConnection{}
+	payload := &StatsPayload{CPU: &models.CPUStatus{UsagePercent: 10}, Timestamp: time.Now()}
+	for seq := uint64(1); seq <= 2; seq++ {
+		msg := client.statsMessage(payload)
+		if msg.Type != "stats" || msg.Mode != "" || msg.Seq != seq || msg.Data != payload {
+			t.Errorf("update %d: got %s (mode %q, seq %d), want the plain payload", seq, msg.Type, msg.Mode, msg.Seq)
+		}
+	}
+	if err := client.SetStreamMode("binary"); err == nil {
+		t.Error("unknown stream mode accepted")
+	}
+}
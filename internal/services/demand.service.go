@@ -0,0 +1,54 @@
+package services
+
+import (
+	"sync"
+	"time"
+)
+
+// DemandTTL is how long a collector stays in its fast mode after the last consumer read
+const DemandTTL = time.Minute
+
+// Demand tracks recent consumer interest in a collector, so the collector can run
+// at full rate only while someone is reading its data
+type Demand struct {
+	mu       sync.Mutex
+	lastSeen time.Time
+	ttl      time.Duration
+	wake     chan struct{}
+}
+
+// NewDemand creates a tracker that stays active for ttl after each Mark
+func NewDemand(ttl time.Duration) *Demand {
+	return &Demand{
+		ttl:  ttl,
+		wake: make(chan struct{}, 1),
+	}
+}
+
+// Mark records a read. The first read after an idle period wakes the collector.
+func (d *Demand) Mark() {
+	d.mu.Lock()
+	now := time.Now()
+	wasIdle := now.Sub(d.lastSeen) >= d.ttl
+	d.lastSeen = now
+	d.mu.Unlock()
+
+	if wasIdle {
+		select {
+		case d.wake <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// Active reports whether there was a read within the TTL
+func (d *Demand) Active() bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return time.Since(d.lastSeen) < d.ttl
+}
+
+// Wake receives a value when demand resumes after an idle period
+func (d *Demand) Wake() <-chan struct{} {
+	return d.wake
+}
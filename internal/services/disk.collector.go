@@ -0,0 +1,36 @@
+package services
+
+import (
+	"chowkidar/internal/models"
+	"time"
+)
+
+// diskCollector reports usage of every mounted filesystem
+type diskCollector struct{}
+
+func init() {
+	RegisterCollector(diskCollector{})
+}
+
+func (diskCollector) Name() string            { return TopicDisk }
+func (diskCollector) Description() string     { return "Filesystem usage, per mount point" }
+func (diskCollector) Interval() time.Duration { return 30 * time.Second }
+
+func (diskCollector) Collect() ([]models.Sample, error) {
+	disks, err := GetAllDiskUsage()
+	if err != nil {
+		return nil, err
+	}
+
+	samples := make([]models.Sample, 0, 4*len(disks))
+	for _, disk := range disks {
+		labels := map[string]string{"path": disk.Path, "fstype": disk.Filesystem}
+		samples = append(samples,
+			models.Sample{Name: "total_bytes", Kind: models.SampleGauge, Unit: "By", Labels: labels, Value: float64(int64(disk.TotalGB * GB))},
+			models.Sample{Name: "used_bytes", Kind: models.SampleGauge, Unit: "By", Labels: labels, Value: float64(int64(disk.UsedGB * GB))},
+			models.Sample{Name: "free_bytes", Kind: models.SampleGauge, Unit: "By", Labels: labels, Value: float64(int64(disk.FreeGB * GB))},
+			models.Sample{Name: "usage_percent", Kind: models.SampleGauge, Unit: "%", Labels: labels, Value: disk.UsagePercent},
+		)
+	}
+	return samples, nil
+}
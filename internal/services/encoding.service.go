@@ -0,0 +1,107 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+
+	"github.com/ugorji/go/codec"
+)
+
+// Wire encodings shared by the REST API and the WebSocket stream.
+// Binary encodings reuse the `json` struct tags of internal/models, so field
+// names and omitempty behave the same in every format.
+const (
+	EncodingJSON    = "json"
+	EncodingMsgPack = "msgpack"
+	EncodingCBOR    = "cbor"
+)
+
+// Content types for REST negotiation
+const (
+	MIMEMsgPack       = "application/msgpack"
+	MIMEMsgPackLegacy = "application/x-msgpack"
+	MIMECBOR          = "application/cbor"
+)
+
+// WebSocket subprotocols selecting a binary encoding; "chowkidar" is JSON
+const (
+	SubprotocolJSON    = "chowkidar"
+	SubprotocolMsgPack = "chowkidar.msgpack"
+	SubprotocolCBOR    = "chowkidar.cbor"
+)
+
+var (
+	msgpackHandle = &codec.MsgpackHandle{WriteExt: true} // time.Time as the msgpack timestamp extension
+	cborHandle    = &codec.CborHandle{}
+)
+
+func init() {
+	// Decode loose client messages into JSON-like maps
+	msgpackHandle.MapType = mapStringInterfaceType
+	msgpackHandle.RawToString = true
+	cborHandle.MapType = mapStringInterfaceType
+}
+
+var mapStringInterfaceType = reflect.TypeOf(map[string]interface{}(nil))
+
+// WebSocketSubprotocols lists the subprotocols the agent accepts, JSON first
+func WebSocketSubprotocols() []string {
+	return []string{SubprotocolJSON, SubprotocolMsgPack, SubprotocolCBOR}
+}
+
+// EncodingForSubprotocol maps a negotiated subprotocol to its encoding
+func EncodingForSubprotocol(subprotocol string) string {
+	switch subprotocol {
+	case SubprotocolMsgPack:
+		return EncodingMsgPack
+	case SubprotocolCBOR:
+		return EncodingCBOR
+	default:
+		return EncodingJSON
+	}
+}
+
+// EncodingForMIME maps a content type to its encoding
+func EncodingForMIME(mime string) string {
+	switch mime {
+	case MIMEMsgPack, MIMEMsgPackLegacy:
+		return EncodingMsgPack
+	case MIMECBOR:
+		return EncodingCBOR
+	default:
+		return EncodingJSON
+	}
+}
+
+// Encode serializes v in the given encoding
+func Encode(encoding string, v interface{}) ([]byte, error) {
+	switch encoding {
+	case EncodingJSON, "":
+		return json.Marshal(v)
+	case EncodingMsgPack:
+		var data []byte
+		err := codec.NewEncoderBytes(&data, msgpackHandle).Encode(v)
+		return data, err
+	case EncodingCBOR:
+		var data []byte
+		err := codec.NewEncoderBytes(&data, cborHandle).Encode(v)
+		return data, err
+	default:
+		return nil, fmt.Errorf("unknown encoding %q", encoding)
+	}
+}
+
+// Decode deserializes data in the given encoding into v
+func Decode(encoding string, data []byte, v interface{}) error {
+	switch encoding {
+	case EncodingJSON, "":
+		return json.Unmarshal(data, v)
+	case EncodingMsgPack:
+		return codec.NewDecoderBytes(data, msgpackHandle).Decode(v)
+	case EncodingCBOR:
+		return codec.NewDecoderBytes(data, cborHandle).Decode(v)
+	default:
+		return fmt.Errorf("unknown encoding %q", encoding)
+	}
+}
@@ -0,0 +1,210 @@
+package services
+
+import (
+	"chowkidar/internal/models"
+	"fmt"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// eventHistorySize is how many recent events are kept for /events
+const eventHistorySize = 1000
+
+// EventSubscription receives published events of the requested types on C
+type EventSubscription struct {
+	C       chan models.Event
+	id      uint64
+	types   map[string]bool // Empty means every type
+	dropped uint64
+}
+
+// eventHandler is a synchronous subscriber (see OnEvent)
+type eventHandler struct {
+	types   map[string]bool
+	handler func(models.Event)
+}
+
+// EventBus fans agent-internal events out to subscribers and keeps a short history
+type EventBus struct {
+	publishMu sync.Mutex // Held from numbering to delivery, so everyone sees events in id order
+	mu        sync.RWMutex
+	subs      map[uint64]*EventSubscription
+	handlers  []eventHandler
+	nextSub   uint64
+	nextID    uint64
+	recent    []models.Event // Ring buffer of the last eventHistorySize events
+	head      int
+}
+
+var eventBus = &EventBus{
+	subs: make(map[uint64]*EventSubscription),
+}
+
+// PublishEvent stamps an event with an id and time and delivers it to every
+// matching subscriber. Channel subscribers that are full miss the event.
+// Concurrent publishers are serialised, so ids reach subscribers in order.
+func PublishEvent(event models.Event) {
+	if event.Timestamp.IsZero() {
+		event.Timestamp = time.Now().UTC()
+	}
+	if event.Severity == "" {
+		event.Severity = models.SeverityInfo
+	}
+
+	bus := eventBus
+	bus.publishMu.Lock()
+	defer bus.publishMu.Unlock()
+
+	bus.mu.Lock()
+	bus.nextID++
+	event.ID = bus.nextID
+	if len(bus.recent) < eventHistorySize {
+		bus.recent = append(bus.recent, event)
+	} else {
+		bus.recent[bus.head] = event
+		bus.head = (bus.head + 1) % eventHistorySize
+	}
+	handlers := bus.handlers
+	bus.mu.Unlock()
+
+	for _, h := range handlers {
+		if len(h.types) == 0 || h.types[event.Type] {
+			h.handler(event)
+		}
+	}
+
+	bus.mu.RLock()
+	defer bus.mu.RUnlock()
+	for _, sub := range bus.subs {
+		if len(sub.types) > 0 && !sub.types[event.Type] {
+			continue
+		}
+		select {
+		case sub.C <- event:
+		default:
+			atomic.AddUint64(&sub.dropped, 1)
+		}
+	}
+}
+
+// SubscribeEvents returns a buffered subscription to the given event types (all if none)
+func SubscribeEvents(buffer int, types ...string) *EventSubscription {
+	sub := &EventSubscription{
+		C:     make(chan models.Event, buffer),
+		types: typeSet(types),
+	}
+
+	eventBus.mu.Lock()
+	eventBus.nextSub++
+	sub.id = eventBus.nextSub
+	eventBus.subs[sub.id] = sub
+	eventBus.mu.Unlock()
+	return sub
+}
+
+// Unsubscribe stops delivery and closes C
+func (s *EventSubscription) Unsubscribe() {
+	eventBus.mu.Lock()
+	defer eventBus.mu.Unlock()
+	if _, exists := eventBus.subs[s.id]; exists {
+		delete(eventBus.subs, s.id)
+		close(s.C)
+	}
+}
+
+// Dropped returns how many events did not fit in the subscription's buffer
+func (s *EventSubscription) Dropped() uint64 {
+	return atomic.LoadUint64(&s.dropped)
+}
+
+// OnEvent registers a handler run synchronously on the publisher's goroutine, so it
+// never misses an event. Handlers must be quick and must not publish events themselves.
+func OnEvent(handler func(models.Event), types ...string) {
+	eventBus.mu.Lock()
+	defer eventBus.mu.Unlock()
+	eventBus.handlers = append(eventBus.handlers, eventHandler{types: typeSet(types), handler: handler})
+}
+
+// RecentEvents returns buffered events matching the filter, oldest first
+func RecentEvents(filter models.EventFilter) []models.Event {
+	types := typeSet(filter.Types)
+
+	eventBus.mu.RLock()
+	ordered := make([]models.Event, 0, len(eventBus.recent))
+	ordered = append(ordered, eventBus.recent[eventBus.head:]...)
+	ordered = append(ordered, eventBus.recent[:eventBus.head]...)
+	eventBus.mu.RUnlock()
+
+	events := []models.Event{}
+	for _, event := range ordered {
+		if !filter.Since.IsZero() && event.Timestamp.Before(filter.Since) {
+			continue
+		}
+		if len(types) > 0 && !types[event.Type] {
+			continue
+		}
+		events = append(events, event)
+	}
+
+	if filter.Limit > 0 && len(events) > filter.Limit {
+		events = events[len(events)-filter.Limit:]
+	}
+	return events
+}
+
+// LatestEventID returns the id of the newest published event, or 0 before the first
+func LatestEventID() uint64 {
+	eventBus.mu.RLock()
+	defer eventBus.mu.RUnlock()
+	return eventBus.nextID
+}
+
+// typeSet turns a list of event types into a lookup set
+func typeSet(types []string) map[string]bool {
+	set := make(map[string]bool, len(types))
+	for _, t := range types {
+		set[t] = true
+	}
+	return set
+}
+
+// collectorErrors remembers each collector's last error so failures are
+// published once when they start or change, not on every tick
+var collectorErrors = struct {
+	sync.Mutex
+	last map[string]string
+}{last: map[string]string{}}
+
+// ReportCollectorError logs and publishes a collector failure when it is new
+func ReportCollectorError(collector string, err error) {
+	msg := err.Error()
+
+	collectorErrors.Lock()
+	if collectorErrors.last[collector] == msg {
+		collectorErrors.Unlock()
+		return
+	}
+	collectorErrors.last[collector] = msg
+	collectorErrors.Unlock()
+
+	log.Printf("⚠️  %s collector error: %v", collector, err)
+	PublishEvent(models.Event{
+		Type:     models.EventCollectorError,
+		Severity: models.SeverityWarning,
+		Source:   collector,
+		Message:  fmt.Sprintf("%s collector failed: %v", collector, err),
+		Attributes: map[string]interface{}{
+			"collector": collector,
+			"error":     msg,
+		},
+	})
+}
+
+// ReportCollectorOK clears a collector's error state after a successful run
+func ReportCollectorOK(collector string) {
+	collectorErrors.Lock()
+	defer collectorErrors.Unlock()
+	delete(collectorErrors.last, collector)
+}
@@ -0,0 +1,59 @@
+package services
+
+import (
+	"chowkidar/internal/models"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestPublishEventOrder(t *testing.T) {
+	// Handlers cannot be removed, so each run uses its own type
+	eventType := fmt.Sprintf("test_publish_order_%d", time.Now().UnixNano())
+	sub := SubscribeEvents(10, eventType)
+	defer sub.Unsubscribe()
+
+	// The handler stalls the first event while a second publisher runs. The second
+	// event must not overtake the first on its way to subscribers and handlers.
+	var (
+		mu        sync.Mutex
+		handled   []string
+		stalled   = make(chan struct{})
+		published = make(chan struct{})
+	)
+	OnEvent(func(event models.Event) {
+		mu.Lock()
+		handled = append(handled, event.Message)
+		mu.Unlock()
+		if event.Message == "first" {
+			close(stalled)
+			select {
+			case <-published:
+			case <-time.After(50 * time.Millisecond):
+			}
+		}
+	}, eventType)
+
+	go func() {
+		<-stalled
+		PublishEvent(models.Event{Type: eventType, Message: "second"})
+		close(published)
+	}()
+	PublishEvent(models.Event{Type: eventType, Message: "first"})
+	<-published
+
+	var received []models.Event
+	for len(received) < 2 {
+		received = append(received, <-sub.C)
+	}
+	if received[0].Message != "first" || received[1].Message != "second" || received[0].ID >= received[1].ID {
+		t.Errorf("subscriber got %s (%d) then %s (%d), want first then second",
+			received[0].Message, received[0].ID, received[1].Message, received[1].ID)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(handled) != 2 || handled[0] != "first" || handled[1] != "second" {
+		t.Errorf("handler got %v, want [first second]", handled)
+	}
+}
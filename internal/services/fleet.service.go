@@ -0,0 +1,672 @@
+package services
+
+import (
+	"chowkidar/internal/models"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// Fleet connection settings
+const (
+	fleetDialTimeout = 10 * time.Second
+	fleetReadTimeout = 90 * time.Second // Agents ping every 54s by default
+	fleetMinBackoff  = time.Second
+	fleetMaxBackoff  = 30 * time.Second
+	fleetPingPeriod  = 30 * time.Second // Hub pings to push agents
+	fleetAPITimeout  = 15 * time.Second // Forwarded API requests
+)
+
+// Fleet agent modes
+const (
+	FleetModeDial = "dial" // The hub connects to the agent's /ws
+	FleetModePush = "push" // The agent connects to the hub's /fleet/push
+)
+
+// Fleet registry errors
+var (
+	ErrFleetServerExists   = errors.New("server already registered")
+	ErrFleetServerNotFound = errors.New("server not found")
+	ErrFleetServerOffline  = errors.New("server not connected")
+	ErrInvalidAgentPath    = errors.New("invalid path")
+)
+
+// FleetManager holds the hub-mode registry of agents and one persistent
+// WebSocket connection per agent. Messages from agents are tagged with the
+// server name and relayed to /fleet/ws clients.
+type FleetManager struct {
+	mu     sync.RWMutex
+	agents map[string]*fleetAgent
+	path   string // Registry file (JSON, holds agent tokens)
+	hub    *WebSocketHub
+}
+
+// fleetAgent is one registered agent and the state of its connection
+type fleetAgent struct {
+	server  models.FleetServer
+	push    bool   // Connected in via /fleet/push rather than dialled
+	address string // Push agents: remote IP
+	stop    chan struct{}
+
+	mu          sync.Mutex
+	conn        *websocket.Conn
+	connected   bool
+	connectedAt time.Time
+	lastSeen    time.Time
+	lastError   string
+	stats       interface{}
+	statsAt     time.Time // Timestamp of stats
+
+	// Tunnelled API requests awaiting a response (push agents)
+	writeMu sync.Mutex
+	nextID  uint64
+	pending map[string]chan models.TunnelResponse
+}
+
+var fleet *FleetManager
+
+// InitFleet loads the agent registry and connects to every agent. An empty
+// path uses CHOWKIDAR_FLEET_FILE or the default location.
+func InitFleet(path string) (*FleetManager, error) {
+	if path == "" {
+		path = strings.TrimSpace(os.Getenv("CHOWKIDAR_FLEET_FILE"))
+	}
+	if path == "" {
+		path = defaultStateFile("fleet.json")
+	}
+
+	fm := &FleetManager{
+		agents: make(map[string]*fleetAgent),
+		path:   path,
+		hub:    newWebSocketHub(true),
+	}
+
+	servers, err := fm.load()
+	if err != nil {
+		return nil, fmt.Errorf("could not load fleet registry %s: %w", path, err)
+	}
+	for _, server := range servers {
+		fm.start(server)
+	}
+
+	fleet = fm
+	return fm, nil
+}
+
+// GetFleet returns the fleet manager (nil unless running in hub mode)
+func GetFleet() *FleetManager {
+	return fleet
+}
+
+// Hub returns the relay hub behind /fleet/ws
+func (fm *FleetManager) Hub() *WebSocketHub {
+	return fm.hub
+}
+
+// AddServer registers an agent, saves the registry and starts connecting to it
+func (fm *FleetManager) AddServer(server models.FleetServer) (models.FleetServerStatus, error) {
+	if _, err := agentStreamURL(server.URL); err != nil {
+		return models.FleetServerStatus{}, err
+	}
+	if strings.TrimSpace(server.Token) == "" {
+		return models.FleetServerStatus{}, errors.New("token is required")
+	}
+	server.AddedAt = time.Now().UTC()
+
+	fm.mu.Lock()
+	if _, exists := fm.agents[server.Name]; exists {
+		fm.mu.Unlock()
+		return models.FleetServerStatus{}, ErrFleetServerExists
+	}
+	agent := fm.startLocked(server)
+	err := fm.saveLocked()
+	fm.mu.Unlock()
+	if err != nil {
+		log.Printf("⚠️  Could not save fleet registry %s: %v", fm.path, err)
+	}
+
+	log.Printf("[FLEET] Registered %s (%s)", server.Name, server.URL)
+	return agent.status(false), nil
+}
+
+// RemoveServer unregisters an agent and closes its connection
+func (fm *FleetManager) RemoveServer(name string) error {
+	fm.mu.Lock()
+	agent, exists := fm.agents[name]
+	if !exists {
+		fm.mu.Unlock()
+		return ErrFleetServerNotFound
+	}
+	delete(fm.agents, name)
+	err := fm.saveLocked()
+	fm.mu.Unlock()
+
+	agent.close()
+	log.Printf("[FLEET] Removed %s", name)
+	return err
+}
+
+// Servers returns the status of every registered agent, sorted by name.
+// withStats includes each agent's latest stats payload.
+func (fm *FleetManager) Servers(withStats bool) []models.FleetServerStatus {
+	fm.mu.RLock()
+	statuses := make([]models.FleetServerStatus, 0, len(fm.agents))
+	for _, agent := range fm.agents {
+		statuses = append(statuses, agent.status(withStats))
+	}
+	fm.mu.RUnlock()
+
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].Name < statuses[j].Name
+	})
+	return statuses
+}
+
+// Server returns the status of one agent
+func (fm *FleetManager) Server(name string, withStats bool) (models.FleetServerStatus, bool) {
+	fm.mu.RLock()
+	defer fm.mu.RUnlock()
+	agent, exists := fm.agents[name]
+	if !exists {
+		return models.FleetServerStatus{}, false
+	}
+	return agent.status(withStats), true
+}
+
+// start registers an agent loaded from the registry and starts its connection
+func (fm *FleetManager) start(server models.FleetServer) {
+	fm.mu.Lock()
+	defer fm.mu.Unlock()
+	fm.startLocked(server)
+}
+
+// startLocked adds an agent and starts its connection loop. Caller must hold fm.mu.
+func (fm *FleetManager) startLocked(server models.FleetServer) *fleetAgent {
+	agent := &fleetAgent{server: server, stop: make(chan struct{})}
+	fm.agents[server.Name] = agent
+	go fm.connect(agent)
+	return agent
+}
+
+// connect keeps a stream open to an agent, reconnecting with exponential backoff
+func (fm *FleetManager) connect(agent *fleetAgent) {
+	backoff := fleetMinBackoff
+	for {
+		started := time.Now()
+		err := fm.stream(agent)
+
+		select {
+		case <-agent.stop:
+			return
+		default:
+		}
+
+		if agent.disconnected(err) {
+			fm.publishStatus(agent)
+		}
+		log.Printf("[FLEET] %s: %v (retrying in %s)", agent.server.Name, err, backoff)
+
+		// A connection that stayed up for a while starts the backoff over
+		if time.Since(started) > time.Minute {
+			backoff = fleetMinBackoff
+		}
+		select {
+		case <-agent.stop:
+			return
+		case <-time.After(backoff):
+		}
+		if backoff *= 2; backoff > fleetMaxBackoff {
+			backoff = fleetMaxBackoff
+		}
+	}
+}
+
+// stream dials an agent's /ws and relays its messages until the connection fails
+func (fm *FleetManager) stream(agent *fleetAgent) error {
+	wsURL, err := agentStreamURL(agent.server.URL)
+	if err != nil {
+		return err
+	}
+
+	dialer := websocket.Dialer{
+		HandshakeTimeout:  fleetDialTimeout,
+		EnableCompression: true,
+	}
+	header := http.Header{}
+	header.Set("Authorization", "Bearer "+agent.server.Token)
+	conn, resp, err := dialer.Dial(wsURL, header)
+	if err != nil {
+		if resp != nil {
+			return fmt.Errorf("dial failed: %s", resp.Status)
+		}
+		return err
+	}
+	defer conn.Close()
+
+	if !agent.connectedTo(conn) {
+		return errors.New("server removed")
+	}
+	fm.publishStatus(agent)
+	log.Printf("[FLEET] Connected to %s (%s)", agent.server.Name, wsURL)
+
+	return fm.readAgent(agent, conn)
+}
+
+// ServePush runs a session for an agent that connected to /fleet/push and
+// returns when it disconnects. A new session for the same name replaces the old one.
+func (fm *FleetManager) ServePush(name, address string, conn *websocket.Conn) error {
+	defer conn.Close()
+
+	agent := &fleetAgent{
+		server:  models.FleetServer{Name: name, AddedAt: time.Now().UTC()},
+		push:    true,
+		address: address,
+		stop:    make(chan struct{}),
+	}
+
+	fm.mu.Lock()
+	if existing, exists := fm.agents[name]; exists {
+		if !existing.push {
+			fm.mu.Unlock()
+			return ErrFleetServerExists
+		}
+		existing.close()
+	}
+	fm.agents[name] = agent
+	fm.mu.Unlock()
+
+	agent.connectedTo(conn)
+	fm.publishStatus(agent)
+	log.Printf("[FLEET] Push agent %s connected from %s", name, address)
+
+	go agent.keepAlive(conn)
+	err := fm.readAgent(agent, conn)
+	agent.close() // Stops the pings and fails pending tunnelled requests
+
+	// Stay listed as disconnected unless a newer session took over or it was removed
+	fm.mu.RLock()
+	current := fm.agents[name] == agent
+	fm.mu.RUnlock()
+	agent.disconnected(err)
+	if current {
+		fm.publishStatus(agent)
+		log.Printf("[FLEET] Push agent %s disconnected: %v", name, err)
+	}
+	return err
+}
+
+// readAgent relays an agent's messages until its connection fails
+func (fm *FleetManager) readAgent(agent *fleetAgent, conn *websocket.Conn) error {
+	// Every ping or message from the agent proves it is alive
+	conn.SetReadDeadline(time.Now().Add(fleetReadTimeout))
+	conn.SetPingHandler(func(data string) error {
+		conn.SetReadDeadline(time.Now().Add(fleetReadTimeout))
+		return conn.WriteControl(websocket.PongMessage, []byte(data), time.Now().Add(fleetDialTimeout))
+	})
+	conn.SetPongHandler(func(string) error {
+		conn.SetReadDeadline(time.Now().Add(fleetReadTimeout))
+		return nil
+	})
+
+	for {
+		messageType, data, err := conn.ReadMessage()
+		if err != nil {
+			return err
+		}
+		conn.SetReadDeadline(time.Now().Add(fleetReadTimeout))
+		if messageType != websocket.TextMessage {
+			continue
+		}
+
+		var msg WebSocketMessage
+		if err := json.Unmarshal(data, &msg); err != nil {
+			continue
+		}
+		msg.Server = agent.server.Name
+
+		switch msg.Type {
+		case "stats":
+			agent.received(msg.Timestamp, msg.Data)
+			fm.hub.PublishToTopic("", msg)
+		case "alert", "event":
+			fm.hub.PublishToTopic(messageTopics[msg.Type], msg)
+		case "response":
+			var resp models.TunnelResponse
+			if err := convertData(msg.Data, &resp); err == nil {
+				agent.resolve(msg.ID, resp)
+			}
+		}
+	}
+}
+
+// Request performs a GET against an agent's REST API: directly for dialled
+// agents, through the push connection for push agents
+func (fm *FleetManager) Request(name, path string) (models.TunnelResponse, error) {
+	if _, err := parseAgentPath(path); err != nil {
+		return models.TunnelResponse{}, err
+	}
+	fm.mu.RLock()
+	agent, exists := fm.agents[name]
+	fm.mu.RUnlock()
+	if !exists {
+		return models.TunnelResponse{}, ErrFleetServerNotFound
+	}
+	if agent.push {
+		return agent.tunnel(models.TunnelRequest{Method: http.MethodGet, Path: path})
+	}
+	return agent.get(path)
+}
+
+// get calls a dialled agent's REST API with its token
+func (a *fleetAgent) get(path string) (models.TunnelResponse, error) {
+	base, err := url.Parse(a.server.URL)
+	if err != nil {
+		return models.TunnelResponse{}, err
+	}
+	switch base.Scheme {
+	case "ws":
+		base.Scheme = "http"
+	case "wss":
+		base.Scheme = "https"
+	}
+	requested, err := parseAgentPath(path)
+	if err != nil {
+		return models.TunnelResponse{}, err
+	}
+	// Only the path and query come from the caller; the host is always the agent's
+	target := *base
+	target.Path = strings.TrimSuffix(base.Path, "/") + requested.Path
+	target.RawPath = ""
+	target.RawQuery = requested.RawQuery
+	target.Fragment = ""
+
+	req, err := http.NewRequest(http.MethodGet, target.String(), nil)
+	if err != nil {
+		return models.TunnelResponse{}, err
+	}
+	req.Header.Set("Authorization", "Bearer "+a.server.Token)
+	resp, err := (&http.Client{Timeout: fleetAPITimeout}).Do(req)
+	if err != nil {
+		return models.TunnelResponse{}, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxTunnelBody))
+	if err != nil {
+		return models.TunnelResponse{}, err
+	}
+	return models.TunnelResponse{
+		Status:      resp.StatusCode,
+		ContentType: resp.Header.Get("Content-Type"),
+		Body:        string(body),
+	}, nil
+}
+
+// parseAgentPath parses an agent API path such as "/metrics/cpu?since=1h". Anything
+// that could name another host ("//host/x", "http://host/x") or climb out of the
+// agent's base path ("/../x", also when escaped) is rejected.
+func parseAgentPath(raw string) (*url.URL, error) {
+	if !strings.HasPrefix(raw, "/") || strings.HasPrefix(raw, "//") || strings.HasPrefix(raw, "/\\") {
+		return nil, ErrInvalidAgentPath
+	}
+	parsed, err := url.Parse(raw)
+	if err != nil || parsed.Scheme != "" || parsed.Host != "" || parsed.User != nil || !strings.HasPrefix(parsed.Path, "/") {
+		return nil, ErrInvalidAgentPath
+	}
+	for _, segment := range strings.Split(parsed.Path, "/") {
+		if segment == "." || segment == ".." {
+			return nil, ErrInvalidAgentPath
+		}
+	}
+	return parsed, nil
+}
+
+// tunnel sends a request over a push agent's connection and waits for the answer
+func (a *fleetAgent) tunnel(req models.TunnelRequest) (models.TunnelResponse, error) {
+	a.mu.Lock()
+	conn := a.conn
+	if conn == nil {
+		a.mu.Unlock()
+		return models.TunnelResponse{}, ErrFleetServerOffline
+	}
+	a.nextID++
+	id := strconv.FormatUint(a.nextID, 10)
+	reply := make(chan models.TunnelResponse, 1)
+	if a.pending == nil {
+		a.pending = make(map[string]chan models.TunnelResponse)
+	}
+	a.pending[id] = reply
+	a.mu.Unlock()
+
+	defer func() {
+		a.mu.Lock()
+		delete(a.pending, id)
+		a.mu.Unlock()
+	}()
+
+	a.writeMu.Lock()
+	conn.SetWriteDeadline(time.Now().Add(fleetDialTimeout))
+	err := conn.WriteJSON(WebSocketMessage{Type: "request", Timestamp: time.Now(), ID: id, Data: req})
+	a.writeMu.Unlock()
+	if err != nil {
+		return models.TunnelResponse{}, err
+	}
+
+	select {
+	case resp := <-reply:
+		return resp, nil
+	case <-a.stop:
+		return models.TunnelResponse{}, ErrFleetServerOffline
+	case <-time.After(fleetAPITimeout):
+		return models.TunnelResponse{}, fmt.Errorf("no response within %s", fleetAPITimeout)
+	}
+}
+
+// resolve hands a tunnelled response to the request waiting for it
+func (a *fleetAgent) resolve(id string, resp models.TunnelResponse) {
+	a.mu.Lock()
+	reply, exists := a.pending[id]
+	a.mu.Unlock()
+	if exists {
+		select {
+		case reply <- resp:
+		default:
+		}
+	}
+}
+
+// keepAlive pings a push agent so dead connections are noticed on both ends
+func (a *fleetAgent) keepAlive(conn *websocket.Conn) {
+	ticker := time.NewTicker(fleetPingPeriod)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-a.stop:
+			return
+		case <-ticker.C:
+			if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(fleetDialTimeout)); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// publishStatus tells /fleet/ws clients that an agent connected or disconnected
+func (fm *FleetManager) publishStatus(agent *fleetAgent) {
+	status := agent.status(false)
+	fm.hub.PublishToTopic("", WebSocketMessage{
+		Type:      "server_status",
+		Timestamp: time.Now(),
+		Server:    status.Name,
+		Data:      status,
+	})
+}
+
+// connectedTo records a new connection unless the agent was removed meanwhile
+func (a *fleetAgent) connectedTo(conn *websocket.Conn) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	select {
+	case <-a.stop:
+		return false
+	default:
+	}
+	a.conn = conn
+	a.connected = true
+	a.connectedAt = time.Now()
+	a.lastError = ""
+	return true
+}
+
+// disconnected records why the connection ended and reports whether the
+// agent's state changed (it was connected, or it is failing differently)
+func (a *fleetAgent) disconnected(err error) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	changed := a.connected
+	a.conn = nil
+	a.connected = false
+	if err != nil && err.Error() != a.lastError {
+		a.lastError = err.Error()
+		changed = true
+	}
+	return changed
+}
+
+// received stores the agent's latest stats payload. Older snapshots (a push
+// agent replaying what it buffered while offline) do not replace newer ones.
+func (a *fleetAgent) received(at time.Time, stats interface{}) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.lastSeen = time.Now()
+	if at.Before(a.statsAt) {
+		return
+	}
+	a.stats = stats
+	a.statsAt = at
+}
+
+// close stops the connection loop and closes the socket
+func (a *fleetAgent) close() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	select {
+	case <-a.stop:
+	default:
+		close(a.stop)
+	}
+	if a.conn != nil {
+		a.conn.Close()
+	}
+}
+
+// status reports the agent's connection state
+func (a *fleetAgent) status(withStats bool) models.FleetServerStatus {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	status := models.FleetServerStatus{
+		Name:      a.server.Name,
+		URL:       a.server.URL,
+		Address:   a.address,
+		Mode:      FleetModeDial,
+		Connected: a.connected,
+		LastError: a.lastError,
+	}
+	if a.push {
+		status.Mode = FleetModePush
+	}
+	if a.connected {
+		connectedAt := a.connectedAt
+		status.ConnectedAt = &connectedAt
+	}
+	if !a.lastSeen.IsZero() {
+		lastSeen := a.lastSeen
+		status.LastSeen = &lastSeen
+	}
+	if withStats {
+		status.Stats = a.stats
+	}
+	return status
+}
+
+// agentStreamURL turns an agent base URL (http, https, ws or wss) into its /ws URL
+func agentStreamURL(raw string) (string, error) {
+	parsed, err := url.Parse(strings.TrimSpace(raw))
+	if err != nil {
+		return "", fmt.Errorf("invalid url: %w", err)
+	}
+	switch parsed.Scheme {
+	case "http":
+		parsed.Scheme = "ws"
+	case "https":
+		parsed.Scheme = "wss"
+	case "ws", "wss":
+	default:
+		return "", errors.New("url must start with http://, https://, ws:// or wss://")
+	}
+	if parsed.Host == "" {
+		return "", errors.New("url must include a host")
+	}
+	if parsed.Path == "" || parsed.Path == "/" {
+		parsed.Path = "/ws"
+	}
+	return parsed.String(), nil
+}
+
+// load reads the registry file
+func (fm *FleetManager) load() ([]models.FleetServer, error) {
+	data, err := os.ReadFile(fm.path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	servers := []models.FleetServer{}
+	if len(strings.TrimSpace(string(data))) > 0 {
+		if err := json.Unmarshal(data, &servers); err != nil {
+			return nil, err
+		}
+	}
+	return servers, nil
+}
+
+// saveLocked writes the registry file atomically. Caller must hold fm.mu.
+func (fm *FleetManager) saveLocked() error {
+	servers := make([]models.FleetServer, 0, len(fm.agents))
+	for _, agent := range fm.agents {
+		if !agent.push {
+			servers = append(servers, agent.server)
+		}
+	}
+	sort.Slice(servers, func(i, j int) bool {
+		return servers[i].Name < servers[j].Name
+	})
+
+	data, err := json.MarshalIndent(servers, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(fm.path), 0700); err != nil {
+		return err
+	}
+	tmp := fm.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, fm.path)
+}
@@ -0,0 +1,50 @@
+package services
+
+import (
+	"testing"
+)
+
+func TestParseAgentPath(t *testing.T) {
+	tests := []struct {
+		raw       string
+		wantPath  string
+		wantQuery string
+		wantErr   bool
+	}{
+		{raw: "/metrics/cpu", wantPath: "/metrics/cpu"},
+		{raw: "/metrics/history?metric=cpu&since=1h", wantPath: "/metrics/history", wantQuery: "metric=cpu&since=1h"},
+		{raw: "/", wantPath: "/"},
+		{raw: "/metrics/..cpu", wantPath: "/metrics/..cpu"}, // Only whole ".." segments climb
+		{raw: "", wantErr: true},
+		{raw: "metrics/cpu", wantErr: true},
+		{raw: "//evil.example/metrics", wantErr: true},
+		{raw: "///evil.example/metrics", wantErr: true},
+		{raw: "/\\evil.example/metrics", wantErr: true},
+		{raw: "http://evil.example/metrics", wantErr: true},
+		{raw: "https://user@evil.example/", wantErr: true},
+		{raw: "/..", wantErr: true},
+		{raw: "/../admin", wantErr: true},
+		{raw: "/metrics/../../admin", wantErr: true},
+		{raw: "/metrics/./cpu", wantErr: true},
+		{raw: "/metrics/%2e%2e/admin", wantErr: true},
+		{raw: "/metrics/%2E%2E", wantErr: true},
+		{raw: "/metrics/%zz", wantErr: true},
+	}
+	for _, tt := range tests {
+		parsed, err := parseAgentPath(tt.raw)
+		if tt.wantErr {
+			if err != ErrInvalidAgentPath {
+				t.Errorf("parseAgentPath(%q) = %v, %v, want ErrInvalidAgentPath", tt.raw, parsed, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parseAgentPath(%q) error: %v", tt.raw, err)
+			continue
+		}
+		if parsed.Path != tt.wantPath || parsed.RawQuery != tt.wantQuery || parsed.Host != "" {
+			t.Errorf("parseAgentPath(%q) = path %q, query %q, host %q; want %q, %q, no host",
+				tt.raw, parsed.Path, parsed.RawQuery, parsed.Host, tt.wantPath, tt.wantQuery)
+		}
+	}
+}
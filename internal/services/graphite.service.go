@@ -0,0 +1,127 @@
+package services
+
+import (
+	"bytes"
+	"chowkidar/internal/models"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// graphiteTimeout bounds connecting and writing to Carbon
+const graphiteTimeout = 10 * time.Second
+
+// GraphiteOutput writes history snapshots to Carbon in the plaintext protocol
+// over TCP. Agent labels are sent as Graphite 1.1 tags (path;key=value).
+type GraphiteOutput struct {
+	Address string // host:port, usually port 2003
+	Prefix  string // Dotted path prefix, e.g. chowkidar.web-1
+	Tags    map[string]string
+}
+
+// newGraphiteOutput configures the Graphite output from CHOWKIDAR_GRAPHITE_* (nil when disabled)
+func newGraphiteOutput() (Output, error) {
+	address := strings.TrimSpace(os.Getenv("CHOWKIDAR_GRAPHITE_ADDR"))
+	if address == "" {
+		return nil, nil
+	}
+	if _, _, err := net.SplitHostPort(address); err != nil {
+		return nil, fmt.Errorf("invalid CHOWKIDAR_GRAPHITE_ADDR %q: %w", address, err)
+	}
+
+	labels := AgentLabels()
+	prefix := strings.TrimSpace(os.Getenv("CHOWKIDAR_GRAPHITE_PREFIX"))
+	if prefix == "" {
+		prefix = "chowkidar.{host}"
+	}
+	prefix = strings.Trim(strings.ReplaceAll(prefix, "{host}", graphiteNode(labels["host"])), ".")
+
+	// The host is already part of the path
+	delete(labels, "host")
+
+	return &GraphiteOutput{Address: address, Prefix: prefix, Tags: labels}, nil
+}
+
+// Name identifies the output
+func (o *GraphiteOutput) Name() string {
+	return "graphite"
+}
+
+// Serialize renders a snapshot as "path value timestamp" lines. NaN and ±Inf
+// values are skipped.
+func (o *GraphiteOutput) Serialize(point models.HistoryPoint) ([]byte, error) {
+	var buf bytes.Buffer
+	ts := strconv.FormatInt(point.Timestamp.Unix(), 10)
+
+	// <prefix>.<collector>.<sample>, sample labels as tags
+	tags := graphiteTags(o.Tags)
+	for _, name := range sortedSampleKeys(point.Samples) {
+		for _, sample := range point.Samples[name] {
+			if !finite(sample.Value) {
+				continue
+			}
+			sampleTags := tags
+			if len(sample.Labels) > 0 {
+				labels := make(map[string]string, len(o.Tags)+len(sample.Labels))
+				for key, value := range o.Tags {
+					labels[key] = value
+				}
+				for key, value := range sample.Labels {
+					labels[key] = value
+				}
+				sampleTags = graphiteTags(labels)
+			}
+			path := graphiteNode(name) + "." + graphiteNode(sample.Name)
+			buf.WriteString(o.Prefix + "." + path + sampleTags + " " + strconv.FormatFloat(sample.Value, 'f', -1, 64) + " " + ts + "\n")
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+// graphiteTags renders labels as ";key=value" tags, skipping empty values
+func graphiteTags(labels map[string]string) string {
+	var tags strings.Builder
+	for _, key := range sortedLabelKeys(labels) {
+		if labels[key] != "" {
+			tags.WriteString(";" + graphiteTag(key) + "=" + graphiteTag(labels[key]))
+		}
+	}
+	return tags.String()
+}
+
+// Write sends plaintext lines to Carbon over a fresh TCP connection
+func (o *GraphiteOutput) Write(data []byte) error {
+	conn, err := net.DialTimeout("tcp", o.Address, graphiteTimeout)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	conn.SetWriteDeadline(time.Now().Add(graphiteTimeout))
+	_, err = conn.Write(data)
+	return err
+}
+
+// graphiteNode makes a value safe as one path segment
+func graphiteNode(value string) string {
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case '.', ' ', ';', '=', '~', '/':
+			return '_'
+		}
+		return r
+	}, value)
+}
+
+// graphiteTag makes a value safe as a tag key or value
+func graphiteTag(value string) string {
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case ';', '!', '^', '=', ' ', '~':
+			return '_'
+		}
+		return r
+	}, value)
+}
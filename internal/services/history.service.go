@@ -3,10 +3,21 @@ package services
 import (
 	"chowkidar/internal/models"
 	"log"
+	"sort"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 )
 
+// CustomMetricPrefix names application metrics in history queries and alert
+// rules, e.g. "custom:checkout.latency.p95"
+const CustomMetricPrefix = "custom:"
+
+// seriesRetention is how long collector and custom series points are kept;
+// series with no new value for this long are removed
+const seriesRetention = time.Hour
+
 // HistoryCollector manages time-series metric data
 type HistoryCollector struct {
 	mu              sync.RWMutex
@@ -19,6 +30,15 @@ type HistoryCollector struct {
 	lastTime        time.Time
 	maxDataPoints   int // Keep only this many points (e.g., 60 for 1h at 1min interval)
 	running         bool
+
+	// Collector samples, keyed by series name (see CollectorSeriesName)
+	seriesHistory map[string][]models.MetricSnapshot
+
+	// Application metrics (StatsD, API), keyed by series name
+	customHistory   map[string][]models.MetricSnapshot
+	customLatest    map[string]models.CustomMetric
+	maxCustomSeries int
+	maxCustomPoints int // Per series; the oldest points are dropped beyond it
 }
 
 var historyCollector = &HistoryCollector{
@@ -29,6 +49,16 @@ var historyCollector = &HistoryCollector{
 	maxDataPoints:  60, // Keep 1 hour of data (60 points at 1-minute intervals)
 	lastTime:       time.Now(),
 	running:        false,
+
+	seriesHistory:   map[string][]models.MetricSnapshot{},
+	customHistory:   map[string][]models.MetricSnapshot{},
+	customLatest:    map[string]models.CustomMetric{},
+	maxCustomSeries: intFromEnv("CHOWKIDAR_CUSTOM_MAX_SERIES", 1000),
+	maxCustomPoints: intFromEnv("CHOWKIDAR_CUSTOM_MAX_POINTS", 3600),
+}
+
+func init() {
+	RegisterMetricPrefix(CustomMetricPrefix, customMetricValue)
 }
 
 // StartHistoryCollector starts collecting historical metrics
@@ -46,7 +76,7 @@ func StartHistoryCollector(interval time.Duration) {
 		defer ticker.Stop()
 
 		for range ticker.C {
-			historyCollector.collectSnapshot()
+			writeOutputs(historyCollector.collectSnapshot())
 		}
 	}()
 
@@ -61,75 +91,108 @@ func StopHistoryCollector() {
 	log.Println("History collector stopped")
 }
 
-// collectSnapshot takes a snapshot of all metrics
-// Key optimization: System calls are done OUTSIDE the lock to prevent blocking reader goroutines
-func (hc *HistoryCollector) collectSnapshot() {
+// collectSnapshot records the latest samples of every enabled collector, each
+// as a series, and returns them for the outputs. Collectors read the system on
+// their own schedule, so nothing is read here.
+func (hc *HistoryCollector) collectSnapshot() models.HistoryPoint {
 	now := time.Now()
+	samples := latestCollectorSamples()
 
-	// Call all system functions OUTSIDE the lock
-	// These can take 100-500ms, and we don't want to block readers
-	cpu, cpuErr := GetCPUUsage()
-	memory, memErr := GetMemoryUsage()
-	disk, diskErr := GetDiskUsage("/")
-	network, netErr := GetNetworkUsage()
-
-	// Now acquire lock only for the quick append operations
 	hc.mu.Lock()
 	defer hc.mu.Unlock()
 
-	// CPU
-	if cpuErr == nil {
-		hc.cpuHistory = append(hc.cpuHistory, models.CPUHistory{
-			Timestamp: now,
-			Usage:     cpu.UsagePercent,
-			PerCore:   cpu.PerCore,
-		})
+	for name, list := range samples {
+		for _, sample := range list {
+			series := CollectorSeriesName(name, sample)
+			hc.seriesHistory[series] = append(hc.seriesHistory[series], models.MetricSnapshot{Timestamp: now, Value: sample.Value})
+		}
+	}
+	expireSeries(hc.seriesHistory, now.Add(-seriesRetention), nil)
+	hc.recordSummaries(now, samples)
+	return models.HistoryPoint{Timestamp: now, Samples: samples}
+}
+
+// recordSummaries keeps the cpu, memory, disk and network history views served by
+// /metrics/history and replay, built from the built-in collectors' samples.
+// Caller holds hc.mu.
+func (hc *HistoryCollector) recordSummaries(now time.Time, samples map[string][]models.Sample) {
+	if list := samples[TopicCPU]; len(list) > 0 {
+		entry := models.CPUHistory{Timestamp: now}
+		for _, sample := range list {
+			switch sample.Name {
+			case "usage_percent":
+				entry.Usage = sample.Value
+			case "core_usage_percent":
+				if core, err := strconv.Atoi(sample.Labels["core"]); err == nil && core >= 0 && core < len(list) {
+					for len(entry.PerCore) <= core {
+						entry.PerCore = append(entry.PerCore, 0)
+					}
+					entry.PerCore[core] = sample.Value
+				}
+			}
+		}
+		hc.cpuHistory = append(hc.cpuHistory, entry)
 		if len(hc.cpuHistory) > hc.maxDataPoints {
 			hc.cpuHistory = hc.cpuHistory[1:]
 		}
 	}
 
-	// Memory
-	if memErr == nil {
-		hc.memoryHistory = append(hc.memoryHistory, models.MemoryHistory{
-			Timestamp:    now,
-			UsedGB:       memory.UsedGB,
-			AvailableGB:  memory.AvailableGB,
-			UsagePercent: memory.UsagePercent,
-		})
+	if list := samples[TopicMemory]; len(list) > 0 {
+		entry := models.MemoryHistory{Timestamp: now}
+		for _, sample := range list {
+			switch sample.Name {
+			case "used_bytes":
+				entry.UsedGB = sample.Value / GB
+			case "available_bytes":
+				entry.AvailableGB = sample.Value / GB
+			case "usage_percent":
+				entry.UsagePercent = sample.Value
+			}
+		}
+		hc.memoryHistory = append(hc.memoryHistory, entry)
 		if len(hc.memoryHistory) > hc.maxDataPoints {
 			hc.memoryHistory = hc.memoryHistory[1:]
 		}
 	}
 
-	// Disk
-	if diskErr == nil {
-		hc.diskHistory = append(hc.diskHistory, models.DiskHistory{
-			Timestamp:    now,
-			UsedGB:       disk.UsedGB,
-			TotalGB:      disk.TotalGB,
-			UsagePercent: disk.UsagePercent,
-		})
+	// The disk view follows the root filesystem
+	entry, found := models.DiskHistory{Timestamp: now}, false
+	for _, sample := range samples[TopicDisk] {
+		if sample.Labels["path"] != "/" {
+			continue
+		}
+		found = true
+		switch sample.Name {
+		case "used_bytes":
+			entry.UsedGB = sample.Value / GB
+		case "total_bytes":
+			entry.TotalGB = sample.Value / GB
+		case "usage_percent":
+			entry.UsagePercent = sample.Value
+		}
+	}
+	if found {
+		hc.diskHistory = append(hc.diskHistory, entry)
 		if len(hc.diskHistory) > hc.maxDataPoints {
 			hc.diskHistory = hc.diskHistory[1:]
 		}
 	}
 
-	// Network (with throughput calculation)
-	if netErr == nil && len(network) > 0 {
-		totalSent := uint64(0)
-		totalRecv := uint64(0)
-		for _, iface := range network {
-			totalSent += iface.BytesSent
-			totalRecv += iface.BytesRecv
+	// Network totals across interfaces, with throughput since the last snapshot
+	if list := samples[TopicNetwork]; len(list) > 0 {
+		totalSent, totalRecv := uint64(0), uint64(0)
+		for _, sample := range list {
+			switch sample.Name {
+			case "bytes_sent":
+				totalSent += uint64(sample.Value)
+			case "bytes_recv":
+				totalRecv += uint64(sample.Value)
+			}
 		}
 
-		// Calculate rates
 		timeDiff := now.Sub(hc.lastTime).Seconds()
-		bytesSentRate := 0.0
-		bytesRecvRate := 0.0
-
-		if timeDiff > 0 && hc.lastNetworkSent > 0 {
+		bytesSentRate, bytesRecvRate := 0.0, 0.0
+		if timeDiff > 0 && hc.lastNetworkSent > 0 && totalSent >= hc.lastNetworkSent && totalRecv >= hc.lastNetworkRecv {
 			bytesSentRate = float64(totalSent-hc.lastNetworkSent) / timeDiff
 			bytesRecvRate = float64(totalRecv-hc.lastNetworkRecv) / timeDiff
 		}
@@ -141,11 +204,7 @@ func (hc *HistoryCollector) collectSnapshot() {
 			BytesSentRate: bytesSentRate,
 			BytesRecvRate: bytesRecvRate,
 		})
-
-		hc.lastNetworkSent = totalSent
-		hc.lastNetworkRecv = totalRecv
-		hc.lastTime = now
-
+		hc.lastNetworkSent, hc.lastNetworkRecv, hc.lastTime = totalSent, totalRecv, now
 		if len(hc.networkHistory) > hc.maxDataPoints {
 			hc.networkHistory = hc.networkHistory[1:]
 		}
@@ -153,7 +212,8 @@ func (hc *HistoryCollector) collectSnapshot() {
 }
 
 // GetHistoricalData returns historical data for the specified metric and duration
-// metric: "cpu", "memory", "disk", "network"
+// metric: "cpu", "memory", "disk", "network", a collector series (e.g. "load.load1")
+// or "custom:<series>"
 // duration: time duration string like "5m", "10m", "1h" (default: 10m)
 func GetHistoricalData(metric string, duration time.Duration) interface{} {
 	historyCollector.mu.RLock()
@@ -161,6 +221,30 @@ func GetHistoricalData(metric string, duration time.Duration) interface{} {
 
 	cutoffTime := time.Now().Add(-duration)
 
+	if series, ok := strings.CutPrefix(metric, CustomMetricPrefix); ok {
+		points, exists := historyCollector.customHistory[series]
+		if !exists {
+			return nil
+		}
+		filtered := []models.MetricSnapshot{}
+		for _, h := range points {
+			if h.Timestamp.After(cutoffTime) {
+				filtered = append(filtered, h)
+			}
+		}
+		return filtered
+	}
+
+	if points, exists := historyCollector.seriesHistory[metric]; exists {
+		filtered := []models.MetricSnapshot{}
+		for _, h := range points {
+			if h.Timestamp.After(cutoffTime) {
+				filtered = append(filtered, h)
+			}
+		}
+		return filtered
+	}
+
 	switch metric {
 	case "cpu":
 		filtered := []models.CPUHistory{}
@@ -250,3 +334,168 @@ func GetLatestNetworkHistory() *models.NetworkHistory {
 
 	return &historyCollector.networkHistory[len(historyCollector.networkHistory)-1]
 }
+
+// GetHistoryPoints returns history samples newer than since, joined by timestamp, oldest first
+func GetHistoryPoints(since time.Time) []models.HistoryPoint {
+	historyCollector.mu.RLock()
+	defer historyCollector.mu.RUnlock()
+
+	points := map[time.Time]*models.HistoryPoint{}
+	point := func(ts time.Time) *models.HistoryPoint {
+		p, exists := points[ts]
+		if !exists {
+			p = &models.HistoryPoint{Timestamp: ts}
+			points[ts] = p
+		}
+		return p
+	}
+
+	for i := range historyCollector.cpuHistory {
+		if h := historyCollector.cpuHistory[i]; h.Timestamp.After(since) {
+			point(h.Timestamp).CPU = &h
+		}
+	}
+	for i := range historyCollector.memoryHistory {
+		if h := historyCollector.memoryHistory[i]; h.Timestamp.After(since) {
+			point(h.Timestamp).Memory = &h
+		}
+	}
+	for i := range historyCollector.diskHistory {
+		if h := historyCollector.diskHistory[i]; h.Timestamp.After(since) {
+			point(h.Timestamp).Disk = &h
+		}
+	}
+	for i := range historyCollector.networkHistory {
+		if h := historyCollector.networkHistory[i]; h.Timestamp.After(since) {
+			point(h.Timestamp).Network = &h
+		}
+	}
+
+	result := make([]models.HistoryPoint, 0, len(points))
+	for _, p := range points {
+		result = append(result, *p)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Timestamp.Before(result[j].Timestamp)
+	})
+	return result
+}
+
+// RecordCustomMetrics stores application metric values and returns how many were
+// accepted. Values for new series beyond CHOWKIDAR_CUSTOM_MAX_SERIES are dropped,
+// as are values whose type differs from their series' (a gauge and a counter
+// with the same name and tags) and counter values older than the series' latest,
+// which would leave later totals without their increment. A series keeps at most
+// CHOWKIDAR_CUSTOM_MAX_POINTS points, dropping the oldest.
+func RecordCustomMetrics(metrics []models.CustomMetric) int {
+	historyCollector.mu.Lock()
+	defer historyCollector.mu.Unlock()
+	hc := historyCollector
+
+	accepted := 0
+	for _, metric := range metrics {
+		if !finite(metric.Value) { // e.g. a counter total that overflowed
+			continue
+		}
+		points, exists := hc.customHistory[metric.Name]
+		if !exists && len(hc.customHistory) >= hc.maxCustomSeries {
+			continue
+		}
+		latest, seen := hc.customLatest[metric.Name]
+		if seen && (latest.Type != metric.Type || (metric.Type == "counter" && metric.Timestamp.Before(latest.Timestamp))) {
+			continue
+		}
+		// Keep points ordered: values usually arrive in order and are appended,
+		// late (backfilled) gauge values are inserted in place
+		snapshot := models.MetricSnapshot{Timestamp: metric.Timestamp, Value: metric.Value}
+		if n := len(points); n == 0 || !metric.Timestamp.Before(points[n-1].Timestamp) {
+			points = append(points, snapshot)
+		} else {
+			at := sort.Search(n, func(i int) bool { return points[i].Timestamp.After(metric.Timestamp) })
+			points = append(points, models.MetricSnapshot{})
+			copy(points[at+1:], points[at:])
+			points[at] = snapshot
+		}
+		if hc.maxCustomPoints > 0 && len(points) > hc.maxCustomPoints {
+			points = points[len(points)-hc.maxCustomPoints:]
+		}
+		hc.customHistory[metric.Name] = points
+		if !seen || !metric.Timestamp.Before(latest.Timestamp) {
+			hc.customLatest[metric.Name] = metric
+		}
+		accepted++
+	}
+
+	expireSeries(hc.customHistory, time.Now().Add(-seriesRetention), func(name string) {
+		delete(hc.customLatest, name)
+	})
+	return accepted
+}
+
+// expireSeries drops points older than cutoff, and series left without points
+func expireSeries(series map[string][]models.MetricSnapshot, cutoff time.Time, removed func(name string)) {
+	for name, points := range series {
+		keep := 0
+		for keep < len(points) && !points[keep].Timestamp.After(cutoff) {
+			keep++
+		}
+		if keep == len(points) {
+			delete(series, name)
+			if removed != nil {
+				removed(name)
+			}
+		} else if keep > 0 {
+			series[name] = append([]models.MetricSnapshot(nil), points[keep:]...)
+		}
+	}
+}
+
+// GetCustomMetrics returns the latest value of every custom series, sorted by name
+func GetCustomMetrics() []models.CustomMetric {
+	historyCollector.mu.RLock()
+	defer historyCollector.mu.RUnlock()
+
+	metrics := make([]models.CustomMetric, 0, len(historyCollector.customLatest))
+	for _, metric := range historyCollector.customLatest {
+		metrics = append(metrics, metric)
+	}
+	sort.Slice(metrics, func(i, j int) bool {
+		return metrics[i].Name < metrics[j].Name
+	})
+	return metrics
+}
+
+// customMetricValue resolves "custom:<series>" to the series' latest value for alert rules
+func customMetricValue(name string) (float64, bool) {
+	historyCollector.mu.RLock()
+	defer historyCollector.mu.RUnlock()
+
+	metric, exists := historyCollector.customLatest[strings.TrimPrefix(name, CustomMetricPrefix)]
+	return metric.Value, exists
+}
+
+// customSeriesLatest returns the latest value of an existing custom series
+func customSeriesLatest(name string) (models.CustomMetric, bool) {
+	historyCollector.mu.RLock()
+	defer historyCollector.mu.RUnlock()
+
+	metric, exists := historyCollector.customLatest[name]
+	return metric, exists
+}
+
+// CustomSeriesName names a series after its metric and sorted tags, e.g.
+// "http.requests{canary,method=GET}"; untagged series keep the plain name
+func CustomSeriesName(name string, tags map[string]string) string {
+	if len(tags) == 0 {
+		return name
+	}
+	parts := make([]string, 0, len(tags))
+	for _, key := range sortedLabelKeys(tags) {
+		if tags[key] == "" {
+			parts = append(parts, key)
+		} else {
+			parts = append(parts, key+"="+tags[key])
+		}
+	}
+	return name + "{" + strings.Join(parts, ",") + "}"
+}
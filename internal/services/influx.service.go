@@ -0,0 +1,214 @@
+package services
+
+import (
+	"bytes"
+	"chowkidar/internal/models"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Influx output settings
+const (
+	influxTimeout       = 10 * time.Second
+	influxMaxUDPPayload = 1400 // Keep datagrams under a typical MTU
+)
+
+// InfluxOutput writes history snapshots as InfluxDB line protocol, over the
+// HTTP write API (v1 /write or v2 /api/v2/write) or UDP
+type InfluxOutput struct {
+	URL    string // HTTP write URL, or udp://host:port
+	Token  string // Sent as "Authorization: Token ..." (v2, or v1 with auth)
+	Prefix string // Prepended to measurement names
+	Tags   map[string]string
+
+	client *http.Client
+}
+
+// newInfluxOutput configures the Influx output from CHOWKIDAR_INFLUX_* (nil when disabled)
+func newInfluxOutput() (Output, error) {
+	rawURL := strings.TrimSpace(os.Getenv("CHOWKIDAR_INFLUX_URL"))
+	if rawURL == "" {
+		return nil, nil
+	}
+	parsed, err := url.Parse(rawURL)
+	if err != nil || parsed.Host == "" {
+		return nil, fmt.Errorf("invalid CHOWKIDAR_INFLUX_URL %q", rawURL)
+	}
+
+	switch parsed.Scheme {
+	case "udp":
+	case "http", "https":
+		// A bare server URL gets the write path for the configured API version
+		if parsed.Path == "" || parsed.Path == "/" {
+			query := url.Values{"precision": {"ns"}}
+			if bucket := strings.TrimSpace(os.Getenv("CHOWKIDAR_INFLUX_BUCKET")); bucket != "" {
+				parsed.Path = "/api/v2/write"
+				query.Set("bucket", bucket)
+				query.Set("org", strings.TrimSpace(os.Getenv("CHOWKIDAR_INFLUX_ORG")))
+			} else if db := strings.TrimSpace(os.Getenv("CHOWKIDAR_INFLUX_DB")); db != "" {
+				parsed.Path = "/write"
+				query.Set("db", db)
+			} else {
+				return nil, errors.New("CHOWKIDAR_INFLUX_URL needs CHOWKIDAR_INFLUX_BUCKET (v2) or CHOWKIDAR_INFLUX_DB (v1), or a full write URL")
+			}
+			parsed.RawQuery = query.Encode()
+		}
+	default:
+		return nil, errors.New("CHOWKIDAR_INFLUX_URL must start with http://, https:// or udp://")
+	}
+
+	return &InfluxOutput{
+		URL:    parsed.String(),
+		Token:  strings.TrimSpace(os.Getenv("CHOWKIDAR_INFLUX_TOKEN")),
+		Prefix: strings.TrimSpace(os.Getenv("CHOWKIDAR_INFLUX_PREFIX")),
+		Tags:   AgentLabels(),
+		client: &http.Client{Timeout: influxTimeout},
+	}, nil
+}
+
+// Name identifies the output
+func (o *InfluxOutput) Name() string {
+	return "influx"
+}
+
+// Serialize renders a snapshot as line protocol, one measurement per collector.
+// Empty fields (non-finite values) are left out, and a line with no fields left
+// is skipped.
+func (o *InfluxOutput) Serialize(point models.HistoryPoint) ([]byte, error) {
+	var buf bytes.Buffer
+	ts := strconv.FormatInt(point.Timestamp.UnixNano(), 10)
+	line := func(measurement string, extraTags map[string]string, fields ...string) {
+		kept := fields[:0:0]
+		for _, field := range fields {
+			if field != "" {
+				kept = append(kept, field)
+			}
+		}
+		if len(kept) == 0 {
+			return
+		}
+		buf.WriteString(influxEscape(o.Prefix+measurement, ", "))
+		tags := o.Tags
+		if len(extraTags) > 0 {
+			tags = make(map[string]string, len(o.Tags)+len(extraTags))
+			for key, value := range o.Tags {
+				tags[key] = value
+			}
+			for key, value := range extraTags {
+				tags[key] = value
+			}
+		}
+		for _, key := range sortedLabelKeys(tags) {
+			if tags[key] != "" { // Line protocol has no empty tag values
+				buf.WriteString("," + influxEscape(key, ", =") + "=" + influxEscape(tags[key], ", ="))
+			}
+		}
+		buf.WriteString(" " + strings.Join(kept, ",") + " " + ts + "\n")
+	}
+
+	// One measurement per collector; samples with the same labels share a line, a field each
+	for _, name := range sortedSampleKeys(point.Samples) {
+		order := []string{}
+		labels := map[string]map[string]string{}
+		fields := map[string][]string{}
+		for _, sample := range point.Samples[name] {
+			key := CustomSeriesName("", sample.Labels)
+			if _, seen := fields[key]; !seen {
+				order = append(order, key)
+				labels[key] = sample.Labels
+			}
+			fields[key] = append(fields[key], influxFloat(influxEscape(sample.Name, ", ="), sample.Value))
+		}
+		for _, key := range order {
+			line(name, labels[key], fields[key]...)
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+// Write sends line protocol to InfluxDB
+func (o *InfluxOutput) Write(data []byte) error {
+	if strings.HasPrefix(o.URL, "udp://") {
+		return o.writeUDP(data)
+	}
+
+	req, err := http.NewRequest(http.MethodPost, o.URL, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	if o.Token != "" {
+		req.Header.Set("Authorization", "Token "+o.Token)
+	}
+	resp, err := o.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		return nil
+	case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500:
+		return fmt.Errorf("influx returned %s", resp.Status)
+	default:
+		return fmt.Errorf("%w: influx returned %s: %s", ErrOutputRejected, resp.Status, strings.TrimSpace(string(body)))
+	}
+}
+
+// writeUDP sends line protocol as datagrams, splitting on line boundaries
+func (o *InfluxOutput) writeUDP(data []byte) error {
+	conn, err := net.DialTimeout("udp", strings.TrimPrefix(o.URL, "udp://"), influxTimeout)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	var packet []byte
+	for _, line := range bytes.SplitAfter(data, []byte("\n")) {
+		if len(packet) > 0 && len(packet)+len(line) > influxMaxUDPPayload {
+			if _, err := conn.Write(packet); err != nil {
+				return err
+			}
+			packet = packet[:0]
+		}
+		packet = append(packet, line...)
+	}
+	if len(packet) > 0 {
+		_, err = conn.Write(packet)
+	}
+	return err
+}
+
+// influxEscape backslash-escapes the given special characters
+func influxEscape(value, special string) string {
+	if !strings.ContainsAny(value, special) {
+		return value
+	}
+	var b strings.Builder
+	for _, r := range value {
+		if strings.ContainsRune(special, r) {
+			b.WriteByte('\\')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// influxFloat formats a float field, or returns "" for NaN and ±Inf, which line
+// protocol cannot carry (InfluxDB rejects the whole write)
+func influxFloat(key string, value float64) string {
+	if !finite(value) {
+		return ""
+	}
+	return key + "=" + strconv.FormatFloat(value, 'f', -1, 64)
+}
@@ -0,0 +1,308 @@
+package services
+
+import (
+	"bufio"
+	"chowkidar/internal/models"
+	"errors"
+	"io"
+	"log"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// kernelEventHistorySize is how many parsed kernel events /kernel/events keeps
+const kernelEventHistorySize = 200
+
+// Kernel log patterns. Each captures the victim process/device where the kernel names one.
+var (
+	// "Out of memory: Killed process 1234 (java) total-vm:1234kB, anon-rss:567kB, ..."
+	// "Memory cgroup out of memory: Killed process 1234 (java) ..."
+	oomPattern = regexp.MustCompile(`(?i)out of memory:? (?:killed|kill) process (\d+) \(([^)]*)\)(?:.*?total-vm:(\d+)kB)?(?:.*?anon-rss:(\d+)kB)?`)
+	// "myapp[1234]: segfault at 0 ip 000055d5 sp 00007ffd error 4 in libc.so.6[7f00+1b000]"
+	segfaultPattern = regexp.MustCompile(`(\S+)\[(\d+)\]: segfault at (\S+) ip (\S+) sp (\S+) error (\S+)(?: in (\S+?)\[)?`)
+	// "INFO: task kworker/0:1:123 blocked for more than 120 seconds."
+	hungTaskPattern = regexp.MustCompile(`task (\S+):(\d+) blocked for more than (\d+) seconds`)
+	// "blk_update_request: I/O error, dev sda, sector 1234 op 0x0:(READ)" / "Buffer I/O error on dev sda1, logical block 0"
+	ioErrorPattern = regexp.MustCompile(`I/O error,? (?:on )?dev (\w+)(?:, (sector|logical block) (\d+))?`)
+	// "EXT4-fs (sda1): Remounting filesystem read-only" / "BTRFS info (device sdb): forced readonly"
+	readOnlyPattern = regexp.MustCompile(`(?i)(\w+?)(?:-fs)?(?: \w+)? \((?:device )?([^)]+)\):.*(?:remounting filesystem read-only|forced readonly)`)
+
+	// Prefixes stripped before matching: kmsg record headers, dmesg timestamps, syslog/journal headers
+	kmsgHeaderPattern   = regexp.MustCompile(`^\d+,\d+,\d+,[^;]*;`)
+	dmesgTimePattern    = regexp.MustCompile(`^\[\s*\d+\.\d+\]\s*`)
+	syslogKernelPattern = regexp.MustCompile(`^(?:[A-Z][a-z]{2} [ \d]\d \d{2}:\d{2}:\d{2}|\d{4}-\d{2}-\d{2}T\S+) \S+ kernel: `)
+)
+
+// kernelEvents is the ring buffer behind /kernel/events
+var kernelEvents = struct {
+	sync.Mutex
+	events []models.KernelEvent
+	head   int
+}{}
+
+// StartKernelLogWatcher watches the kernel log for OOM kills, segfaults, hung tasks,
+// I/O errors and read-only remounts. It reads /dev/kmsg, or tails CHOWKIDAR_KMSG_FILE
+// (e.g. a saved dmesg or kern.log) when that is set. Only new messages are reported.
+func StartKernelLogWatcher() {
+	if path := strings.TrimSpace(os.Getenv("CHOWKIDAR_KMSG_FILE")); path != "" {
+		go tailKernelLogFile(path)
+		log.Printf("Kernel log watcher started (file: %s)", path)
+		return
+	}
+
+	f, err := os.Open("/dev/kmsg")
+	if err != nil {
+		log.Printf("⚠️  Kernel log watcher disabled: %v", err)
+		return
+	}
+	// Skip the existing ring buffer; only report what happens from now on
+	if _, err := f.Seek(0, io.SeekEnd); err != nil {
+		log.Printf("⚠️  Kernel log watcher: cannot seek /dev/kmsg: %v", err)
+	}
+	go readKmsg(f)
+	log.Printf("Kernel log watcher started (/dev/kmsg)")
+}
+
+// readKmsg reads /dev/kmsg, where every read returns exactly one record
+func readKmsg(f *os.File) {
+	defer f.Close()
+	buf := make([]byte, 8192)
+	for {
+		n, err := f.Read(buf)
+		if errors.Is(err, syscall.EPIPE) {
+			continue // Records were overwritten before we read them; carry on from the next one
+		}
+		if err != nil {
+			ReportCollectorError("kernel_log", err)
+			return
+		}
+		handleKernelLine(string(buf[:n]), kmsgTimestamp(string(buf[:n])))
+	}
+}
+
+// kmsgTimestamp converts a record's microseconds-since-boot field to wall-clock time
+func kmsgTimestamp(record string) time.Time {
+	fields := strings.SplitN(record, ",", 4)
+	boot := getBootTime()
+	if len(fields) < 4 || boot.IsZero() {
+		return time.Now()
+	}
+	usec, err := strconv.ParseInt(fields[2], 10, 64)
+	if err != nil {
+		return time.Now()
+	}
+	return boot.Add(time.Duration(usec) * time.Microsecond)
+}
+
+// tailKernelLogFile follows a text file from its current end, reopening it when it
+// is truncated or replaced (log rotation)
+func tailKernelLogFile(path string) {
+	var f *os.File
+	var reader *bufio.Reader
+	var offset int64
+
+	open := func(fromEnd bool) bool {
+		if f != nil {
+			f.Close()
+			f = nil
+		}
+		file, err := os.Open(path)
+		if err != nil {
+			ReportCollectorError("kernel_log", err)
+			return false
+		}
+		ReportCollectorOK("kernel_log")
+		offset = 0
+		if fromEnd {
+			if offset, err = file.Seek(0, io.SeekEnd); err != nil {
+				offset = 0
+			}
+		}
+		f, reader = file, bufio.NewReader(file)
+		return true
+	}
+
+	opened := open(true)
+	for {
+		if !opened {
+			time.Sleep(5 * time.Second)
+			opened = open(false)
+			continue
+		}
+
+		line, err := reader.ReadString('\n')
+		if err == nil {
+			offset += int64(len(line))
+			handleKernelLine(line, time.Now())
+			continue
+		}
+		if err != io.EOF {
+			opened = open(false)
+			continue
+		}
+
+		// At EOF: wait for more, then check for truncation or rotation
+		time.Sleep(time.Second)
+		current, statErr := f.Stat()
+		latest, pathErr := os.Stat(path)
+		if statErr != nil || pathErr != nil || !os.SameFile(current, latest) || latest.Size() < offset {
+			opened = open(false)
+		}
+	}
+}
+
+// handleKernelLine parses one kernel message and publishes it if it is one we track
+func handleKernelLine(line string, ts time.Time) {
+	event, ok := ParseKernelLine(kernelMessage(line))
+	if !ok {
+		return
+	}
+	event.Timestamp = ts
+	recordKernelEvent(event)
+}
+
+// kernelMessage strips a kmsg record header, syslog prefix or dmesg timestamp
+func kernelMessage(line string) string {
+	// Keep the first line only; kmsg continuation lines carry key=value metadata
+	if idx := strings.IndexByte(line, '\n'); idx >= 0 {
+		line = line[:idx]
+	}
+	line = kmsgHeaderPattern.ReplaceAllString(line, "")
+	line = syslogKernelPattern.ReplaceAllString(line, "")
+	return strings.TrimSpace(dmesgTimePattern.ReplaceAllString(line, ""))
+}
+
+// ParseKernelLine turns a kernel log message into a KernelEvent if it matches a known pattern
+func ParseKernelLine(line string) (models.KernelEvent, bool) {
+	event := models.KernelEvent{Message: line, Details: map[string]string{}}
+
+	if m := oomPattern.FindStringSubmatch(line); m != nil {
+		event.Type = models.EventOOMKill
+		event.PID = parsePID(m[1])
+		event.Process = m[2]
+		if m[3] != "" {
+			event.Details["total_vm_kb"] = m[3]
+		}
+		if m[4] != "" {
+			event.Details["anon_rss_kb"] = m[4]
+		}
+		if strings.Contains(strings.ToLower(line), "memory cgroup") {
+			event.Details["scope"] = "cgroup"
+		}
+		return event, true
+	}
+	if m := segfaultPattern.FindStringSubmatch(line); m != nil {
+		event.Type = models.EventSegfault
+		event.Process = m[1]
+		event.PID = parsePID(m[2])
+		event.Details["address"] = m[3]
+		event.Details["ip"] = m[4]
+		event.Details["error"] = m[6]
+		if m[7] != "" {
+			event.Details["object"] = m[7]
+		}
+		return event, true
+	}
+	if m := hungTaskPattern.FindStringSubmatch(line); m != nil {
+		event.Type = models.EventHungTask
+		event.Process = m[1]
+		event.PID = parsePID(m[2])
+		event.Details["blocked_seconds"] = m[3]
+		return event, true
+	}
+	if m := readOnlyPattern.FindStringSubmatch(line); m != nil {
+		event.Type = models.EventFilesystemReadOnly
+		event.Device = m[2]
+		event.Details["filesystem"] = strings.ToLower(m[1])
+		return event, true
+	}
+	if m := ioErrorPattern.FindStringSubmatch(line); m != nil {
+		event.Type = models.EventIOError
+		event.Device = m[1]
+		if m[2] == "sector" {
+			event.Details["sector"] = m[3]
+		} else if m[2] != "" {
+			event.Details["block"] = m[3]
+		}
+		return event, true
+	}
+	return models.KernelEvent{}, false
+}
+
+// parsePID converts a matched PID, returning 0 if it is out of range
+func parsePID(s string) int32 {
+	pid, err := strconv.ParseInt(s, 10, 32)
+	if err != nil {
+		return 0
+	}
+	return int32(pid)
+}
+
+// recordKernelEvent stores an event for /kernel/events and publishes it on the event bus
+func recordKernelEvent(event models.KernelEvent) {
+	kernelEvents.Lock()
+	if len(kernelEvents.events) < kernelEventHistorySize {
+		kernelEvents.events = append(kernelEvents.events, event)
+	} else {
+		kernelEvents.events[kernelEvents.head] = event
+		kernelEvents.head = (kernelEvents.head + 1) % kernelEventHistorySize
+	}
+	kernelEvents.Unlock()
+
+	severity := models.SeverityCritical
+	if event.Type == models.EventSegfault || event.Type == models.EventHungTask {
+		severity = models.SeverityWarning
+	}
+	log.Printf("⚠️  Kernel: %s", event.Message)
+
+	attributes := map[string]interface{}{}
+	for k, v := range event.Details {
+		attributes[k] = v
+	}
+	if event.Process != "" {
+		attributes["process"] = event.Process
+	}
+	if event.PID != 0 {
+		attributes["pid"] = event.PID
+	}
+	if event.Device != "" {
+		attributes["device"] = event.Device
+	}
+	PublishEvent(models.Event{
+		Type:       event.Type,
+		Timestamp:  event.Timestamp,
+		Severity:   severity,
+		Source:     "kernel",
+		Message:    event.Message,
+		Attributes: attributes,
+	})
+}
+
+// GetKernelEvents returns recent kernel events, oldest first. since and eventType are optional filters.
+func GetKernelEvents(since time.Time, eventType string, limit int) []models.KernelEvent {
+	kernelEvents.Lock()
+	ordered := make([]models.KernelEvent, 0, len(kernelEvents.events))
+	ordered = append(ordered, kernelEvents.events[kernelEvents.head:]...)
+	ordered = append(ordered, kernelEvents.events[:kernelEvents.head]...)
+	kernelEvents.Unlock()
+
+	events := []models.KernelEvent{}
+	for _, event := range ordered {
+		if !since.IsZero() && event.Timestamp.Before(since) {
+			continue
+		}
+		if eventType != "" && event.Type != eventType {
+			continue
+		}
+		events = append(events, event)
+	}
+	if limit > 0 && len(events) > limit {
+		events = events[len(events)-limit:]
+	}
+	return events
+}
@@ -0,0 +1,140 @@
+package services
+
+import (
+	"chowkidar/internal/models"
+	"reflect"
+	"testing"
+)
+
+func TestKernelMessage(t *testing.T) {
+	tests := []struct {
+		line string
+		want string
+	}{
+		{line: "6,1234,5678901,-;Out of memory: Killed process 1 (init)", want: "Out of memory: Killed process 1 (init)"},
+		{line: "3,901,123456,-,caller=T42;EXT4-fs (sda1): Remounting filesystem read-only\n SUBSYSTEM=block\n DEVICE=b8:1", want: "EXT4-fs (sda1): Remounting filesystem read-only"},
+		{line: "[  123.456789] myapp[1]: segfault at 0", want: "myapp[1]: segfault at 0"},
+		{line: "Oct 18 12:00:00 web-1 kernel: [   12.500000] INFO: task sync:1 blocked for more than 120 seconds.", want: "INFO: task sync:1 blocked for more than 120 seconds."},
+		{line: "2026-10-18T12:00:00.000000+00:00 web-1 kernel: I/O error, dev sda, sector 8", want: "I/O error, dev sda, sector 8"},
+		{line: "Oct  8 12:00:00 web-1 kernel: usb 1-1: new device", want: "usb 1-1: new device"},
+		{line: "2026-10-18T12:00:00+0000 web-1 kernel: usb 1-1: new device", want: "usb 1-1: new device"},
+		{line: "6,1235,5678902,-;audit: comm=\"sh\" msg='kernel: spoofed'", want: "audit: comm=\"sh\" msg='kernel: spoofed'"},
+		{line: "myapp[1]: kernel: I/O error, dev sda", want: "myapp[1]: kernel: I/O error, dev sda"},
+		{line: "Oct 18 12:00:00 web-1 myapp[1]: kernel: I/O error, dev sda", want: "Oct 18 12:00:00 web-1 myapp[1]: kernel: I/O error, dev sda"},
+		{line: "  plain message  ", want: "plain message"},
+	}
+	for _, tt := range tests {
+		if got := kernelMessage(tt.line); got != tt.want {
+			t.Errorf("kernelMessage(%q) = %q, want %q", tt.line, got, tt.want)
+		}
+	}
+}
+
+func TestParseKernelLine(t *testing.T) {
+	tests := []struct {
+		name    string
+		line    string
+		want    models.KernelEvent // Message is the line itself
+		matched bool
+	}{
+		{
+			name:    "oom kill",
+			line:    "Out of memory: Killed process 1234 (java) total-vm:4096000kB, anon-rss:2048000kB, file-rss:0kB, shmem-rss:0kB, UID:1000 pgtables:5000kB oom_score_adj:0",
+			want:    models.KernelEvent{Type: models.EventOOMKill, Process: "java", PID: 1234, Details: map[string]string{"total_vm_kb": "4096000", "anon_rss_kb": "2048000"}},
+			matched: true,
+		},
+		{
+			name:    "cgroup oom kill",
+			line:    "Memory cgroup out of memory: Killed process 4321 (node) total-vm:100kB, anon-rss:50kB",
+			want:    models.KernelEvent{Type: models.EventOOMKill, Process: "node", PID: 4321, Details: map[string]string{"total_vm_kb": "100", "anon_rss_kb": "50", "scope": "cgroup"}},
+			matched: true,
+		},
+		{
+			name:    "older oom kill",
+			line:    "Out of memory: Kill process 999 (mysqld) score 900 or sacrifice child",
+			want:    models.KernelEvent{Type: models.EventOOMKill, Process: "mysqld", PID: 999, Details: map[string]string{}},
+			matched: true,
+		},
+		{
+			name:    "oom kill of a process with spaces",
+			line:    "Out of memory: Killed process 77 (Web Content) total-vm:10kB",
+			want:    models.KernelEvent{Type: models.EventOOMKill, Process: "Web Content", PID: 77, Details: map[string]string{"total_vm_kb": "10"}},
+			matched: true,
+		},
+		{
+			name: "segfault",
+			line: "myapp[1234]: segfault at 0 ip 000055d5c0a1b2c3 sp 00007ffd4e5f6a70 error 4 in libc.so.6[7f0a12345000+1b000]",
+			want: models.KernelEvent{Type: models.EventSegfault, Process: "myapp", PID: 1234,
+				Details: map[string]string{"address": "0", "ip": "000055d5c0a1b2c3", "error": "4", "object": "libc.so.6"}},
+			matched: true,
+		},
+		{
+			name: "segfault without object",
+			line: "a.out[77]: segfault at 8 ip 0000000000401136 sp 00007ffc9d4e0a30 error 6",
+			want: models.KernelEvent{Type: models.EventSegfault, Process: "a.out", PID: 77,
+				Details: map[string]string{"address": "8", "ip": "0000000000401136", "error": "6"}},
+			matched: true,
+		},
+		{
+			name:    "hung task",
+			line:    "INFO: task kworker/0:1:123 blocked for more than 120 seconds.",
+			want:    models.KernelEvent{Type: models.EventHungTask, Process: "kworker/0:1", PID: 123, Details: map[string]string{"blocked_seconds": "120"}},
+			matched: true,
+		},
+		{
+			name:    "io error with sector",
+			line:    "blk_update_request: I/O error, dev sda, sector 1234 op 0x0:(READ) flags 0x0 phys_seg 1 prio class 0",
+			want:    models.KernelEvent{Type: models.EventIOError, Device: "sda", Details: map[string]string{"sector": "1234"}},
+			matched: true,
+		},
+		{
+			name:    "buffer io error",
+			line:    "Buffer I/O error on dev sda1, logical block 0, async page read",
+			want:    models.KernelEvent{Type: models.EventIOError, Device: "sda1", Details: map[string]string{"block": "0"}},
+			matched: true,
+		},
+		{
+			name:    "io error without location",
+			line:    "I/O error, dev nvme0n1",
+			want:    models.KernelEvent{Type: models.EventIOError, Device: "nvme0n1", Details: map[string]string{}},
+			matched: true,
+		},
+		{
+			name:    "ext4 read-only",
+			line:    "EXT4-fs (sda1): Remounting filesystem read-only",
+			want:    models.KernelEvent{Type: models.EventFilesystemReadOnly, Device: "sda1", Details: map[string]string{"filesystem": "ext4"}},
+			matched: true,
+		},
+		{
+			name:    "ext4 error then read-only",
+			line:    "EXT4-fs error (device dm-0): ext4_journal_check_start:83: Detected aborted journal, remounting filesystem read-only",
+			want:    models.KernelEvent{Type: models.EventFilesystemReadOnly, Device: "dm-0", Details: map[string]string{"filesystem": "ext4"}},
+			matched: true,
+		},
+		{
+			name:    "btrfs read-only",
+			line:    "BTRFS info (device sdb): forced readonly",
+			want:    models.KernelEvent{Type: models.EventFilesystemReadOnly, Device: "sdb", Details: map[string]string{"filesystem": "btrfs"}},
+			matched: true,
+		},
+		{name: "ext4 error without remount", line: "EXT4-fs error (device sda1): ext4_find_entry:1455: inode #2: comm ls: reading directory lblock 0"},
+		{name: "usb", line: "usb 1-1: new high-speed USB device number 2 using xhci_hcd"},
+		{name: "oom report header", line: "java invoked oom-killer: gfp_mask=0x100cca(GFP_HIGHUSER_MOVABLE), order=0, oom_score_adj=0"},
+		{name: "empty", line: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, matched := ParseKernelLine(tt.line)
+			if matched != tt.matched {
+				t.Fatalf("ParseKernelLine(%q) matched = %v, want %v (%+v)", tt.line, matched, tt.matched, got)
+			}
+			if !matched {
+				return
+			}
+			tt.want.Message = tt.line
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseKernelLine(%q) = %+v, want %+v", tt.line, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,31 @@
+package services
+
+import (
+	"chowkidar/internal/models"
+	"time"
+
+	"github.com/shirou/gopsutil/v3/load"
+)
+
+// loadCollector reports the 1, 5 and 15 minute load averages
+type loadCollector struct{}
+
+func init() {
+	RegisterCollector(loadCollector{})
+}
+
+func (loadCollector) Name() string            { return "load" }
+func (loadCollector) Description() string     { return "System load averages over 1, 5 and 15 minutes" }
+func (loadCollector) Interval() time.Duration { return 10 * time.Second }
+
+func (loadCollector) Collect() ([]models.Sample, error) {
+	avg, err := load.Avg()
+	if err != nil {
+		return nil, err
+	}
+	return []models.Sample{
+		{Name: "load1", Kind: models.SampleGauge, Unit: "1", Value: avg.Load1},
+		{Name: "load5", Kind: models.SampleGauge, Unit: "1", Value: avg.Load5},
+		{Name: "load15", Kind: models.SampleGauge, Unit: "1", Value: avg.Load15},
+	}, nil
+}
@@ -0,0 +1,440 @@
+package services
+
+import (
+	"chowkidar/internal/models"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// LockoutRule bans an IP once it reaches Threshold failures inside Window
+type LockoutRule struct {
+	Threshold int
+	Window    time.Duration
+}
+
+// LockoutService tracks failed authentication per IP and issues temporary bans
+type LockoutService struct {
+	mu          sync.Mutex
+	rules       []LockoutRule
+	failures    map[string][]time.Time      // Failure timestamps per IP (sliding windows)
+	bans        map[string]*models.BanEntry // Active and recently expired bans (keeps strike history)
+	baseBan     time.Duration               // First ban duration, doubled for each strike
+	maxBan      time.Duration               // Upper bound for the exponential backoff
+	strikeDecay time.Duration               // Quiet period after which strikes reset
+	path        string                      // Ban file, shared with the --list-bans/--unban CLI
+	loadedMod   time.Time                   // Modification time of the ban file we last read or wrote
+	running     bool
+}
+
+var lockoutService *LockoutService
+
+// InitLockoutService initializes the lockout service and loads persisted bans.
+// Rules and durations come from CHOWKIDAR_LOCKOUT_RULES, CHOWKIDAR_LOCKOUT_BAN_BASE
+// and CHOWKIDAR_LOCKOUT_BAN_MAX; an empty path uses CHOWKIDAR_BANS_FILE or the default location.
+func InitLockoutService(path string) *LockoutService {
+	if path == "" {
+		path = strings.TrimSpace(os.Getenv("CHOWKIDAR_BANS_FILE"))
+	}
+	if path == "" {
+		path = defaultStateFile("bans.json")
+	}
+
+	rules, err := ParseLockoutRules(os.Getenv("CHOWKIDAR_LOCKOUT_RULES"))
+	if err != nil {
+		log.Printf("⚠️  Invalid CHOWKIDAR_LOCKOUT_RULES (%v), using defaults", err)
+		rules, _ = ParseLockoutRules("")
+	}
+
+	ls := &LockoutService{
+		rules:       rules,
+		failures:    make(map[string][]time.Time),
+		bans:        make(map[string]*models.BanEntry),
+		baseBan:     durationFromEnv("CHOWKIDAR_LOCKOUT_BAN_BASE", 5*time.Minute),
+		maxBan:      durationFromEnv("CHOWKIDAR_LOCKOUT_BAN_MAX", 24*time.Hour),
+		strikeDecay: 24 * time.Hour,
+		path:        path,
+	}
+	if ls.maxBan < ls.baseBan {
+		ls.maxBan = ls.baseBan
+	}
+
+	ls.mu.Lock()
+	if err := ls.load(); err != nil {
+		log.Printf("⚠️  Warning: Could not load bans from %s: %v", path, err)
+	}
+	ls.mu.Unlock()
+
+	lockoutService = ls
+	return ls
+}
+
+// GetLockoutService returns the initialized lockout service
+func GetLockoutService() *LockoutService {
+	return lockoutService
+}
+
+// StartLockoutJanitor periodically prunes expired state and picks up CLI edits of the ban file
+func StartLockoutJanitor(interval time.Duration) {
+	ls := lockoutService
+	if ls == nil {
+		return
+	}
+
+	ls.mu.Lock()
+	if ls.running {
+		ls.mu.Unlock()
+		return
+	}
+	ls.running = true
+	ls.mu.Unlock()
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			ls.mu.Lock()
+			ls.reloadIfChanged()
+			ls.prune(time.Now())
+			ls.mu.Unlock()
+		}
+	}()
+}
+
+// ParseLockoutRules parses "threshold/window" pairs, e.g. "5/1m,20/1h"
+func ParseLockoutRules(spec string) ([]LockoutRule, error) {
+	if strings.TrimSpace(spec) == "" {
+		spec = "5/1m,20/1h"
+	}
+
+	rules := []LockoutRule{}
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		pieces := strings.SplitN(part, "/", 2)
+		if len(pieces) != 2 {
+			return nil, fmt.Errorf("rule %q must be threshold/window", part)
+		}
+		threshold, err := strconv.Atoi(strings.TrimSpace(pieces[0]))
+		if err != nil || threshold < 1 {
+			return nil, fmt.Errorf("rule %q has an invalid threshold", part)
+		}
+		window, err := time.ParseDuration(strings.TrimSpace(pieces[1]))
+		if err != nil || window <= 0 {
+			return nil, fmt.Errorf("rule %q has an invalid window", part)
+		}
+		rules = append(rules, LockoutRule{Threshold: threshold, Window: window})
+	}
+	if len(rules) == 0 {
+		return nil, fmt.Errorf("no rules configured")
+	}
+	return rules, nil
+}
+
+// RecordAuthFailure counts a failed authentication and bans the IP when a rule trips.
+// Returns the ban entry if the IP is (now) banned.
+func RecordAuthFailure(ip string, reason string) *models.BanEntry {
+	ls := lockoutService
+	if ls == nil || ip == "" {
+		return nil
+	}
+
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+	return ls.recordFailure(ip, reason, time.Now())
+}
+
+// recordFailure is RecordAuthFailure at a given time. Caller must hold ls.mu.
+func (ls *LockoutService) recordFailure(ip string, reason string, now time.Time) *models.BanEntry {
+	// The ban file is reloaded by the janitor and before bans, keeping disk I/O off this path
+	if ban, exists := ls.bans[ip]; exists && ban.Active(now) {
+		entry := *ban
+		return &entry
+	}
+
+	// Keep only failures inside the longest window
+	longest := time.Duration(0)
+	for _, rule := range ls.rules {
+		if rule.Window > longest {
+			longest = rule.Window
+		}
+	}
+	recent := ls.failures[ip][:0]
+	for _, t := range ls.failures[ip] {
+		if now.Sub(t) < longest {
+			recent = append(recent, t)
+		}
+	}
+	recent = append(recent, now)
+	ls.failures[ip] = recent
+
+	for _, rule := range ls.rules {
+		count := 0
+		for _, t := range recent {
+			if now.Sub(t) < rule.Window {
+				count++
+			}
+		}
+		if count >= rule.Threshold {
+			ban := ls.ban(ip, fmt.Sprintf("%d failed authentications in %s (last: %s)", count, rule.Window, reason), now)
+			entry := *ban
+			return &entry
+		}
+	}
+
+	return nil
+}
+
+// ban issues or extends a ban with exponential backoff. Caller must hold ls.mu.
+func (ls *LockoutService) ban(ip string, reason string, now time.Time) *models.BanEntry {
+	// Pick up CLI edits (e.g. --unban) first, or saving would write the stale map back
+	ls.reloadIfChanged()
+
+	ban, exists := ls.bans[ip]
+	if !exists {
+		ban = &models.BanEntry{IP: ip}
+		ls.bans[ip] = ban
+	}
+	if !ban.LastStrike.IsZero() && now.Sub(ban.LastStrike) > ls.strikeDecay {
+		ban.Strikes = 0
+	}
+	ban.Strikes++
+
+	duration := ls.baseBan
+	for i := 1; i < ban.Strikes && duration < ls.maxBan; i++ {
+		duration *= 2
+	}
+	if duration > ls.maxBan {
+		duration = ls.maxBan
+	}
+
+	ban.Reason = reason
+	ban.BannedAt = now
+	ban.ExpiresAt = now.Add(duration)
+	ban.LastStrike = now
+	delete(ls.failures, ip)
+
+	log.Printf("[SECURITY] Banned IP %s for %s (strike %d): %s", ip, duration, ban.Strikes, reason)
+	RecordAudit(models.AuditEvent{
+		Type:    "ip_banned",
+		Outcome: AuditDenied,
+		IP:      ip,
+		Reason:  reason,
+		Details: map[string]string{
+			"duration":   duration.String(),
+			"strikes":    strconv.Itoa(ban.Strikes),
+			"expires_at": ban.ExpiresAt.UTC().Format(time.RFC3339),
+		},
+	})
+	if err := ls.save(); err != nil {
+		log.Printf("⚠️  Warning: Could not persist bans to %s: %v", ls.path, err)
+	}
+	return ban
+}
+
+// IsBanned returns the active ban for an IP, if any
+func IsBanned(ip string) (*models.BanEntry, bool) {
+	ls := lockoutService
+	if ls == nil {
+		return nil, false
+	}
+
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+
+	ban, exists := ls.bans[ip]
+	if !exists || !ban.Active(time.Now()) {
+		return nil, false
+	}
+	entry := *ban
+	return &entry, true
+}
+
+// ListBans returns all active bans sorted by expiry
+func ListBans() []models.BanEntry {
+	ls := lockoutService
+	if ls == nil {
+		return []models.BanEntry{}
+	}
+
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+	ls.reloadIfChanged()
+
+	now := time.Now()
+	bans := []models.BanEntry{}
+	for _, ban := range ls.bans {
+		if ban.Active(now) {
+			bans = append(bans, *ban)
+		}
+	}
+	sort.Slice(bans, func(i, j int) bool {
+		return bans[i].ExpiresAt.Before(bans[j].ExpiresAt)
+	})
+	return bans
+}
+
+// Unban lifts a ban and resets the IP's failure count and strikes.
+// Returns false if the IP had no ban on record.
+func Unban(ip string) (bool, error) {
+	ls := lockoutService
+	if ls == nil {
+		return false, fmt.Errorf("lockout service not initialized")
+	}
+
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+	ls.reloadIfChanged()
+
+	_, exists := ls.bans[ip]
+	delete(ls.bans, ip)
+	delete(ls.failures, ip)
+	if !exists {
+		return false, nil
+	}
+
+	log.Printf("[SECURITY] Unbanned IP %s", ip)
+	RecordAudit(models.AuditEvent{
+		Type:    "ip_unbanned",
+		Outcome: AuditSuccess,
+		IP:      ip,
+	})
+	return true, ls.save()
+}
+
+// prune drops expired failure windows and ban entries whose strikes have decayed. Caller must hold ls.mu.
+func (ls *LockoutService) prune(now time.Time) {
+	longest := time.Duration(0)
+	for _, rule := range ls.rules {
+		if rule.Window > longest {
+			longest = rule.Window
+		}
+	}
+	for ip, times := range ls.failures {
+		if len(times) == 0 || now.Sub(times[len(times)-1]) >= longest {
+			delete(ls.failures, ip)
+		}
+	}
+
+	changed := false
+	for ip, ban := range ls.bans {
+		if !ban.Active(now) && now.Sub(ban.LastStrike) > ls.strikeDecay {
+			delete(ls.bans, ip)
+			changed = true
+		}
+	}
+	if changed {
+		if err := ls.save(); err != nil {
+			log.Printf("⚠️  Warning: Could not persist bans to %s: %v", ls.path, err)
+		}
+	}
+}
+
+// load reads the ban file. Caller must hold ls.mu.
+func (ls *LockoutService) load() error {
+	info, err := os.Stat(ls.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	data, err := os.ReadFile(ls.path)
+	if err != nil {
+		return err
+	}
+
+	entries := []models.BanEntry{}
+	if len(strings.TrimSpace(string(data))) > 0 {
+		if err := json.Unmarshal(data, &entries); err != nil {
+			return err
+		}
+	}
+
+	ls.bans = make(map[string]*models.BanEntry, len(entries))
+	for i := range entries {
+		ls.bans[entries[i].IP] = &entries[i]
+	}
+	ls.loadedMod = info.ModTime()
+	return nil
+}
+
+// reloadIfChanged reloads the ban file when another process (the CLI) modified it. Caller must hold ls.mu.
+func (ls *LockoutService) reloadIfChanged() {
+	info, err := os.Stat(ls.path)
+	if err != nil || info.ModTime().Equal(ls.loadedMod) {
+		return
+	}
+	if err := ls.load(); err != nil {
+		log.Printf("⚠️  Warning: Could not reload bans from %s: %v", ls.path, err)
+	}
+}
+
+// save writes the ban file atomically. Caller must hold ls.mu.
+func (ls *LockoutService) save() error {
+	entries := make([]models.BanEntry, 0, len(ls.bans))
+	for _, ban := range ls.bans {
+		entries = append(entries, *ban)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].IP < entries[j].IP
+	})
+
+	data, err := json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(ls.path), 0700); err != nil {
+		return err
+	}
+	tmp := ls.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, ls.path); err != nil {
+		return err
+	}
+
+	if info, err := os.Stat(ls.path); err == nil {
+		ls.loadedMod = info.ModTime()
+	}
+	return nil
+}
+
+// defaultStateFile returns where agent state files live: /etc/chowkidar when it
+// exists (systemd install), otherwise ~/.chowkidar, falling back to the temp dir.
+func defaultStateFile(name string) string {
+	if info, err := os.Stat("/etc/chowkidar"); err == nil && info.IsDir() {
+		return filepath.Join("/etc/chowkidar", name)
+	}
+	if homeDir, err := os.UserHomeDir(); err == nil && homeDir != "" {
+		return filepath.Join(homeDir, ".chowkidar", name)
+	}
+	return filepath.Join(os.TempDir(), "chowkidar", name)
+}
+
+// durationFromEnv reads a duration from an environment variable, falling back on parse errors
+func durationFromEnv(name string, fallback time.Duration) time.Duration {
+	value := strings.TrimSpace(os.Getenv(name))
+	if value == "" {
+		return fallback
+	}
+	parsed, err := time.ParseDuration(value)
+	if err != nil || parsed <= 0 {
+		log.Printf("⚠️  Invalid %s=%q, using %s", name, value, fallback)
+		return fallback
+	}
+	return parsed
+}
@@ -0,0 +1,181 @@
+package services
+
+import (
+	"chowkidar/internal/models"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// newTestLockout returns a lockout service with a 1m base ban, a 5m cap, a 1h
+// strike decay and a ban file in a temp dir
+func newTestLockout(t *testing.T, spec string) *LockoutService {
+	t.Helper()
+	rules, err := ParseLockoutRules(spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &LockoutService{
+		rules:       rules,
+		failures:    map[string][]time.Time{},
+		bans:        map[string]*models.BanEntry{},
+		baseBan:     time.Minute,
+		maxBan:      5 * time.Minute,
+		strikeDecay: time.Hour,
+		path:        filepath.Join(t.TempDir(), "bans.json"),
+	}
+}
+
+func TestParseLockoutRules(t *testing.T) {
+	tests := []struct {
+		spec    string
+		want    []LockoutRule
+		wantErr bool
+	}{
+		{spec: "", want: []LockoutRule{{5, time.Minute}, {20, time.Hour}}},
+		{spec: " 3/30s , 10/10m ,", want: []LockoutRule{{3, 30 * time.Second}, {10, 10 * time.Minute}}},
+		{spec: "5", wantErr: true},
+		{spec: "0/1m", wantErr: true},
+		{spec: "x/1m", wantErr: true},
+		{spec: "5/0s", wantErr: true},
+		{spec: "5/soon", wantErr: true},
+		{spec: ",", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := ParseLockoutRules(tt.spec)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("ParseLockoutRules(%q) = %v, want an error", tt.spec, got)
+			}
+			continue
+		}
+		if err != nil || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ParseLockoutRules(%q) = %v, %v, want %v", tt.spec, got, err, tt.want)
+		}
+	}
+}
+
+func TestLockoutSlidingWindows(t *testing.T) {
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name  string
+		at    []time.Duration // Failure times after start
+		spec  string
+		trips int // Failure (1-based) that issues the ban, 0 for none
+	}{
+		{name: "burst", spec: "3/1m", at: []time.Duration{0, time.Second, 2 * time.Second}, trips: 3},
+		{name: "window slides past old failures", spec: "3/1m", at: []time.Duration{0, 30 * time.Second, 60 * time.Second, 91 * time.Second}, trips: 0},
+		{name: "window edge", spec: "3/1m", at: []time.Duration{0, 30 * time.Second, 59 * time.Second}, trips: 3},
+		{name: "slow rule", spec: "3/1m,4/1h", at: []time.Duration{0, 10 * time.Minute, 20 * time.Minute, 30 * time.Minute}, trips: 4},
+		{name: "outside every window", spec: "3/1m,4/1h", at: []time.Duration{0, 30 * time.Minute, 61 * time.Minute, 92 * time.Minute}, trips: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ls := newTestLockout(t, tt.spec)
+			trips := 0
+			for i, offset := range tt.at {
+				if ban := ls.recordFailure("203.0.113.1", "bad token", start.Add(offset)); ban != nil && trips == 0 {
+					trips = i + 1
+				}
+			}
+			if trips != tt.trips {
+				t.Errorf("ban issued on failure %d, want %d", trips, tt.trips)
+			}
+		})
+	}
+}
+
+func TestLockoutBackoff(t *testing.T) {
+	ls := newTestLockout(t, "1/1m")
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		wait     time.Duration // After the previous ban expires; strikes decay an hour after the last one
+		strikes  int
+		duration time.Duration
+	}{
+		{strikes: 1, duration: time.Minute},
+		{wait: time.Second, strikes: 2, duration: 2 * time.Minute},
+		{wait: time.Second, strikes: 3, duration: 4 * time.Minute},
+		{wait: time.Second, strikes: 4, duration: 5 * time.Minute},      // Capped at maxBan
+		{wait: 54 * time.Minute, strikes: 5, duration: 5 * time.Minute}, // 59m after the last strike
+		{wait: 2 * time.Hour, strikes: 1, duration: time.Minute},        // Strikes decayed
+	}
+	for i, tt := range tests {
+		now = now.Add(tt.wait)
+		ban := ls.recordFailure("203.0.113.1", "bad token", now)
+		if ban == nil {
+			t.Fatalf("ban %d: not issued", i+1)
+		}
+		if ban.Strikes != tt.strikes || ban.ExpiresAt.Sub(ban.BannedAt) != tt.duration {
+			t.Errorf("ban %d: strike %d for %s, want strike %d for %s", i+1, ban.Strikes, ban.ExpiresAt.Sub(ban.BannedAt), tt.strikes, tt.duration)
+		}
+
+		// Failures during the ban neither count nor extend it
+		if during := ls.recordFailure("203.0.113.1", "bad token", now.Add(time.Second)); during == nil || !during.ExpiresAt.Equal(ban.ExpiresAt) {
+			t.Errorf("ban %d: failure during the ban returned %+v", i+1, during)
+		}
+		now = ban.ExpiresAt
+	}
+}
+
+func TestLockoutPersistence(t *testing.T) {
+	ls := newTestLockout(t, "1/1m")
+	now := time.Now().Truncate(time.Second).UTC()
+	first := ls.recordFailure("203.0.113.1", "bad token", now)
+	if first == nil {
+		t.Fatal("ban not issued")
+	}
+
+	// A restarted agent reads the same bans back
+	reloaded := newTestLockout(t, "1/1m")
+	reloaded.path = ls.path
+	if err := reloaded.load(); err != nil {
+		t.Fatal(err)
+	}
+	if got := reloaded.bans["203.0.113.1"]; got == nil || !reflect.DeepEqual(*got, *first) {
+		t.Errorf("reloaded ban = %+v, want %+v", got, first)
+	}
+
+	// The CLI lifts the ban by rewriting the file; the next ban must not restore it
+	if err := os.WriteFile(ls.path, []byte("[]"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	later := time.Now().Add(time.Minute)
+	if err := os.Chtimes(ls.path, later, later); err != nil {
+		t.Fatal(err)
+	}
+	if ls.recordFailure("198.51.100.2", "bad token", now) == nil {
+		t.Fatal("second ban not issued")
+	}
+	if err := reloaded.load(); err != nil {
+		t.Fatal(err)
+	}
+	if _, exists := reloaded.bans["203.0.113.1"]; exists {
+		t.Error("a ban issued after --unban wrote the lifted ban back")
+	}
+	if _, exists := reloaded.bans["198.51.100.2"]; !exists {
+		t.Error("the new ban was not saved")
+	}
+}
+
+func TestLockoutPrune(t *testing.T) {
+	ls := newTestLockout(t, "2/1m")
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	ls.recordFailure("203.0.113.1", "bad token", now)
+	ls.recordFailure("198.51.100.2", "bad token", now)
+	ls.recordFailure("198.51.100.2", "bad token", now) // Banned for 1m
+
+	ls.prune(now.Add(2 * time.Minute))
+	if len(ls.failures) != 0 {
+		t.Errorf("failures outside every window kept: %v", ls.failures)
+	}
+	if _, exists := ls.bans["198.51.100.2"]; !exists {
+		t.Error("expired ban dropped before its strikes decayed")
+	}
+	ls.prune(now.Add(2 * time.Hour))
+	if len(ls.bans) != 0 {
+		t.Errorf("bans kept after strike decay: %v", ls.bans)
+	}
+}
@@ -0,0 +1,30 @@
+package services
+
+import (
+	"chowkidar/internal/models"
+	"time"
+)
+
+// memoryCollector reports physical memory usage
+type memoryCollector struct{}
+
+func init() {
+	RegisterCollector(memoryCollector{})
+}
+
+func (memoryCollector) Name() string            { return TopicMemory }
+func (memoryCollector) Description() string     { return "Physical memory usage" }
+func (memoryCollector) Interval() time.Duration { return 10 * time.Second }
+
+func (memoryCollector) Collect() ([]models.Sample, error) {
+	memory, err := GetCachedMemory()
+	if err != nil {
+		return nil, err
+	}
+	return []models.Sample{
+		{Name: "total_bytes", Kind: models.SampleGauge, Unit: "By", Value: float64(int64(memory.TotalGB * GB))},
+		{Name: "used_bytes", Kind: models.SampleGauge, Unit: "By", Value: float64(int64(memory.UsedGB * GB))},
+		{Name: "available_bytes", Kind: models.SampleGauge, Unit: "By", Value: float64(int64(memory.AvailableGB * GB))},
+		{Name: "usage_percent", Kind: models.SampleGauge, Unit: "%", Value: memory.UsagePercent},
+	}, nil
+}
@@ -21,6 +21,10 @@ import (
 
 const GB = 1024 * 1024 * 1024
 
+// AgentVersion is reported to exporters; release builds set it with
+// -ldflags "-X chowkidar/internal/services.AgentVersion=1.2.3"
+var AgentVersion = "dev"
+
 // CPU Info cache
 var (
 	cpuInfoCache *models.CPUInfo
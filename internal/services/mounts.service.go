@@ -0,0 +1,83 @@
+package services
+
+import (
+	"chowkidar/internal/models"
+	"log"
+	"time"
+
+	"github.com/shirou/gopsutil/v3/disk"
+)
+
+// StartMountWatcher polls the mount table and publishes mount_added/mount_removed events
+func StartMountWatcher(interval time.Duration) {
+	go func() {
+		known, err := currentMounts()
+		if err != nil {
+			ReportCollectorError("mounts", err)
+		}
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			mounts, err := currentMounts()
+			if err != nil {
+				ReportCollectorError("mounts", err)
+				continue
+			}
+			ReportCollectorOK("mounts")
+
+			if known != nil {
+				diffMounts(known, mounts)
+			}
+			known = mounts
+		}
+	}()
+
+	log.Printf("Mount watcher started (interval: %v)", interval)
+}
+
+// currentMounts returns the mounted filesystems keyed by mount point
+func currentMounts() (map[string]disk.PartitionStat, error) {
+	partitions, err := disk.Partitions(false)
+	if err != nil {
+		return nil, err
+	}
+	mounts := make(map[string]disk.PartitionStat, len(partitions))
+	for _, p := range partitions {
+		mounts[p.Mountpoint] = p
+	}
+	return mounts, nil
+}
+
+// diffMounts publishes an event for every mount point that appeared or disappeared
+func diffMounts(before, after map[string]disk.PartitionStat) {
+	for mountpoint, p := range after {
+		if _, existed := before[mountpoint]; !existed {
+			publishMount(models.EventMountAdded, p)
+		}
+	}
+	for mountpoint, p := range before {
+		if _, exists := after[mountpoint]; !exists {
+			publishMount(models.EventMountRemoved, p)
+		}
+	}
+}
+
+// publishMount publishes a mount event for a partition
+func publishMount(eventType string, p disk.PartitionStat) {
+	verb := "mounted"
+	if eventType == models.EventMountRemoved {
+		verb = "unmounted"
+	}
+	PublishEvent(models.Event{
+		Type:    eventType,
+		Source:  "mounts",
+		Message: p.Device + " " + verb + " at " + p.Mountpoint,
+		Attributes: map[string]interface{}{
+			"device":     p.Device,
+			"mountpoint": p.Mountpoint,
+			"fstype":     p.Fstype,
+		},
+	})
+}
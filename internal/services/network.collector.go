@@ -0,0 +1,41 @@
+package services
+
+import (
+	"chowkidar/internal/models"
+	"time"
+)
+
+// networkCollector reports traffic counters per network interface
+type networkCollector struct{}
+
+func init() {
+	RegisterCollector(networkCollector{})
+}
+
+func (networkCollector) Name() string            { return TopicNetwork }
+func (networkCollector) Description() string     { return "Network traffic counters, per interface" }
+func (networkCollector) Interval() time.Duration { return 10 * time.Second }
+
+func (networkCollector) Collect() ([]models.Sample, error) {
+	interfaces, err := GetCachedNetwork()
+	if err != nil {
+		return nil, err
+	}
+
+	samples := make([]models.Sample, 0, 8*len(interfaces))
+	for _, iface := range interfaces {
+		labels := map[string]string{"interface": iface.Interface}
+		counter := func(name, unit string, value uint64) {
+			samples = append(samples, models.Sample{Name: name, Kind: models.SampleCounter, Unit: unit, Labels: labels, Value: float64(value)})
+		}
+		counter("bytes_sent", "By", iface.BytesSent)
+		counter("bytes_recv", "By", iface.BytesRecv)
+		counter("packets_sent", "1", iface.PacketsSent)
+		counter("packets_recv", "1", iface.PacketsRecv)
+		counter("errors_in", "1", iface.ErrorsIn)
+		counter("errors_out", "1", iface.ErrorsOut)
+		counter("drops_in", "1", iface.DropsIn)
+		counter("drops_out", "1", iface.DropsOut)
+	}
+	return samples, nil
+}
@@ -0,0 +1,415 @@
+package services
+
+import (
+	"bytes"
+	"chowkidar/internal/models"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// OTLP export settings
+const (
+	otlpTimeout   = 10 * time.Second
+	otlpScopeName = "chowkidar"
+)
+
+// OTLP aggregation temporality (opentelemetry.proto.metrics.v1.AggregationTemporality)
+const otlpCumulative = 2
+
+// OTLPExporter periodically sends the agent's metrics to an OpenTelemetry
+// collector using OTLP/HTTP with JSON encoding. Payloads are queued on disk
+// and retried while the collector is unreachable.
+type OTLPExporter struct {
+	Endpoint string            // Full URL, e.g. http://collector:4318/v1/metrics
+	Headers  map[string]string // Extra request headers (API keys)
+	Interval time.Duration
+
+	resource otlpResource
+	client   *http.Client
+	queue    *OutboundQueue
+}
+
+// OTLP/JSON wire types (opentelemetry-proto, JSON mapping)
+type (
+	otlpRequest struct {
+		ResourceMetrics []otlpResourceMetrics `json:"resourceMetrics"`
+	}
+	otlpResourceMetrics struct {
+		Resource     otlpResource       `json:"resource"`
+		ScopeMetrics []otlpScopeMetrics `json:"scopeMetrics"`
+	}
+	otlpResource struct {
+		Attributes []otlpKeyValue `json:"attributes"`
+	}
+	otlpScopeMetrics struct {
+		Scope   otlpScope    `json:"scope"`
+		Metrics []otlpMetric `json:"metrics"`
+	}
+	otlpScope struct {
+		Name    string `json:"name"`
+		Version string `json:"version,omitempty"`
+	}
+	otlpMetric struct {
+		Name        string     `json:"name"`
+		Description string     `json:"description,omitempty"`
+		Unit        string     `json:"unit,omitempty"`
+		Gauge       *otlpGauge `json:"gauge,omitempty"`
+		Sum         *otlpSum   `json:"sum,omitempty"`
+	}
+	otlpGauge struct {
+		DataPoints []otlpDataPoint `json:"dataPoints"`
+	}
+	otlpSum struct {
+		DataPoints             []otlpDataPoint `json:"dataPoints"`
+		AggregationTemporality int             `json:"aggregationTemporality"`
+		IsMonotonic            bool            `json:"isMonotonic"`
+	}
+	otlpDataPoint struct {
+		Attributes        []otlpKeyValue `json:"attributes,omitempty"`
+		StartTimeUnixNano string         `json:"startTimeUnixNano,omitempty"`
+		TimeUnixNano      string         `json:"timeUnixNano"`
+		AsDouble          *float64       `json:"asDouble,omitempty"`
+		AsInt             string         `json:"asInt,omitempty"` // int64 values are strings in OTLP/JSON
+	}
+	otlpKeyValue struct {
+		Key   string       `json:"key"`
+		Value otlpAnyValue `json:"value"`
+	}
+	otlpAnyValue struct {
+		StringValue *string `json:"stringValue,omitempty"`
+		IntValue    string  `json:"intValue,omitempty"`
+	}
+)
+
+var otlpExporter *OTLPExporter
+
+// StartOTLPExporter starts exporting when CHOWKIDAR_OTLP_ENDPOINT (or the standard
+// OTEL_EXPORTER_OTLP_ENDPOINT) or CHOWKIDAR_OTLP_METRICS_ENDPOINT (or
+// OTEL_EXPORTER_OTLP_METRICS_ENDPOINT) is set. Headers come from CHOWKIDAR_OTLP_HEADERS
+// (or OTEL_EXPORTER_OTLP_HEADERS) as "key=value,key2=value2".
+func StartOTLPExporter() (*OTLPExporter, error) {
+	metricsEndpoint := envWithFallback("CHOWKIDAR_OTLP_METRICS_ENDPOINT", "OTEL_EXPORTER_OTLP_METRICS_ENDPOINT")
+	baseEndpoint := envWithFallback("CHOWKIDAR_OTLP_ENDPOINT", "OTEL_EXPORTER_OTLP_ENDPOINT")
+	if metricsEndpoint == "" && baseEndpoint == "" {
+		return nil, nil
+	}
+	endpoint, err := otlpMetricsURL(baseEndpoint, metricsEndpoint)
+	if err != nil {
+		return nil, err
+	}
+	headers, err := parseOTLPHeaders(envWithFallback("CHOWKIDAR_OTLP_HEADERS", "OTEL_EXPORTER_OTLP_HEADERS"))
+	if err != nil {
+		return nil, err
+	}
+	queue, err := NewOutboundQueue("otlp")
+	if err != nil {
+		return nil, fmt.Errorf("could not open otlp queue: %w", err)
+	}
+
+	otlpExporter = &OTLPExporter{
+		Endpoint: endpoint,
+		Headers:  headers,
+		Interval: durationFromEnv("CHOWKIDAR_OTLP_INTERVAL", time.Minute),
+		resource: otlpHostResource(),
+		client:   &http.Client{Timeout: otlpTimeout},
+		queue:    queue,
+	}
+	go otlpExporter.produce()
+	go drainQueue("otlp", queue, otlpExporter.write)
+	return otlpExporter, nil
+}
+
+// produce queues a metrics payload now and every Interval after
+func (e *OTLPExporter) produce() {
+	ticker := time.NewTicker(e.Interval)
+	defer ticker.Stop()
+	for {
+		stats := GetWebSocketHub().backgroundStats()
+		data, err := json.Marshal(e.buildRequest(stats))
+		if err == nil {
+			err = e.queue.Push(data)
+		}
+		if err != nil {
+			ReportCollectorError("otlp", err)
+		}
+		<-ticker.C
+	}
+}
+
+// write sends one payload; payloads the collector refuses are wrapped in ErrOutputRejected
+func (e *OTLPExporter) write(data []byte) error {
+	req, err := http.NewRequest(http.MethodPost, e.Endpoint, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "chowkidar/"+AgentVersion)
+	for key, value := range e.Headers {
+		req.Header.Set(key, value)
+	}
+
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		return nil
+	case resp.StatusCode == http.StatusTooManyRequests, resp.StatusCode == http.StatusBadGateway,
+		resp.StatusCode == http.StatusServiceUnavailable, resp.StatusCode == http.StatusGatewayTimeout:
+		return fmt.Errorf("collector returned %s", resp.Status)
+	default:
+		return fmt.Errorf("%w: collector returned %s: %s", ErrOutputRejected, resp.Status, strings.TrimSpace(string(body)))
+	}
+}
+
+// otlpConvention maps a collector sample onto an OpenTelemetry semantic-convention metric
+type otlpConvention struct {
+	name    string
+	unit    string
+	scale   float64           // Multiplies the value, e.g. 0.01 to turn a percentage into a ratio
+	sum     bool              // An amount (non-monotonic sum) rather than a gauge; counters are always monotonic sums
+	labels  map[string]string // Sample label -> attribute; other labels are dropped
+	integer map[string]bool   // Attributes whose values are integers
+	attrs   []otlpKeyValue    // Added to every data point
+}
+
+// Attributes shared by the conventions below
+var (
+	otlpFilesystemLabels = map[string]string{"path": "system.filesystem.mountpoint", "fstype": "system.filesystem.type"}
+	otlpInterfaceLabels  = map[string]string{"interface": "network.interface.name"}
+	otlpTransmit         = []otlpKeyValue{otlpString("network.io.direction", "transmit")}
+	otlpReceive          = []otlpKeyValue{otlpString("network.io.direction", "receive")}
+)
+
+// otlpConventions maps built-in samples, by "<collector>.<sample>", onto the
+// OpenTelemetry system semantic conventions. Other samples are exported as
+// "chowkidar.<collector>.<sample>" with their labels as attributes.
+var otlpConventions = map[string]otlpConvention{
+	"cpu.usage_percent": {name: "system.cpu.utilization", unit: "1", scale: 0.01},
+	"cpu.core_usage_percent": {name: "system.cpu.utilization", unit: "1", scale: 0.01,
+		labels: map[string]string{"core": "cpu.logical_number"}, integer: map[string]bool{"cpu.logical_number": true}},
+	"cpu.cores": {name: "system.cpu.logical.count", unit: "{cpu}", sum: true},
+
+	"memory.total_bytes":     {name: "system.memory.limit", unit: "By", sum: true},
+	"memory.used_bytes":      {name: "system.memory.usage", unit: "By", sum: true, attrs: []otlpKeyValue{otlpString("system.memory.state", "used")}},
+	"memory.available_bytes": {name: "system.linux.memory.available", unit: "By", sum: true},
+	"memory.usage_percent":   {name: "system.memory.utilization", unit: "1", scale: 0.01, attrs: []otlpKeyValue{otlpString("system.memory.state", "used")}},
+
+	"disk.total_bytes": {name: "system.filesystem.limit", unit: "By", sum: true, labels: otlpFilesystemLabels},
+	"disk.used_bytes": {name: "system.filesystem.usage", unit: "By", sum: true, labels: otlpFilesystemLabels,
+		attrs: []otlpKeyValue{otlpString("system.filesystem.state", "used")}},
+	"disk.free_bytes": {name: "system.filesystem.usage", unit: "By", sum: true, labels: otlpFilesystemLabels,
+		attrs: []otlpKeyValue{otlpString("system.filesystem.state", "free")}},
+	"disk.usage_percent": {name: "system.filesystem.utilization", unit: "1", scale: 0.01, labels: otlpFilesystemLabels},
+
+	"network.bytes_sent":   {name: "system.network.io", unit: "By", labels: otlpInterfaceLabels, attrs: otlpTransmit},
+	"network.bytes_recv":   {name: "system.network.io", unit: "By", labels: otlpInterfaceLabels, attrs: otlpReceive},
+	"network.packets_sent": {name: "system.network.packets", unit: "{packet}", labels: otlpInterfaceLabels, attrs: otlpTransmit},
+	"network.packets_recv": {name: "system.network.packets", unit: "{packet}", labels: otlpInterfaceLabels, attrs: otlpReceive},
+	"network.errors_out":   {name: "system.network.errors", unit: "{error}", labels: otlpInterfaceLabels, attrs: otlpTransmit},
+	"network.errors_in":    {name: "system.network.errors", unit: "{error}", labels: otlpInterfaceLabels, attrs: otlpReceive},
+	"network.drops_out":    {name: "system.network.dropped", unit: "{packet}", labels: otlpInterfaceLabels, attrs: otlpTransmit},
+	"network.drops_in":     {name: "system.network.dropped", unit: "{packet}", labels: otlpInterfaceLabels, attrs: otlpReceive},
+}
+
+// buildRequest converts a stats snapshot into OTLP metrics: one per collector
+// sample name, following otlpConventions where one applies, plus the top processes
+func (e *OTLPExporter) buildRequest(stats *StatsPayload) otlpRequest {
+	now := otlpTime(stats.Timestamp)
+	boot := ""
+	if bootTime := getBootTime(); !bootTime.IsZero() {
+		boot = otlpTime(bootTime)
+	}
+	metrics := []otlpMetric{}
+	byName := map[string]int{} // Index into metrics
+
+	for _, collector := range sortedSampleKeys(stats.Collectors) {
+		for _, sample := range stats.Collectors[collector] {
+			if !finite(sample.Value) { // JSON has no NaN or ±Inf; one would fail the whole export
+				continue
+			}
+			convention, mapped := otlpConventions[collector+"."+sample.Name]
+			if !mapped {
+				convention = otlpConvention{name: "chowkidar." + collector + "." + sample.Name, unit: sample.Unit}
+			}
+
+			attrs := []otlpKeyValue{}
+			for _, key := range sortedLabelKeys(sample.Labels) {
+				name, value := key, sample.Labels[key]
+				if mapped {
+					if name = convention.labels[key]; name == "" {
+						continue
+					}
+				}
+				if number, err := strconv.ParseInt(value, 10, 64); err == nil && convention.integer[name] {
+					attrs = append(attrs, otlpInt(name, number))
+				} else {
+					attrs = append(attrs, otlpString(name, value))
+				}
+			}
+			attrs = append(attrs, convention.attrs...)
+			value := sample.Value
+			if convention.scale != 0 {
+				value *= convention.scale
+			}
+			point := otlpDouble(now, value, attrs...)
+
+			index, exists := byName[convention.name]
+			if !exists {
+				metrics = append(metrics, otlpMetric{Name: convention.name, Unit: convention.unit})
+				index = len(metrics) - 1
+				byName[convention.name] = index
+			}
+			metric := &metrics[index]
+			switch {
+			case sample.Kind == models.SampleCounter:
+				point.StartTimeUnixNano = boot
+				if metric.Sum == nil {
+					metric.Sum = &otlpSum{AggregationTemporality: otlpCumulative, IsMonotonic: true}
+				}
+				metric.Sum.DataPoints = append(metric.Sum.DataPoints, point)
+			case convention.sum:
+				if metric.Sum == nil {
+					metric.Sum = &otlpSum{AggregationTemporality: otlpCumulative}
+				}
+				metric.Sum.DataPoints = append(metric.Sum.DataPoints, point)
+			default:
+				if metric.Gauge == nil {
+					metric.Gauge = &otlpGauge{}
+				}
+				metric.Gauge.DataPoints = append(metric.Gauge.DataPoints, point)
+			}
+		}
+	}
+
+	// Per-process usage is not a collector sample: the top processes come with the snapshot
+	cpuPoints, memPoints := []otlpDataPoint{}, []otlpDataPoint{}
+	for _, process := range stats.Processes {
+		if !finite(float64(process.CPUPercent)) || !finite(float64(process.MemPercent)) {
+			continue
+		}
+		attrs := []otlpKeyValue{otlpInt("process.pid", int64(process.PID)), otlpString("process.executable.name", process.Name)}
+		cpuPoints = append(cpuPoints, otlpDouble(now, float64(process.CPUPercent)/100, attrs...))
+		memPoints = append(memPoints, otlpDouble(now, float64(process.MemPercent)/100, attrs...))
+	}
+	if len(cpuPoints) > 0 {
+		metrics = append(metrics,
+			otlpMetric{Name: "process.cpu.utilization", Unit: "1", Description: "Top processes by resource usage", Gauge: &otlpGauge{DataPoints: cpuPoints}},
+			otlpMetric{Name: "process.memory.utilization", Unit: "1", Description: "Top processes by resource usage", Gauge: &otlpGauge{DataPoints: memPoints}},
+		)
+	}
+
+	return otlpRequest{ResourceMetrics: []otlpResourceMetrics{{
+		Resource: e.resource,
+		ScopeMetrics: []otlpScopeMetrics{{
+			Scope:   otlpScope{Name: otlpScopeName, Version: AgentVersion},
+			Metrics: metrics,
+		}},
+	}}}
+}
+
+// otlpHostResource describes this host and agent with semantic-convention resource
+// attributes, plus the agent labels from CHOWKIDAR_LABELS
+func otlpHostResource() otlpResource {
+	labels := AgentLabels()
+	attrs := []otlpKeyValue{
+		otlpString("host.name", labels["host"]),
+		otlpString("host.arch", runtime.GOARCH),
+		otlpString("os.type", runtime.GOOS),
+		otlpString("service.name", "chowkidar-agent"),
+		otlpString("service.version", AgentVersion),
+	}
+	for _, key := range sortedLabelKeys(labels) {
+		if key != "host" {
+			attrs = append(attrs, otlpString(key, labels[key]))
+		}
+	}
+	return otlpResource{Attributes: attrs}
+}
+
+// otlpDouble builds a floating-point data point
+func otlpDouble(timestamp string, value float64, attrs ...otlpKeyValue) otlpDataPoint {
+	return otlpDataPoint{Attributes: attrs, TimeUnixNano: timestamp, AsDouble: &value}
+}
+
+// otlpString builds a string attribute
+func otlpString(key, value string) otlpKeyValue {
+	return otlpKeyValue{Key: key, Value: otlpAnyValue{StringValue: &value}}
+}
+
+// otlpInt builds an integer attribute
+func otlpInt(key string, value int64) otlpKeyValue {
+	return otlpKeyValue{Key: key, Value: otlpAnyValue{IntValue: strconv.FormatInt(value, 10)}}
+}
+
+// otlpTime formats a timestamp as OTLP/JSON nanoseconds
+func otlpTime(t time.Time) string {
+	return strconv.FormatInt(t.UnixNano(), 10)
+}
+
+// otlpMetricsURL returns the URL metrics are posted to. As in the OpenTelemetry
+// SDKs, a metrics endpoint is used as-is, while a base endpoint always gets
+// /v1/metrics appended to its path.
+func otlpMetricsURL(base, metrics string) (string, error) {
+	raw := metrics
+	if raw == "" {
+		raw = base
+	}
+	parsed, err := url.Parse(raw)
+	if err != nil {
+		return "", fmt.Errorf("invalid OTLP endpoint: %w", err)
+	}
+	if (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return "", errors.New("OTLP endpoint must be an http:// or https:// URL")
+	}
+	if metrics == "" {
+		parsed.Path = strings.TrimSuffix(parsed.Path, "/") + "/v1/metrics"
+		parsed.RawPath = ""
+	}
+	return parsed.String(), nil
+}
+
+// parseOTLPHeaders parses "key=value,key2=value2" with URL-encoded values (the OTEL_EXPORTER_OTLP_HEADERS format)
+func parseOTLPHeaders(spec string) (map[string]string, error) {
+	headers := map[string]string{}
+	for _, pair := range strings.Split(spec, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		key, value, ok := strings.Cut(pair, "=")
+		key = strings.TrimSpace(key)
+		if !ok || key == "" {
+			return nil, fmt.Errorf("invalid OTLP header %q (expected key=value)", pair)
+		}
+		decoded, err := url.QueryUnescape(strings.TrimSpace(value))
+		if err != nil {
+			return nil, fmt.Errorf("invalid OTLP header %q: %w", key, err)
+		}
+		headers[key] = decoded
+	}
+	return headers, nil
+}
+
+// envWithFallback reads the first non-empty environment variable of the given names
+func envWithFallback(names ...string) string {
+	for _, name := range names {
+		if value := strings.TrimSpace(os.Getenv(name)); value != "" {
+			return value
+		}
+	}
+	return ""
+}
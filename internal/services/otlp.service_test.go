@@ -0,0 +1,263 @@
+package services
+
+import (
+	"chowkidar/internal/models"
+	"encoding/json"
+	"errors"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestOTLPMetricsURL(t *testing.T) {
+	tests := []struct {
+		name    string
+		base    string
+		metrics string
+		want    string
+		wantErr bool
+	}{
+		{name: "bare host", base: "http://collector:4318", want: "http://collector:4318/v1/metrics"},
+		{name: "trailing slash", base: "http://collector:4318/", want: "http://collector:4318/v1/metrics"},
+		{name: "base path", base: "http://collector:4318/otlp", want: "http://collector:4318/otlp/v1/metrics"},
+		{name: "base path with slash", base: "https://otlp.example.com/otlp/", want: "https://otlp.example.com/otlp/v1/metrics"},
+		{name: "query kept", base: "http://collector:4318/otlp?tenant=a", want: "http://collector:4318/otlp/v1/metrics?tenant=a"},
+		{name: "metrics endpoint as-is", metrics: "http://collector:4318/custom/path", want: "http://collector:4318/custom/path"},
+		{name: "metrics endpoint wins", base: "http://a:4318", metrics: "http://b:4318/v1/metrics", want: "http://b:4318/v1/metrics"},
+		{name: "no scheme", base: "collector:4318", wantErr: true},
+		{name: "unsupported scheme", base: "grpc://collector:4317", wantErr: true},
+		{name: "no host", metrics: "http:///v1/metrics", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := otlpMetricsURL(tt.base, tt.metrics)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("otlpMetricsURL(%q, %q) = %q, want an error", tt.base, tt.metrics, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("otlpMetricsURL(%q, %q): %v", tt.base, tt.metrics, err)
+			}
+			if got != tt.want {
+				t.Errorf("otlpMetricsURL(%q, %q) = %q, want %q", tt.base, tt.metrics, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseOTLPHeaders(t *testing.T) {
+	tests := []struct {
+		spec    string
+		want    map[string]string
+		wantErr bool
+	}{
+		{spec: "", want: map[string]string{}},
+		{spec: "api-key=abc", want: map[string]string{"api-key": "abc"}},
+		{spec: " Authorization=Bearer%20abc , x-tenant=a ", want: map[string]string{"Authorization": "Bearer abc", "x-tenant": "a"}},
+		{spec: "novalue", wantErr: true},
+		{spec: "=value", wantErr: true},
+		{spec: "key=%zz", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := parseOTLPHeaders(tt.spec)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("parseOTLPHeaders(%q) = %v, want an error", tt.spec, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parseOTLPHeaders(%q): %v", tt.spec, err)
+			continue
+		}
+		if len(got) != len(tt.want) {
+			t.Errorf("parseOTLPHeaders(%q) = %v, want %v", tt.spec, got, tt.want)
+			continue
+		}
+		for key, value := range tt.want {
+			if got[key] != value {
+				t.Errorf("parseOTLPHeaders(%q)[%q] = %q, want %q", tt.spec, key, got[key], value)
+			}
+		}
+	}
+}
+
+func TestOTLPExporterWrite(t *testing.T) {
+	tests := []struct {
+		name         string
+		status       int
+		wantErr      bool
+		wantRejected bool
+	}{
+		{name: "accepted", status: http.StatusOK},
+		{name: "partial success", status: http.StatusAccepted},
+		{name: "throttled", status: http.StatusTooManyRequests, wantErr: true},
+		{name: "unavailable", status: http.StatusServiceUnavailable, wantErr: true},
+		{name: "bad request", status: http.StatusBadRequest, wantErr: true, wantRejected: true},
+		{name: "unauthorized", status: http.StatusUnauthorized, wantErr: true, wantRejected: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var gotPath, gotType, gotKey string
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				gotPath, gotType, gotKey = r.URL.Path, r.Header.Get("Content-Type"), r.Header.Get("api-key")
+				w.WriteHeader(tt.status)
+			}))
+			defer server.Close()
+
+			exporter := &OTLPExporter{
+				Endpoint: server.URL + "/v1/metrics",
+				Headers:  map[string]string{"api-key": "secret"},
+				client:   server.Client(),
+			}
+			err := exporter.write([]byte(`{"resourceMetrics":[]}`))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("write() error = %v, want error %v", err, tt.wantErr)
+			}
+			if rejected := errors.Is(err, ErrOutputRejected); rejected != tt.wantRejected {
+				t.Errorf("write() rejected = %v, want %v (error %v)", rejected, tt.wantRejected, err)
+			}
+			if gotPath != "/v1/metrics" || gotType != "application/json" || gotKey != "secret" {
+				t.Errorf("request path %q, content type %q, api-key %q", gotPath, gotType, gotKey)
+			}
+		})
+	}
+}
+
+func TestOTLPSerialization(t *testing.T) {
+	var body []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ = io.ReadAll(r.Body)
+	}))
+	defer server.Close()
+
+	exporter := &OTLPExporter{
+		Endpoint: server.URL + "/v1/metrics",
+		resource: otlpResource{Attributes: []otlpKeyValue{otlpString("host.name", "web-1")}},
+		client:   server.Client(),
+	}
+	timestamp := time.Unix(1700000000, 0)
+	stats := &StatsPayload{
+		Collectors: map[string][]models.Sample{
+			"memory": {
+				{Name: "total_bytes", Kind: models.SampleGauge, Unit: "By", Value: 8 << 30},
+				{Name: "used_bytes", Kind: models.SampleGauge, Unit: "By", Value: 2 << 30},
+				{Name: "usage_percent", Kind: models.SampleGauge, Unit: "%", Value: 25},
+			},
+			"network": {
+				{Name: "bytes_sent", Kind: models.SampleCounter, Unit: "By", Value: 100, Labels: map[string]string{"interface": "eth0"}},
+				{Name: "bytes_recv", Kind: models.SampleCounter, Unit: "By", Value: 200, Labels: map[string]string{"interface": "eth0"}},
+			},
+			"custom": {
+				{Name: "broken", Kind: models.SampleGauge, Value: math.NaN()},
+				{Name: "queue_depth", Kind: models.SampleGauge, Value: 3, Labels: map[string]string{"queue": "a"}},
+				{Name: "queue_depth", Kind: models.SampleGauge, Value: math.Inf(1), Labels: map[string]string{"queue": "c"}},
+				{Name: "queue_depth", Kind: models.SampleGauge, Value: 5, Labels: map[string]string{"queue": "b"}},
+				{Name: "jobs_done", Kind: models.SampleCounter, Unit: "{job}", Value: 42},
+			},
+		},
+		Timestamp: timestamp,
+	}
+	data, err := json.Marshal(exporter.buildRequest(stats))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := exporter.write(data); err != nil {
+		t.Fatalf("write(): %v", err)
+	}
+
+	var request otlpRequest
+	if err := json.Unmarshal(body, &request); err != nil {
+		t.Fatalf("collector received invalid JSON: %v", err)
+	}
+	if len(request.ResourceMetrics) != 1 || len(request.ResourceMetrics[0].ScopeMetrics) != 1 {
+		t.Fatalf("want one resource and scope, got %s", body)
+	}
+	resource := request.ResourceMetrics[0]
+	if attrs := resource.Resource.Attributes; len(attrs) != 1 || attrs[0].Key != "host.name" || *attrs[0].Value.StringValue != "web-1" {
+		t.Errorf("resource attributes = %s", body)
+	}
+	if scope := resource.ScopeMetrics[0].Scope; scope.Name != otlpScopeName {
+		t.Errorf("scope name = %q, want %q", scope.Name, otlpScopeName)
+	}
+
+	metrics := map[string]otlpMetric{}
+	for _, metric := range resource.ScopeMetrics[0].Metrics {
+		metrics[metric.Name] = metric
+	}
+	wantTime := "1700000000000000000"
+
+	tests := []struct {
+		metric    string
+		sum       bool
+		monotonic bool
+		points    int
+		value     float64 // Of the first point
+		attrs     string  // Of the first point, as key=value pairs
+	}{
+		{metric: "system.memory.limit", sum: true, points: 1, value: 8 << 30},
+		{metric: "system.memory.usage", sum: true, points: 1, value: 2 << 30, attrs: "system.memory.state=used"},
+		{metric: "system.memory.utilization", points: 1, value: 0.25, attrs: "system.memory.state=used"},
+		{metric: "system.network.io", sum: true, monotonic: true, points: 2, value: 100,
+			attrs: "network.interface.name=eth0 network.io.direction=transmit"},
+		{metric: "chowkidar.custom.queue_depth", points: 2, value: 3, attrs: "queue=a"},
+		{metric: "chowkidar.custom.jobs_done", sum: true, monotonic: true, points: 1, value: 42},
+	}
+	for _, tt := range tests {
+		metric, ok := metrics[tt.metric]
+		if !ok {
+			t.Errorf("metric %s missing from %s", tt.metric, body)
+			continue
+		}
+		var points []otlpDataPoint
+		switch {
+		case tt.sum && metric.Sum != nil:
+			points = metric.Sum.DataPoints
+			if metric.Sum.AggregationTemporality != otlpCumulative || metric.Sum.IsMonotonic != tt.monotonic {
+				t.Errorf("%s: temporality %d, monotonic %v", tt.metric, metric.Sum.AggregationTemporality, metric.Sum.IsMonotonic)
+			}
+		case !tt.sum && metric.Gauge != nil:
+			points = metric.Gauge.DataPoints
+		default:
+			t.Errorf("%s: want sum %v, got gauge %v sum %v", tt.metric, tt.sum, metric.Gauge != nil, metric.Sum != nil)
+			continue
+		}
+		if len(points) != tt.points {
+			t.Errorf("%s: %d data points, want %d", tt.metric, len(points), tt.points)
+			continue
+		}
+		point := points[0]
+		if point.TimeUnixNano != wantTime {
+			t.Errorf("%s: timeUnixNano %q, want %q", tt.metric, point.TimeUnixNano, wantTime)
+		}
+		value, _ := strconv.ParseFloat(point.AsInt, 64)
+		if point.AsDouble != nil {
+			value = *point.AsDouble
+		}
+		if value != tt.value {
+			t.Errorf("%s: value %v, want %v", tt.metric, value, tt.value)
+		}
+		attrs := []string{}
+		for _, attr := range point.Attributes {
+			if attr.Value.StringValue != nil {
+				attrs = append(attrs, attr.Key+"="+*attr.Value.StringValue)
+			}
+		}
+		if got := strings.Join(attrs, " "); got != tt.attrs {
+			t.Errorf("%s: attributes %q, want %q", tt.metric, got, tt.attrs)
+		}
+	}
+	if _, ok := metrics["chowkidar.custom.broken"]; ok {
+		t.Errorf("NaN sample exported: %s", body)
+	}
+	if unit := metrics["chowkidar.custom.jobs_done"].Unit; unit != "{job}" {
+		t.Errorf("chowkidar.custom.jobs_done unit %q, want {job}", unit)
+	}
+}
@@ -0,0 +1,187 @@
+package services
+
+import (
+	"chowkidar/internal/models"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// outputMaxBackoff caps the wait between retries to an unreachable sink
+const outputMaxBackoff = 5 * time.Minute
+
+// ErrOutputRejected marks a write the remote refused outright. The payload is
+// dropped instead of retried; any other error keeps it queued.
+var ErrOutputRejected = errors.New("rejected by remote")
+
+// Output is a metrics sink fed with every history snapshot. Each output gets
+// its own outbound queue, so snapshots are kept and retried in order while
+// the sink is unreachable. New sinks implement this interface and are added in StartOutputs.
+type Output interface {
+	// Name identifies the output in logs, events and /metrics/queues
+	Name() string
+	// Serialize renders a snapshot in the sink's wire format
+	Serialize(point models.HistoryPoint) ([]byte, error)
+	// Write sends serialized snapshots to the sink
+	Write(data []byte) error
+}
+
+// outputSink pairs an output with its queue
+type outputSink struct {
+	output Output
+	queue  *OutboundQueue
+}
+
+var (
+	outputsMu sync.RWMutex
+	outputs   []outputSink
+
+	agentLabels     map[string]string
+	agentLabelsOnce sync.Once
+)
+
+// StartOutputs configures every output enabled in the environment (Influx, Graphite)
+// and starts delivering history snapshots to them. It returns the enabled output names.
+func StartOutputs() ([]string, error) {
+	candidates := []func() (Output, error){newInfluxOutput, newGraphiteOutput}
+
+	names := []string{}
+	for _, build := range candidates {
+		output, err := build()
+		if err != nil {
+			return nil, err
+		}
+		if output == nil {
+			continue
+		}
+		queue, err := NewOutboundQueue(output.Name())
+		if err != nil {
+			return nil, fmt.Errorf("could not open %s queue: %w", output.Name(), err)
+		}
+
+		outputsMu.Lock()
+		outputs = append(outputs, outputSink{output: output, queue: queue})
+		outputsMu.Unlock()
+		go drainQueue(output.Name(), queue, output.Write)
+		names = append(names, output.Name())
+	}
+	return names, nil
+}
+
+// writeOutputs queues a history snapshot for every output
+func writeOutputs(point models.HistoryPoint) {
+	outputsMu.RLock()
+	defer outputsMu.RUnlock()
+	for _, sink := range outputs {
+		data, err := sink.output.Serialize(point)
+		if err == nil && len(data) > 0 {
+			err = sink.queue.Push(data)
+		}
+		if err != nil {
+			ReportCollectorError(sink.output.Name(), err)
+		}
+	}
+}
+
+// drainQueue delivers queued payloads in order, backing off while the sink is
+// unavailable. Payloads the sink rejects (ErrOutputRejected) are dropped.
+// The queue is kept online, holding entries in memory, while writes succeed.
+func drainQueue(name string, queue *OutboundQueue, write func([]byte) error) {
+	tag := "[" + strings.ToUpper(name) + "]"
+	attempt := 0
+	online := false
+	for {
+		seq, data, ok := queue.Peek()
+		if !ok {
+			<-queue.Ready()
+			continue
+		}
+
+		err := write(data)
+		if err != nil && !errors.Is(err, ErrOutputRejected) {
+			wait := jitteredBackoff(attempt, time.Second, outputMaxBackoff)
+			attempt++
+			ReportCollectorError(name, err)
+			if online {
+				online = false
+				queue.SetOnline(false)
+			}
+			log.Printf("%s Export failed: %v (retrying in %s, %d queued)", tag, err, wait.Round(time.Millisecond), queue.Len())
+			time.Sleep(wait)
+			continue
+		}
+		if err != nil {
+			ReportCollectorError(name, err)
+			log.Printf("%s Export rejected, dropping payload: %v", tag, err)
+		} else {
+			ReportCollectorOK(name)
+		}
+		attempt = 0
+		queue.Ack(seq)
+		if !online {
+			online = true
+			queue.SetOnline(true)
+		}
+	}
+}
+
+// AgentLabels returns the agent's labels from CHOWKIDAR_LABELS ("env=prod,role=web")
+// plus host=<hostname> unless a host label is given. Outputs attach them as tags.
+func AgentLabels() map[string]string {
+	agentLabelsOnce.Do(func() {
+		agentLabels = map[string]string{}
+		for _, pair := range strings.Split(os.Getenv("CHOWKIDAR_LABELS"), ",") {
+			key, value, ok := strings.Cut(strings.TrimSpace(pair), "=")
+			key, value = strings.TrimSpace(key), strings.TrimSpace(value)
+			if !ok || key == "" || value == "" {
+				if strings.TrimSpace(pair) != "" {
+					log.Printf("⚠️  Ignoring invalid CHOWKIDAR_LABELS entry %q (expected key=value)", pair)
+				}
+				continue
+			}
+			agentLabels[key] = value
+		}
+		if _, exists := agentLabels["host"]; !exists {
+			if hostname, err := os.Hostname(); err == nil && hostname != "" {
+				agentLabels["host"] = hostname
+			}
+		}
+	})
+
+	labels := make(map[string]string, len(agentLabels))
+	for key, value := range agentLabels {
+		labels[key] = value
+	}
+	return labels
+}
+
+// finite reports whether a value is neither NaN nor ±Inf
+func finite(value float64) bool {
+	return !math.IsNaN(value) && !math.IsInf(value, 0)
+}
+
+// sortedLabelKeys returns label keys in a stable order for serialisation
+func sortedLabelKeys(labels map[string]string) []string {
+	keys := make([]string, 0, len(labels))
+	for key := range labels {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// sortedSampleKeys returns collector names in a stable order for serialisation
+func sortedSampleKeys(samples map[string][]models.Sample) []string {
+	keys := make([]string, 0, len(samples))
+	for key := range samples {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,203 @@
+package services
+
+import (
+	"chowkidar/internal/models"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/shirou/gopsutil/v3/process"
+)
+
+// processEventHistorySize is how many process events /processes/events keeps
+const processEventHistorySize = 500
+
+// trackedProcess is the last observation of a running process
+type trackedProcess struct {
+	status    models.ProcessStatus
+	startTime time.Time
+	zombie    bool // Already reported as exited
+}
+
+// ProcessTracker diffs the full PID set on every collector tick and reports
+// processes that started or exited in between
+type ProcessTracker struct {
+	mu      sync.Mutex
+	enabled bool
+	known   map[int32]*trackedProcess // nil until the first tick sets the baseline
+	events  []models.ProcessEvent     // Ring buffer, see head
+	head    int
+}
+
+var processTracker = &ProcessTracker{
+	enabled: os.Getenv("CHOWKIDAR_PROCESS_EVENTS") != "false",
+}
+
+// observe compares a full process scan with the previous one
+func (pt *ProcessTracker) observe(processes []ProcessWithScore) {
+	if !pt.enabled {
+		return
+	}
+
+	now := time.Now()
+	var events []models.ProcessEvent
+
+	pt.mu.Lock()
+	baseline := pt.known == nil
+	seen := make(map[int32]*trackedProcess, len(processes))
+
+	for _, p := range processes {
+		prev, exists := pt.known[p.PID]
+		// A different start time means the PID was reused by a new process
+		if exists && !p.StartTime.IsZero() && !prev.startTime.IsZero() && !p.StartTime.Equal(prev.startTime) {
+			if !prev.zombie {
+				events = append(events, exitEvent(prev, now, false))
+			}
+			exists = false
+		}
+
+		if !exists {
+			tp := &trackedProcess{status: p.ProcessStatus, startTime: p.StartTime}
+			if tp.startTime.IsZero() {
+				tp.startTime = processCreateTime(p.PID)
+			}
+			seen[p.PID] = tp
+			if !baseline {
+				events = append(events, models.ProcessEvent{
+					Type:       models.EventProcessStarted,
+					Timestamp:  now,
+					PID:        p.PID,
+					Name:       p.Name,
+					StartedAt:  tp.startTime,
+					CPUPercent: p.CPUPercent,
+					MemPercent: p.MemPercent,
+					Status:     p.Status,
+				})
+			}
+			continue
+		}
+
+		prev.status = p.ProcessStatus
+		seen[p.PID] = prev
+
+		// A zombie has exited; report it now rather than when its parent reaps it
+		if p.Status == "zombie" && !prev.zombie {
+			prev.zombie = true
+			events = append(events, exitEvent(prev, now, true))
+		}
+	}
+
+	for pid, prev := range pt.known {
+		if _, alive := seen[pid]; !alive && !prev.zombie {
+			events = append(events, exitEvent(prev, now, false))
+		}
+	}
+
+	pt.known = seen
+	for _, event := range events {
+		pt.record(event)
+	}
+	pt.mu.Unlock()
+
+	for _, event := range events {
+		publishProcessEvent(event)
+	}
+}
+
+// record appends an event to the ring buffer; callers hold pt.mu
+func (pt *ProcessTracker) record(event models.ProcessEvent) {
+	if len(pt.events) < processEventHistorySize {
+		pt.events = append(pt.events, event)
+		return
+	}
+	pt.events[pt.head] = event
+	pt.head = (pt.head + 1) % processEventHistorySize
+}
+
+// exitEvent describes a process that is gone (or a zombie) using its last observation
+func exitEvent(tp *trackedProcess, now time.Time, zombie bool) models.ProcessEvent {
+	event := models.ProcessEvent{
+		Type:       models.EventProcessExited,
+		Timestamp:  now,
+		PID:        tp.status.PID,
+		Name:       tp.status.Name,
+		StartedAt:  tp.startTime,
+		CPUPercent: tp.status.CPUPercent,
+		MemPercent: tp.status.MemPercent,
+		Status:     tp.status.Status,
+		Zombie:     zombie,
+	}
+	if !tp.startTime.IsZero() {
+		event.LifetimeSeconds = now.Sub(tp.startTime).Seconds()
+	}
+	return event
+}
+
+// processCreateTime looks up a start time where the scan did not provide one
+func processCreateTime(pid int32) time.Time {
+	p, err := process.NewProcess(pid)
+	if err != nil {
+		return time.Time{}
+	}
+	ms, err := p.CreateTime()
+	if err != nil {
+		return time.Time{}
+	}
+	return time.UnixMilli(ms)
+}
+
+// publishProcessEvent puts a process event on the event bus
+func publishProcessEvent(event models.ProcessEvent) {
+	severity := models.SeverityInfo
+	message := fmt.Sprintf("%s (pid %d) started", event.Name, event.PID)
+	if event.Type == models.EventProcessExited {
+		message = fmt.Sprintf("%s (pid %d) exited after %.0fs", event.Name, event.PID, event.LifetimeSeconds)
+		if event.Zombie {
+			severity = models.SeverityWarning
+			message = fmt.Sprintf("%s (pid %d) is a zombie", event.Name, event.PID)
+		}
+	}
+
+	PublishEvent(models.Event{
+		Type:      event.Type,
+		Timestamp: event.Timestamp,
+		Severity:  severity,
+		Source:    "processes",
+		Message:   message,
+		Attributes: map[string]interface{}{
+			"pid":              event.PID,
+			"name":             event.Name,
+			"started_at":       event.StartedAt,
+			"lifetime_seconds": event.LifetimeSeconds,
+			"cpu_percent":      event.CPUPercent,
+			"mem_percent":      event.MemPercent,
+			"status":           event.Status,
+			"zombie":           event.Zombie,
+		},
+	})
+}
+
+// GetProcessEvents returns recent process events, oldest first. since and eventType are optional filters.
+func GetProcessEvents(since time.Time, eventType string, limit int) []models.ProcessEvent {
+	processTracker.mu.Lock()
+	ordered := make([]models.ProcessEvent, 0, len(processTracker.events))
+	ordered = append(ordered, processTracker.events[processTracker.head:]...)
+	ordered = append(ordered, processTracker.events[:processTracker.head]...)
+	processTracker.mu.Unlock()
+
+	events := []models.ProcessEvent{}
+	for _, event := range ordered {
+		if !since.IsZero() && event.Timestamp.Before(since) {
+			continue
+		}
+		if eventType != "" && event.Type != eventType {
+			continue
+		}
+		events = append(events, event)
+	}
+	if limit > 0 && len(events) > limit {
+		events = events[len(events)-limit:]
+	}
+	return events
+}
@@ -0,0 +1,31 @@
+package services
+
+import (
+	"chowkidar/internal/models"
+	"time"
+)
+
+// processesCollector reports the CPU and memory share of all processes, from the
+// process collector's last scan (StartProcessCollector does the scanning)
+type processesCollector struct{}
+
+func init() {
+	RegisterCollector(processesCollector{})
+}
+
+func (processesCollector) Name() string            { return TopicProcesses }
+func (processesCollector) Description() string     { return "CPU and memory used by all processes" }
+func (processesCollector) Interval() time.Duration { return 30 * time.Second }
+
+// Collect peeks at the cache: going through GetCachedProcesses would count as a
+// reader and keep the process scan in its fast mode
+func (processesCollector) Collect() ([]models.Sample, error) {
+	_, totalCPU, totalMem, updated := peekCachedProcesses()
+	if updated.IsZero() {
+		return nil, nil
+	}
+	return []models.Sample{
+		{Name: "cpu_percent", Kind: models.SampleGauge, Unit: "%", Value: float64(totalCPU)},
+		{Name: "memory_percent", Kind: models.SampleGauge, Unit: "%", Value: float64(totalMem)},
+	}, nil
+}
@@ -19,7 +19,8 @@ import (
 // ProcessWithScore helps with sorting
 type ProcessWithScore struct {
 	models.ProcessStatus
-	Score float64
+	Score     float64
+	StartTime time.Time // Zero when the platform collector does not report it
 }
 
 // ProcessCollectorCache holds the real-time collected process data
@@ -37,9 +38,13 @@ var collector = &ProcessCollectorCache{
 	running:   false,
 }
 
-// StartProcessCollector starts the background process collector
-// interval is the collection frequency (e.g., time.Second for 1 second)
-func StartProcessCollector(interval time.Duration) {
+// processDemand switches the collector between its active and idle intervals
+var processDemand = NewDemand(DemandTTL)
+
+// StartProcessCollector starts the background process collector.
+// It scans every activeInterval while processes are being read (REST or WebSocket)
+// and falls back to idleInterval once nobody has asked for DemandTTL.
+func StartProcessCollector(activeInterval, idleInterval time.Duration) {
 	collector.mu.Lock()
 	if collector.running {
 		collector.mu.Unlock()
@@ -49,32 +54,66 @@ func StartProcessCollector(interval time.Duration) {
 	collector.mu.Unlock()
 
 	go func() {
-		ticker := time.NewTicker(interval)
-		defer ticker.Stop()
+		timer := time.NewTimer(0) // Collect once right away
+		defer timer.Stop()
+
+		for {
+			select {
+			case <-timer.C:
+			case <-processDemand.Wake():
+				// A reader arrived while idle: refresh now unless the data is still current
+				timer.Stop()
+				collector.mu.RLock()
+				lastUpdated := collector.lastUpdated
+				collector.mu.RUnlock()
+				if time.Since(lastUpdated) < activeInterval {
+					timer.Reset(activeInterval)
+					continue
+				}
+			}
 
-		for range ticker.C {
-			collector.mu.Lock()
-			if !collector.running {
-				collector.mu.Unlock()
+			if !collector.collect() {
 				return
 			}
 
-			processes, totalCPU, totalMem, err := GetTopProcessesWithTotals()
-			if err != nil {
-				log.Printf("Process collection error: %v", err)
-				collector.mu.Unlock()
-				continue
+			if processDemand.Active() {
+				timer.Reset(activeInterval)
+			} else {
+				timer.Reset(idleInterval)
 			}
-
-			collector.processes = processes
-			collector.totalCPU = totalCPU
-			collector.totalMem = totalMem
-			collector.lastUpdated = time.Now()
-			collector.mu.Unlock()
 		}
 	}()
 
-	log.Printf("Process collector started (interval: %v)", interval)
+	log.Printf("Process collector started (interval: %v active, %v idle)", activeInterval, idleInterval)
+}
+
+// collect refreshes the cached process list; it returns false once the collector is stopped
+func (pc *ProcessCollectorCache) collect() bool {
+	// Scan outside the lock so readers are never blocked on /proc
+	var processes []models.ProcessStatus
+	var totalCPU, totalMem float32
+	all, err := collectProcesses()
+	if err == nil {
+		processTracker.observe(all)
+		processes, totalCPU, totalMem = rankProcesses(all)
+	}
+
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+	if !pc.running {
+		return false
+	}
+	if err != nil {
+		ReportCollectorError("processes", err)
+		return true
+	}
+	ReportCollectorOK("processes")
+
+	pc.processes = processes
+	pc.totalCPU = totalCPU
+	pc.totalMem = totalMem
+	pc.lastUpdated = time.Now()
+	return true
 }
 
 // StopProcessCollector stops the background process collector
@@ -85,8 +124,18 @@ func StopProcessCollector() {
 	log.Println("Process collector stopped")
 }
 
-// GetCachedProcesses returns the latest cached process data
+// GetCachedProcesses returns the latest cached process data.
+// Each call counts as demand, keeping the collector at its active rate.
 func GetCachedProcesses() ([]models.ProcessStatus, float32, float32, time.Time) {
+	processDemand.Mark()
+	collector.mu.RLock()
+	defer collector.mu.RUnlock()
+	return collector.processes, collector.totalCPU, collector.totalMem, collector.lastUpdated
+}
+
+// peekCachedProcesses returns the cached process data without counting as demand,
+// for background readers (collectors, push, export) that must not keep the scan fast
+func peekCachedProcesses() ([]models.ProcessStatus, float32, float32, time.Time) {
 	collector.mu.RLock()
 	defer collector.mu.RUnlock()
 	return collector.processes, collector.totalCPU, collector.totalMem, collector.lastUpdated
@@ -95,23 +144,24 @@ func GetCachedProcesses() ([]models.ProcessStatus, float32, float32, time.Time)
 // GetTopProcessesWithTotals returns top 20 processes with resource totals
 // Pipeline: Collect → Enrich → Sort → Limit
 func GetTopProcessesWithTotals() ([]models.ProcessStatus, float32, float32, error) {
-	var processes []ProcessWithScore
+	processes, err := collectProcesses()
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	result, totalCPU, totalMem := rankProcesses(processes)
+	return result, totalCPU, totalMem, nil
+}
 
-	// COLLECT: Get all processes
+// collectProcesses returns every running process (COLLECT step)
+func collectProcesses() ([]ProcessWithScore, error) {
 	if runtime.GOOS == "linux" {
-		collected, err := collectFromLinux()
-		if err != nil {
-			return nil, 0, 0, err
-		}
-		processes = collected
-	} else {
-		collected, err := collectFromUniversal()
-		if err != nil {
-			return nil, 0, 0, err
-		}
-		processes = collected
+		return collectFromLinux()
 	}
+	return collectFromUniversal()
+}
 
+// rankProcesses keeps the top 20 processes and sums their usage
+func rankProcesses(processes []ProcessWithScore) ([]models.ProcessStatus, float32, float32) {
 	// ENRICH: Calculate scores
 	enriched := enrichWithScores(processes)
 
@@ -131,7 +181,7 @@ func GetTopProcessesWithTotals() ([]models.ProcessStatus, float32, float32, erro
 		totalMem += p.MemPercent
 	}
 
-	return result, totalCPU, totalMem, nil
+	return result, totalCPU, totalMem
 }
 
 // GetTopProcesses returns the top 20 processes ranked by CPU + memory usage
@@ -185,6 +235,7 @@ func collectFromLinux() ([]ProcessWithScore, error) {
 		processes = append(processes, ProcessWithScore{
 			ProcessStatus: ps,
 			Score:         0, // Will be enriched
+			StartTime:     statStartTime(string(statData)),
 		})
 	}
 
@@ -306,6 +357,53 @@ func parseStatFile(pid int32, statLine string) (models.ProcessStatus, error) {
 	}, nil
 }
 
+// statStartTime returns when a process started, from the starttime field
+// (clock ticks since boot) of /proc/[pid]/stat
+func statStartTime(statLine string) time.Time {
+	lastParen := strings.LastIndex(statLine, ")")
+	if lastParen == -1 {
+		return time.Time{}
+	}
+	fields := strings.Fields(statLine[lastParen+1:])
+	if len(fields) < 20 {
+		return time.Time{}
+	}
+	ticks, err := strconv.ParseInt(fields[19], 10, 64)
+	boot := getBootTime()
+	if err != nil || boot.IsZero() {
+		return time.Time{}
+	}
+	return boot.Add(time.Duration(ticks) * time.Second / clockTicksPerSecond)
+}
+
+// clockTicksPerSecond is USER_HZ, which is 100 on every mainstream Linux build
+const clockTicksPerSecond = 100
+
+var (
+	bootTime     time.Time
+	bootTimeOnce sync.Once
+)
+
+// getBootTime returns the system boot time from the btime line of /proc/stat
+func getBootTime() time.Time {
+	bootTimeOnce.Do(func() {
+		data, err := os.ReadFile("/proc/stat")
+		if err != nil {
+			return
+		}
+		for _, line := range strings.Split(string(data), "\n") {
+			if strings.HasPrefix(line, "btime ") {
+				secs, err := strconv.ParseInt(strings.TrimSpace(strings.TrimPrefix(line, "btime ")), 10, 64)
+				if err == nil {
+					bootTime = time.Unix(secs, 0)
+				}
+				return
+			}
+		}
+	})
+	return bootTime
+}
+
 // mapProcessState converts process state codes to readable strings
 func mapProcessState(state string) string {
 	if len(state) == 0 {
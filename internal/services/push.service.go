@@ -0,0 +1,356 @@
+package services
+
+import (
+	"chowkidar/internal/models"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/gorilla/websocket"
+)
+
+// Push connection settings
+const (
+	pushMaxBackoff = time.Minute
+	maxTunnelBody  = 4 << 20 // Largest API response carried over a tunnel
+)
+
+// PushClient streams this agent's stats and events to a hub over an outbound
+// WebSocket, for agents behind NAT or firewalls that cannot accept connections.
+// The hub can also send API requests back over the same connection.
+type PushClient struct {
+	URL      string // Hub /fleet/push URL
+	Token    string // Token issued by the hub
+	Name     string // Name this agent is listed under on the hub
+	Interval time.Duration
+
+	handler     http.Handler // Local API that tunnelled requests are served from
+	tunnelToken string       // Self-issued token attached to tunnelled requests
+	events      *EventSubscription
+	queue       *OutboundQueue // Stats and events wait here until the hub has them
+	writeMu     sync.Mutex
+}
+
+var pushClient *PushClient
+
+// StartPushClient connects to the hub in CHOWKIDAR_PUSH_URL when it is set and keeps
+// the connection up with jittered backoff. handler serves tunnelled API requests.
+func StartPushClient(handler http.Handler) (*PushClient, error) {
+	rawURL := strings.TrimSpace(os.Getenv("CHOWKIDAR_PUSH_URL"))
+	if rawURL == "" {
+		return nil, nil
+	}
+	pushURL, err := hubPushURL(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	token := strings.TrimSpace(os.Getenv("CHOWKIDAR_PUSH_TOKEN"))
+	if token == "" {
+		return nil, errors.New("CHOWKIDAR_PUSH_TOKEN is required with CHOWKIDAR_PUSH_URL")
+	}
+	// The hub lists the agent under its token's server name
+	name := strings.TrimSpace(os.Getenv("CHOWKIDAR_PUSH_NAME"))
+	if name == "" {
+		if name = tokenServerName(token); name == "" {
+			return nil, errors.New("CHOWKIDAR_PUSH_TOKEN is not a valid token")
+		}
+	}
+	tunnelToken, err := GenerateToken(name + "-push-tunnel")
+	if err != nil {
+		return nil, err
+	}
+	queue, err := NewOutboundQueue("push")
+	if err != nil {
+		return nil, fmt.Errorf("could not open push queue: %w", err)
+	}
+
+	pushClient = &PushClient{
+		URL:         pushURL,
+		Token:       token,
+		Name:        name,
+		Interval:    durationFromEnv("CHOWKIDAR_PUSH_INTERVAL", 5*time.Second),
+		handler:     handler,
+		tunnelToken: tunnelToken,
+		events:      SubscribeEvents(256),
+		queue:       queue,
+	}
+	go pushClient.produce()
+	go pushClient.run()
+	return pushClient, nil
+}
+
+// produce queues a stats snapshot every Interval and every event as it happens,
+// whether or not the hub is reachable. Sessions drain the queue in order, so
+// data gathered during an outage reaches the hub with its original timestamps.
+func (p *PushClient) produce() {
+	ticker := time.NewTicker(p.Interval)
+	defer ticker.Stop()
+	p.queueStats()
+	for {
+		select {
+		case <-ticker.C:
+			p.queueStats()
+		case event := <-p.events.C:
+			msg := WebSocketMessage{Type: "event", Timestamp: event.Timestamp, Data: event}
+			if event.Type == models.EventThresholdCrossed {
+				msg.Type = "alert"
+			}
+			p.enqueue(msg)
+		}
+	}
+}
+
+// queueStats queues a full stats snapshot
+func (p *PushClient) queueStats() {
+	stats := GetWebSocketHub().backgroundStats().filter(allStatsTopics())
+	p.enqueue(WebSocketMessage{Type: "stats", Timestamp: stats.Timestamp, Data: stats})
+}
+
+// enqueue stores a message for delivery to the hub
+func (p *PushClient) enqueue(msg WebSocketMessage) {
+	data, err := json.Marshal(msg)
+	if err == nil {
+		err = p.queue.Push(data)
+	}
+	if err != nil {
+		ReportCollectorError("push_queue", err)
+		return
+	}
+	ReportCollectorOK("push_queue")
+}
+
+// run reconnects to the hub forever, backing off with jitter between attempts
+func (p *PushClient) run() {
+	attempt := 0
+	for {
+		started := time.Now()
+		err := p.session()
+
+		// A connection that stayed up for a while starts the backoff over
+		if time.Since(started) > time.Minute {
+			attempt = 0
+		}
+		wait := jitteredBackoff(attempt, time.Second, pushMaxBackoff)
+		attempt++
+		log.Printf("[PUSH] Disconnected from %s: %v (retrying in %s)", p.URL, err, wait.Round(time.Millisecond))
+		time.Sleep(wait)
+	}
+}
+
+// session holds one connection to the hub and sends it everything queued,
+// oldest first, until the connection fails
+func (p *PushClient) session() error {
+	header := http.Header{}
+	header.Set("Authorization", "Bearer "+p.Token)
+	header.Set("X-Chowkidar-Server", p.Name)
+	dialer := websocket.Dialer{
+		HandshakeTimeout:  fleetDialTimeout,
+		EnableCompression: true,
+	}
+	conn, resp, err := dialer.Dial(p.URL, header)
+	if err != nil {
+		if resp != nil {
+			return fmt.Errorf("dial failed: %s", resp.Status)
+		}
+		return err
+	}
+	defer conn.Close()
+	log.Printf("[PUSH] Connected to %s as %s", p.URL, p.Name)
+	p.queue.SetOnline(true)
+	defer p.queue.SetOnline(false)
+
+	readErr := make(chan error, 1)
+	go func() {
+		readErr <- p.readRequests(conn)
+	}()
+
+	if backlog := p.queue.Len(); backlog > 1 {
+		log.Printf("[PUSH] Replaying %d buffered messages", backlog)
+	}
+	for {
+		// An entry is only removed once it has been written to the hub
+		if seq, data, ok := p.queue.Peek(); ok {
+			if err := p.writeRaw(conn, data); err != nil {
+				return err
+			}
+			p.queue.Ack(seq)
+			continue
+		}
+
+		select {
+		case err := <-readErr:
+			return err
+		case <-p.queue.Ready():
+		}
+	}
+}
+
+// readRequests answers tunnelled API requests until the connection fails
+func (p *PushClient) readRequests(conn *websocket.Conn) error {
+	// The hub pings every 30s; a silent hub is treated as gone
+	conn.SetReadDeadline(time.Now().Add(fleetReadTimeout))
+	conn.SetPingHandler(func(data string) error {
+		conn.SetReadDeadline(time.Now().Add(fleetReadTimeout))
+		return conn.WriteControl(websocket.PongMessage, []byte(data), time.Now().Add(fleetDialTimeout))
+	})
+
+	for {
+		var msg WebSocketMessage
+		if err := conn.ReadJSON(&msg); err != nil {
+			return err
+		}
+		conn.SetReadDeadline(time.Now().Add(fleetReadTimeout))
+		if msg.Type != "request" {
+			continue
+		}
+
+		go func(msg WebSocketMessage) {
+			var req models.TunnelRequest
+			resp := models.TunnelResponse{}
+			if err := convertData(msg.Data, &req); err != nil {
+				resp = tunnelError(http.StatusBadRequest, "malformed request")
+			} else {
+				resp = p.serve(req, conn.RemoteAddr().String())
+			}
+			if err := p.write(conn, WebSocketMessage{Type: "response", Timestamp: time.Now(), ID: msg.ID, Data: resp}); err != nil {
+				log.Printf("[PUSH] Could not send response: %v", err)
+			}
+		}(msg)
+	}
+}
+
+// serve runs a tunnelled request against the local API. Only GETs are accepted,
+// and streaming endpoints are refused.
+func (p *PushClient) serve(req models.TunnelRequest, hubAddr string) models.TunnelResponse {
+	if req.Method != http.MethodGet {
+		return tunnelError(http.StatusMethodNotAllowed, "only GET requests can be tunnelled")
+	}
+	target, err := parseAgentPath(req.Path)
+	if err != nil {
+		return tunnelError(http.StatusBadRequest, err.Error())
+	}
+	switch {
+	case target.Path == "/ws", target.Path == "/stream", strings.HasPrefix(target.Path, "/fleet/"):
+		return tunnelError(http.StatusForbidden, "streaming endpoints cannot be tunnelled")
+	}
+
+	// The tunnel token authenticates the request; the context mark lets it past
+	// the IP allowlist, which would otherwise judge the hub's address
+	ctx := context.WithValue(context.Background(), tunnelledKey{}, true)
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodGet, target.RequestURI(), nil)
+	if err != nil {
+		return tunnelError(http.StatusBadRequest, err.Error())
+	}
+	httpReq.RemoteAddr = hubAddr
+	httpReq.Header.Set("Authorization", "Bearer "+p.tunnelToken)
+
+	recorder := httptest.NewRecorder()
+	p.handler.ServeHTTP(recorder, httpReq)
+
+	body := recorder.Body.Bytes()
+	if len(body) > maxTunnelBody {
+		return tunnelError(http.StatusInsufficientStorage, "response too large to tunnel")
+	}
+	return models.TunnelResponse{
+		Status:      recorder.Code,
+		ContentType: recorder.Header().Get("Content-Type"),
+		Body:        string(body),
+	}
+}
+
+// write sends one message to the hub; writes from the pusher and request handlers are serialised
+func (p *PushClient) write(conn *websocket.Conn, msg WebSocketMessage) error {
+	p.writeMu.Lock()
+	defer p.writeMu.Unlock()
+	conn.SetWriteDeadline(time.Now().Add(fleetDialTimeout))
+	return conn.WriteJSON(msg)
+}
+
+// writeRaw sends an already-encoded message to the hub
+func (p *PushClient) writeRaw(conn *websocket.Conn, data []byte) error {
+	p.writeMu.Lock()
+	defer p.writeMu.Unlock()
+	conn.SetWriteDeadline(time.Now().Add(fleetDialTimeout))
+	return conn.WriteMessage(websocket.TextMessage, data)
+}
+
+// tunnelledKey marks requests that arrived over the push tunnel
+type tunnelledKey struct{}
+
+// IsTunnelled reports whether a request came from the hub over the push tunnel.
+// Only the push client sets the mark; it cannot be sent by a remote client.
+func IsTunnelled(r *http.Request) bool {
+	tunnelled, _ := r.Context().Value(tunnelledKey{}).(bool)
+	return tunnelled
+}
+
+// tokenServerName reads the server name from a hub token. The signature is not
+// checked: only the hub can verify it, and it does so on connect.
+func tokenServerName(token string) string {
+	claims := &CustomClaims{}
+	if _, _, err := jwt.NewParser().ParseUnverified(token, claims); err != nil {
+		return ""
+	}
+	return claims.ServerName
+}
+
+// tunnelError builds a JSON error response in the API's usual shape
+func tunnelError(status int, message string) models.TunnelResponse {
+	body, _ := json.Marshal(map[string]string{"error": message})
+	return models.TunnelResponse{Status: status, ContentType: "application/json", Body: string(body)}
+}
+
+// hubPushURL turns a hub base URL (http, https, ws or wss) into its /fleet/push URL
+func hubPushURL(raw string) (string, error) {
+	parsed, err := url.Parse(raw)
+	if err != nil {
+		return "", fmt.Errorf("invalid CHOWKIDAR_PUSH_URL: %w", err)
+	}
+	switch parsed.Scheme {
+	case "http":
+		parsed.Scheme = "ws"
+	case "https":
+		parsed.Scheme = "wss"
+	case "ws", "wss":
+	default:
+		return "", errors.New("CHOWKIDAR_PUSH_URL must start with http://, https://, ws:// or wss://")
+	}
+	if parsed.Host == "" {
+		return "", errors.New("CHOWKIDAR_PUSH_URL must include a host")
+	}
+	if parsed.Path == "" || parsed.Path == "/" {
+		parsed.Path = "/fleet/push"
+	}
+	return parsed.String(), nil
+}
+
+// jitteredBackoff returns the wait before retry number attempt: exponential from
+// base up to max, randomised to between half and all of it so agents that lost
+// the hub together do not reconnect in lockstep
+func jitteredBackoff(attempt int, base, max time.Duration) time.Duration {
+	wait := max
+	if attempt < 63 && base <= max>>attempt { // Compared before shifting so it cannot overflow
+		wait = base << attempt
+	}
+	return wait/2 + time.Duration(rand.Int63n(int64(wait/2)+1))
+}
+
+// convertData decodes a generic message payload (as produced by JSON decoding) into v
+func convertData(data interface{}, v interface{}) error {
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(raw, v)
+}
@@ -0,0 +1,41 @@
+package services
+
+import (
+	"testing"
+	"time"
+)
+
+func TestJitteredBackoff(t *testing.T) {
+	tests := []struct {
+		name    string
+		attempt int
+		base    time.Duration
+		max     time.Duration
+		want    time.Duration // Jitter picks between half of it and all of it
+	}{
+		{name: "first retry", attempt: 0, base: time.Second, max: time.Minute, want: time.Second},
+		{name: "doubles", attempt: 1, base: time.Second, max: time.Minute, want: 2 * time.Second},
+		{name: "keeps doubling", attempt: 5, base: time.Second, max: time.Minute, want: 32 * time.Second},
+		{name: "capped", attempt: 6, base: time.Second, max: time.Minute, want: time.Minute},
+		{name: "long outage", attempt: 40, base: time.Second, max: time.Hour, want: time.Hour},
+		{name: "attempt past the shift width", attempt: 64, base: time.Second, max: time.Minute, want: time.Minute},
+		{name: "shift would overflow", attempt: 10, base: time.Duration(1) << 60, max: time.Minute, want: time.Minute},
+		{name: "base over max", attempt: 0, base: time.Hour, max: time.Minute, want: time.Minute},
+		{name: "zero", attempt: 3, base: 0, max: time.Minute, want: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			spread := map[time.Duration]bool{}
+			for i := 0; i < 200; i++ {
+				got := jitteredBackoff(tt.attempt, tt.base, tt.max)
+				if got < tt.want/2 || got > tt.want {
+					t.Fatalf("jitteredBackoff(%d, %s, %s) = %s, want between %s and %s", tt.attempt, tt.base, tt.max, got, tt.want/2, tt.want)
+				}
+				spread[got] = true
+			}
+			if tt.want > 0 && len(spread) < 2 {
+				t.Errorf("200 waits were all %v: no jitter", spread)
+			}
+		})
+	}
+}
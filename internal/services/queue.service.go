@@ -0,0 +1,304 @@
+package services
+
+import (
+	"chowkidar/internal/models"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// queueEntrySuffix marks queue entry files; the name before it is the sequence number
+const queueEntrySuffix = ".entry"
+
+// OutboundQueue is a disk-backed FIFO for data bound for a remote that may be
+// unreachable (a hub, an exporter). While the consumer reports the remote online
+// and the backlog is short, entries are kept in memory; otherwise each entry is
+// one file, so buffered data survives restarts. When the queue grows past
+// MaxBytes the oldest entries are dropped.
+type OutboundQueue struct {
+	Name      string
+	Dir       string
+	MaxBytes  int64
+	MaxMemory int // Entries kept in memory before the backlog is spilled to disk
+
+	mu       sync.Mutex
+	entries  []queueEntry // Oldest first
+	inMemory int          // Entries with no file
+	online   bool         // Set by the consumer; entries go to disk until it is
+	bytes    int64
+	nextSeq  uint64
+	enqueued uint64
+	sent     uint64
+	dropped  uint64
+	ready    chan struct{} // Signalled when an entry is added
+}
+
+// queueEntry is one buffered item, held in data until it is written to disk
+type queueEntry struct {
+	seq     uint64
+	size    int64
+	addedAt time.Time
+	data    []byte // nil once on disk
+}
+
+var (
+	queuesMu sync.Mutex
+	queues   = map[string]*OutboundQueue{}
+)
+
+// NewOutboundQueue opens (or creates) the named queue under CHOWKIDAR_QUEUE_DIR,
+// picking up entries left from a previous run. Its size limit is CHOWKIDAR_QUEUE_MAX_MB,
+// and up to CHOWKIDAR_QUEUE_MEMORY entries are held in memory while the remote is online.
+func NewOutboundQueue(name string) (*OutboundQueue, error) {
+	base := strings.TrimSpace(os.Getenv("CHOWKIDAR_QUEUE_DIR"))
+	if base == "" {
+		base = defaultStateFile("queue")
+	}
+
+	q := &OutboundQueue{
+		Name:      name,
+		Dir:       filepath.Join(base, name),
+		MaxBytes:  int64(intFromEnv("CHOWKIDAR_QUEUE_MAX_MB", 50)) << 20,
+		MaxMemory: intFromEnv("CHOWKIDAR_QUEUE_MEMORY", 100),
+		nextSeq:   1,
+		ready:     make(chan struct{}, 1),
+	}
+	if err := os.MkdirAll(q.Dir, 0700); err != nil {
+		return nil, err
+	}
+	if err := q.load(); err != nil {
+		return nil, err
+	}
+	if len(q.entries) > 0 {
+		log.Printf("[QUEUE] %s: %d buffered entries from a previous run", name, len(q.entries))
+		q.signal()
+	}
+
+	queuesMu.Lock()
+	queues[name] = q
+	queuesMu.Unlock()
+	return q, nil
+}
+
+// OutboundQueues returns the stats of every open queue, sorted by name
+func OutboundQueues() []models.QueueStats {
+	queuesMu.Lock()
+	list := make([]*OutboundQueue, 0, len(queues))
+	for _, q := range queues {
+		list = append(list, q)
+	}
+	queuesMu.Unlock()
+
+	stats := make([]models.QueueStats, 0, len(list))
+	for _, q := range list {
+		stats = append(stats, q.Stats())
+	}
+	sort.Slice(stats, func(i, j int) bool {
+		return stats[i].Name < stats[j].Name
+	})
+	return stats
+}
+
+// Push appends an entry, dropping the oldest entries if the queue is over its size limit.
+// The entry stays in memory while the remote is online and the backlog is under
+// MaxMemory; otherwise it, and any backlog still in memory, is written to disk.
+func (q *OutboundQueue) Push(data []byte) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	entry := queueEntry{seq: q.nextSeq, size: int64(len(data)), addedAt: time.Now()}
+	if q.online && q.inMemory < q.MaxMemory {
+		entry.data = data
+		q.inMemory++
+	} else {
+		if err := q.writeEntry(entry.seq, data); err != nil {
+			return err
+		}
+		q.spillLocked()
+	}
+
+	q.nextSeq++
+	q.enqueued++
+	q.entries = append(q.entries, entry)
+	q.bytes += entry.size
+
+	for q.MaxBytes > 0 && q.bytes > q.MaxBytes && len(q.entries) > 1 {
+		q.removeLocked(q.entries[0])
+		q.entries = q.entries[1:]
+		q.dropped++
+	}
+	q.signal()
+	return nil
+}
+
+// Peek returns the oldest entry without removing it
+func (q *OutboundQueue) Peek() (uint64, []byte, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for len(q.entries) > 0 {
+		entry := q.entries[0]
+		if entry.data != nil {
+			return entry.seq, entry.data, true
+		}
+		data, err := os.ReadFile(q.entryPath(entry.seq))
+		if err == nil {
+			return entry.seq, data, true
+		}
+		// Unreadable entries (removed or corrupted on disk) are skipped
+		log.Printf("[QUEUE] %s: skipping entry %d: %v", q.Name, entry.seq, err)
+		q.removeLocked(entry)
+		q.entries = q.entries[1:]
+		q.dropped++
+	}
+	return 0, nil, false
+}
+
+// Ack removes an entry once it has been delivered. Entries already evicted are ignored.
+func (q *OutboundQueue) Ack(seq uint64) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if len(q.entries) == 0 || q.entries[0].seq != seq {
+		return
+	}
+	q.removeLocked(q.entries[0])
+	q.entries = q.entries[1:]
+	q.sent++
+}
+
+// SetOnline records whether the consumer can reach the remote. Going offline
+// writes the in-memory backlog to disk so it survives a restart.
+func (q *OutboundQueue) SetOnline(online bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.online = online
+	if !online {
+		q.spillLocked()
+	}
+}
+
+// Ready is signalled when entries are added; consumers drain with Peek/Ack until empty, then wait on it
+func (q *OutboundQueue) Ready() <-chan struct{} {
+	return q.ready
+}
+
+// Len returns the number of entries waiting
+func (q *OutboundQueue) Len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.entries)
+}
+
+// Stats reports the queue's depth and counters
+func (q *OutboundQueue) Stats() models.QueueStats {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	stats := models.QueueStats{
+		Name:      q.Name,
+		Depth:     len(q.entries),
+		InMemory:  q.inMemory,
+		Bytes:     q.bytes,
+		MaxBytes:  q.MaxBytes,
+		Enqueued:  q.enqueued,
+		Sent:      q.sent,
+		Dropped:   q.dropped,
+		Directory: q.Dir,
+	}
+	if len(q.entries) > 0 {
+		oldest := q.entries[0].addedAt
+		stats.OldestAt = &oldest
+	}
+	return stats
+}
+
+// signal wakes a waiting consumer without blocking
+func (q *OutboundQueue) signal() {
+	select {
+	case q.ready <- struct{}{}:
+	default:
+	}
+}
+
+// writeEntry stores an entry's file, renaming it into place so a crash never leaves half an entry
+func (q *OutboundQueue) writeEntry(seq uint64, data []byte) error {
+	path := q.entryPath(seq)
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return nil
+}
+
+// spillLocked writes the entries held in memory to disk. Entries that cannot be
+// written stay in memory. Caller must hold q.mu.
+func (q *OutboundQueue) spillLocked() {
+	for i := 0; q.inMemory > 0 && i < len(q.entries); i++ {
+		entry := &q.entries[i]
+		if entry.data == nil {
+			continue
+		}
+		if err := q.writeEntry(entry.seq, entry.data); err != nil {
+			log.Printf("[QUEUE] %s: could not write entry %d to disk: %v", q.Name, entry.seq, err)
+			return
+		}
+		entry.data = nil
+		q.inMemory--
+	}
+}
+
+// removeLocked deletes an entry's file, or releases it if it is in memory. Caller must hold q.mu.
+func (q *OutboundQueue) removeLocked(entry queueEntry) {
+	q.bytes -= entry.size
+	if entry.data != nil {
+		q.inMemory--
+		return
+	}
+	if err := os.Remove(q.entryPath(entry.seq)); err != nil && !os.IsNotExist(err) {
+		log.Printf("[QUEUE] %s: could not remove entry %d: %v", q.Name, entry.seq, err)
+	}
+}
+
+// entryPath returns the file holding an entry; zero-padding keeps names in queue order
+func (q *OutboundQueue) entryPath(seq uint64) string {
+	return filepath.Join(q.Dir, fmt.Sprintf("%020d%s", seq, queueEntrySuffix))
+}
+
+// load indexes entries left on disk by a previous run
+func (q *OutboundQueue) load() error {
+	files, err := os.ReadDir(q.Dir)
+	if err != nil {
+		return err
+	}
+	for _, file := range files {
+		name := file.Name()
+		if file.IsDir() || !strings.HasSuffix(name, queueEntrySuffix) {
+			continue
+		}
+		seq, err := strconv.ParseUint(strings.TrimSuffix(name, queueEntrySuffix), 10, 64)
+		if err != nil {
+			continue
+		}
+		info, err := file.Info()
+		if err != nil {
+			continue
+		}
+		q.entries = append(q.entries, queueEntry{seq: seq, size: info.Size(), addedAt: info.ModTime()})
+		q.bytes += info.Size()
+		if seq >= q.nextSeq {
+			q.nextSeq = seq + 1
+		}
+	}
+	sort.Slice(q.entries, func(i, j int) bool {
+		return q.entries[i].seq < q.entries[j].seq
+	})
+	return nil
+}
@@ -0,0 +1,230 @@
+package services
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// newTestQueue opens a queue in a temp dir and closes it out of the queue list afterwards
+func newTestQueue(t *testing.T, dir string) *OutboundQueue {
+	t.Helper()
+	t.Setenv("CHOWKIDAR_QUEUE_DIR", dir)
+	q, err := NewOutboundQueue(t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		queuesMu.Lock()
+		delete(queues, q.Name)
+		queuesMu.Unlock()
+	})
+	return q
+}
+
+// queueFiles returns the entry files on disk, oldest first
+func queueFiles(t *testing.T, q *OutboundQueue) []string {
+	t.Helper()
+	matches, err := filepath.Glob(filepath.Join(q.Dir, "*"+queueEntrySuffix))
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := []string{}
+	for _, match := range matches {
+		names = append(names, strings.TrimLeft(strings.TrimSuffix(filepath.Base(match), queueEntrySuffix), "0"))
+	}
+	return names
+}
+
+// takeAll peeks and acks every entry, returning their contents in order
+func takeAll(q *OutboundQueue) []string {
+	drained := []string{}
+	for {
+		seq, data, ok := q.Peek()
+		if !ok {
+			return drained
+		}
+		drained = append(drained, string(data))
+		q.Ack(seq)
+	}
+}
+
+func TestOutboundQueuePushPeekAck(t *testing.T) {
+	q := newTestQueue(t, t.TempDir())
+	q.SetOnline(true)
+
+	if _, _, ok := q.Peek(); ok {
+		t.Fatal("Peek on an empty queue returned an entry")
+	}
+	for _, data := range []string{"a", "bb", "ccc"} {
+		if err := q.Push([]byte(data)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	select {
+	case <-q.Ready():
+	default:
+		t.Error("Push did not signal Ready")
+	}
+
+	seq, data, ok := q.Peek()
+	if !ok || seq != 1 || string(data) != "a" {
+		t.Fatalf("Peek = %d, %q, %v, want 1, \"a\", true", seq, data, ok)
+	}
+	if again, _, _ := q.Peek(); again != seq {
+		t.Errorf("second Peek = %d, want %d again", again, seq)
+	}
+	q.Ack(seq + 1) // Not the head: ignored
+	if q.Len() != 3 {
+		t.Errorf("Ack of a later entry removed something: %d left", q.Len())
+	}
+
+	if got, want := takeAll(q), []string{"a", "bb", "ccc"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("drained %v, want %v", got, want)
+	}
+	stats := q.Stats()
+	if stats.Depth != 0 || stats.Bytes != 0 || stats.Enqueued != 3 || stats.Sent != 3 || stats.Dropped != 0 || stats.OldestAt != nil {
+		t.Errorf("stats after draining = %+v", stats)
+	}
+	if files := queueFiles(t, q); len(files) != 0 {
+		t.Errorf("online entries written to disk: %v", files)
+	}
+}
+
+func TestOutboundQueueSpill(t *testing.T) {
+	q := newTestQueue(t, t.TempDir())
+	q.MaxMemory = 3
+
+	// Offline from the start: straight to disk
+	q.Push([]byte("a"))
+	if files := queueFiles(t, q); !reflect.DeepEqual(files, []string{"1"}) {
+		t.Errorf("offline push: files %v, want [1]", files)
+	}
+
+	q.SetOnline(true)
+	q.Ack(1)
+	q.Push([]byte("b"))
+	q.Push([]byte("c"))
+	if stats := q.Stats(); stats.InMemory != 2 || len(queueFiles(t, q)) != 0 {
+		t.Errorf("online: %d in memory, files %v; want 2 and none", stats.InMemory, queueFiles(t, q))
+	}
+
+	q.SetOnline(false)
+	if stats := q.Stats(); stats.InMemory != 0 {
+		t.Errorf("%d entries still in memory after going offline", stats.InMemory)
+	}
+	if files := queueFiles(t, q); !reflect.DeepEqual(files, []string{"2", "3"}) {
+		t.Errorf("after going offline: files %v, want [2 3]", files)
+	}
+
+	// A backlog over MaxMemory spills too, even while online
+	q.SetOnline(true)
+	q.Push([]byte("d"))
+	q.Push([]byte("e"))
+	q.Push([]byte("f")) // d, e and f fill MaxMemory
+	q.Push([]byte("g")) // Over it: g and the in-memory backlog go to disk
+	if stats := q.Stats(); stats.InMemory != 0 {
+		t.Errorf("%d entries in memory after the backlog outgrew MaxMemory", stats.InMemory)
+	}
+	if got, want := takeAll(q), []string{"b", "c", "d", "e", "f", "g"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("drained %v, want %v", got, want)
+	}
+	if files := queueFiles(t, q); len(files) != 0 {
+		t.Errorf("files left after draining: %v", files)
+	}
+}
+
+func TestOutboundQueueEviction(t *testing.T) {
+	tests := []struct {
+		name    string
+		online  bool
+		pushes  []string
+		want    []string
+		dropped uint64
+	}{
+		{name: "under the limit", pushes: []string{"aaaa", "bbbb"}, want: []string{"aaaa", "bbbb"}},
+		{name: "oldest first", pushes: []string{"aaaa", "bbbb", "cccc", "dddd"}, want: []string{"cccc", "dddd"}, dropped: 2},
+		{name: "oldest first in memory", online: true, pushes: []string{"aaaa", "bbbb", "cccc", "dddd"}, want: []string{"cccc", "dddd"}, dropped: 2},
+		{name: "big entry evicts several", pushes: []string{"aa", "bb", "cc", "dddddddd"}, want: []string{"cc", "dddddddd"}, dropped: 2},
+		{name: "oversized entry kept alone", pushes: []string{"aaaa", "bbbbbbbbbbbb"}, want: []string{"bbbbbbbbbbbb"}, dropped: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q := newTestQueue(t, t.TempDir())
+			q.MaxBytes = 10
+			q.SetOnline(tt.online)
+			for _, data := range tt.pushes {
+				if err := q.Push([]byte(data)); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			stats := q.Stats()
+			if stats.Dropped != tt.dropped {
+				t.Errorf("dropped %d, want %d", stats.Dropped, tt.dropped)
+			}
+			if !tt.online && len(queueFiles(t, q)) != len(tt.want) {
+				t.Errorf("files %v left for %d entries", queueFiles(t, q), len(tt.want))
+			}
+			if got := takeAll(q); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("drained %v, want %v", got, tt.want)
+			}
+			if stats := q.Stats(); stats.Bytes != 0 || stats.InMemory != 0 {
+				t.Errorf("after draining: %d bytes, %d in memory", stats.Bytes, stats.InMemory)
+			}
+		})
+	}
+}
+
+func TestOutboundQueueLoad(t *testing.T) {
+	dir := t.TempDir()
+	first := newTestQueue(t, dir)
+	for _, data := range []string{"a", "bb", "ccc", "dddd"} {
+		first.Push([]byte(data))
+	}
+	first.Ack(1)
+
+	// Files that are not complete entries are ignored
+	stray := map[string]string{
+		"notanumber" + queueEntrySuffix:                    "x",
+		"00000000000000000009" + queueEntrySuffix + ".tmp": "half",
+		"README": "x",
+	}
+	for name, data := range stray {
+		if err := os.WriteFile(filepath.Join(first.Dir, name), []byte(data), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	os.Mkdir(filepath.Join(first.Dir, "00000000000000000010"+queueEntrySuffix), 0700)
+
+	queuesMu.Lock()
+	delete(queues, first.Name)
+	queuesMu.Unlock()
+	q := newTestQueue(t, dir)
+
+	stats := q.Stats()
+	if stats.Depth != 3 || stats.Bytes != 2+3+4 || stats.OldestAt == nil {
+		t.Errorf("reloaded stats = %+v, want entries 2 to 4 (9 bytes)", stats)
+	}
+	select {
+	case <-q.Ready():
+	default:
+		t.Error("a reloaded backlog did not signal Ready")
+	}
+
+	q.Push([]byte("eeeee"))
+	if _, err := os.Stat(q.entryPath(5)); err != nil {
+		t.Errorf("new entries do not continue the sequence: %v", err)
+	}
+
+	// An entry removed behind the queue's back is skipped and counted as dropped
+	os.Remove(q.entryPath(2))
+	if got, want := takeAll(q), []string{"ccc", "dddd", "eeeee"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("drained %v, want %v", got, want)
+	}
+	if stats := q.Stats(); stats.Dropped != 1 || stats.Bytes != 0 {
+		t.Errorf("after draining: %d dropped, %d bytes; want 1 and 0", stats.Dropped, stats.Bytes)
+	}
+}
@@ -0,0 +1,143 @@
+package services
+
+import (
+	"chowkidar/internal/models"
+	"fmt"
+	"time"
+)
+
+// MaxReplayDuration caps replay requests to what the history collector keeps
+const MaxReplayDuration = time.Hour
+
+// replayRequest asks the hub to backfill a client with history newer than since
+type replayRequest struct {
+	client *ClientConnection
+	since  time.Time
+}
+
+// Replay queues a history backfill for a client. The hub sends it between ticks,
+// so live stats continue right after "replay_complete" with no gap or overlap.
+func (h *WebSocketHub) Replay(client *ClientConnection, duration time.Duration) error {
+	if h.Relay {
+		return fmt.Errorf("replay is not available on this stream")
+	}
+	if duration <= 0 || duration > MaxReplayDuration {
+		return fmt.Errorf("duration must be between 0 and %s", MaxReplayDuration)
+	}
+	h.ReplaySince(client, time.Now().Add(-duration))
+	return nil
+}
+
+// EventReplay returns the "event" and "alert" messages the client is subscribed to
+// that were published after the event with the given id, oldest first. It also
+// returns that event's time (zero once it has left the buffer) and the newest
+// buffered id, past which live events are new. Event ids restart with the agent,
+// so an id newer than any published replays every buffered event.
+func EventReplay(client *ClientConnection, afterID uint64) ([]WebSocketMessage, time.Time, uint64) {
+	events := RecentEvents(models.EventFilter{})
+	if len(events) == 0 {
+		return nil, time.Time{}, 0
+	}
+	newest := events[len(events)-1].ID
+	if newest < afterID {
+		afterID = 0
+	}
+
+	var since time.Time
+	messages := []WebSocketMessage{}
+	for _, event := range events {
+		if event.ID == afterID {
+			since = event.Timestamp
+		}
+		if event.ID <= afterID {
+			continue
+		}
+		if msg := eventMessage(event); client.Subscribed(messageTopics[msg.Type]) {
+			messages = append(messages, msg)
+		}
+	}
+	return messages, since, newest
+}
+
+// ReplaySince queues a backfill of history newer than since (used for SSE
+// Last-Event-ID resume), limited to the last MaxReplayDuration
+func (h *WebSocketHub) ReplaySince(client *ClientConnection, since time.Time) {
+	if oldest := time.Now().Add(-MaxReplayDuration); since.Before(oldest) {
+		since = oldest
+	}
+	h.replay <- replayRequest{client: client, since: since}
+}
+
+// sendReplay sends one "history" message per history point, then "replay_complete".
+// It returns the client if it fell too far behind while being backfilled.
+func (h *WebSocketHub) sendReplay(req replayRequest) []*ClientConnection {
+	client := req.client
+	h.mu.RLock()
+	_, registered := h.clients[client.ID]
+	h.mu.RUnlock()
+	if !registered {
+		return nil
+	}
+
+	points := GetHistoryPoints(req.since)
+	sent := 0
+	for _, point := range points {
+		filtered := client.filterHistory(point)
+		if filtered == nil {
+			continue
+		}
+		if !h.deliver(client, WebSocketMessage{
+			Type:      "history",
+			Timestamp: point.Timestamp,
+			Seq:       client.nextSeq(),
+			Data:      filtered,
+		}) {
+			break
+		}
+		sent++
+	}
+
+	h.deliver(client, WebSocketMessage{
+		Type:      "replay_complete",
+		Timestamp: time.Now(),
+		Data: map[string]interface{}{
+			"since":  req.since,
+			"points": sent,
+			"total":  len(points),
+		},
+	})
+
+	if h.tooSlow(client) {
+		return []*ClientConnection{client}
+	}
+	return nil
+}
+
+// filterHistory returns the parts of a history point the client is subscribed to, or nil
+func (c *ClientConnection) filterHistory(point models.HistoryPoint) *models.HistoryPoint {
+	filtered := &models.HistoryPoint{Timestamp: point.Timestamp}
+	if c.Subscribed(TopicCPU) {
+		filtered.CPU = point.CPU
+	}
+	if c.Subscribed(TopicMemory) {
+		filtered.Memory = point.Memory
+	}
+	if c.Subscribed(TopicDisk) {
+		filtered.Disk = point.Disk
+	}
+	if c.Subscribed(TopicNetwork) {
+		filtered.Network = point.Network
+	}
+	if filtered.CPU == nil && filtered.Memory == nil && filtered.Disk == nil && filtered.Network == nil {
+		return nil
+	}
+	return filtered
+}
+
+// nextSeq numbers a message in the client's stats sequence
+func (c *ClientConnection) nextSeq() uint64 {
+	c.subMu.Lock()
+	defer c.subMu.Unlock()
+	c.seq++
+	return c.seq
+}
@@ -0,0 +1,60 @@
+package services
+
+import (
+	"chowkidar/internal/models"
+	"reflect"
+	"testing"
+)
+
+func TestEventReplay(t *testing.T) {
+	PublishEvent(models.Event{Type: models.EventCollectorError, Message: "before"})
+	seen := RecentEvents(models.EventFilter{Limit: 1})[0]
+	PublishEvent(models.Event{Type: models.EventCollectorError, Message: "event"})
+	PublishEvent(models.Event{Type: models.EventThresholdCrossed, Message: "alert"})
+	newest := RecentEvents(models.EventFilter{Limit: 1})[0].ID
+
+	tests := []struct {
+		name    string
+		topics  []string
+		afterID uint64
+		want    []string // Message types
+		since   bool
+	}{
+		{name: "events and alerts", topics: []string{TopicEvents, TopicAlerts}, afterID: seen.ID, want: []string{"event", "alert"}, since: true},
+		{name: "alerts only", topics: []string{TopicAlerts}, afterID: seen.ID, want: []string{"alert"}, since: true},
+		{name: "stats only", topics: []string{TopicCPU}, afterID: seen.ID, want: []string{}, since: true},
+		{name: "up to date", topics: []string{TopicEvents, TopicAlerts}, afterID: newest, want: []string{}, since: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := &ClientConnection{}
+			if err := client.Subscribe(tt.topics, 0); err != nil {
+				t.Fatal(err)
+			}
+			messages, since, last := EventReplay(client, tt.afterID)
+			types := []string{}
+			for _, msg := range messages {
+				types = append(types, msg.Type)
+			}
+			if !reflect.DeepEqual(types, tt.want) {
+				t.Errorf("EventReplay(%d) types = %v, want %v", tt.afterID, types, tt.want)
+			}
+			if !since.IsZero() != tt.since {
+				t.Errorf("EventReplay(%d) since = %v, want set %v", tt.afterID, since, tt.since)
+			}
+			if last != newest {
+				t.Errorf("EventReplay(%d) newest id = %d, want %d", tt.afterID, last, newest)
+			}
+		})
+	}
+
+	// An id from before an agent restart is newer than anything buffered
+	client := &ClientConnection{}
+	if err := client.Subscribe([]string{TopicAlerts}, 0); err != nil {
+		t.Fatal(err)
+	}
+	messages, since, _ := EventReplay(client, newest+100)
+	if len(messages) == 0 || !since.IsZero() {
+		t.Errorf("EventReplay after a restart = %d messages since %v, want every buffered alert and no history", len(messages), since)
+	}
+}
@@ -0,0 +1,391 @@
+package services
+
+import (
+	"chowkidar/internal/models"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// statsdMaxPacket is the largest datagram read; bigger ones are truncated by the kernel
+const statsdMaxPacket = 65535
+
+// StatsD metric types, by wire suffix
+var statsdTypes = map[string]string{
+	"c":  "counter",
+	"g":  "gauge",
+	"ms": "timer",
+	"h":  "histogram",
+	"d":  "distribution",
+	"s":  "set",
+}
+
+// StatsDListener receives StatsD and DogStatsD metrics over UDP and aggregates
+// them per flush interval into custom history series (see RecordCustomMetrics)
+type StatsDListener struct {
+	Address       string
+	FlushInterval time.Duration
+
+	conn net.PacketConn
+
+	mu          sync.Mutex
+	pending     map[string]*statsdAggregate // Counters, timers and sets for this interval
+	gauges      map[string]*statsdGauge     // Kept across intervals so deltas apply
+	series      int                         // Custom series pending and gauges flush to
+	lastInvalid error
+	lastFlush   time.Time
+
+	packets, samples, invalid, dropped uint64
+}
+
+// statsdSample is one parsed line
+type statsdSample struct {
+	name   string
+	kind   string
+	values []string
+	rate   float64
+	tags   map[string]string
+}
+
+// statsdAggregate accumulates one series for the current interval
+type statsdAggregate struct {
+	name   string
+	kind   string
+	tags   map[string]string
+	count  float64             // Counter total or sample count, scaled by sample rate
+	values []float64           // Timer, histogram and distribution samples
+	unique map[string]struct{} // Set members
+}
+
+// statsdGauge holds a gauge's current value
+type statsdGauge struct {
+	name     string
+	tags     map[string]string
+	value    float64
+	updated  bool // Set since the last flush
+	lastSeen time.Time
+}
+
+var statsdListener *StatsDListener
+
+// StartStatsDListener listens on CHOWKIDAR_STATSD_ADDR (e.g. ":8125") when set and
+// flushes every CHOWKIDAR_STATSD_FLUSH_INTERVAL (default 10s)
+func StartStatsDListener() (*StatsDListener, error) {
+	address := strings.TrimSpace(os.Getenv("CHOWKIDAR_STATSD_ADDR"))
+	if address == "" {
+		return nil, nil
+	}
+	conn, err := net.ListenPacket("udp", address)
+	if err != nil {
+		return nil, fmt.Errorf("could not listen for StatsD on %s: %w", address, err)
+	}
+
+	statsdListener = &StatsDListener{
+		Address:       conn.LocalAddr().String(),
+		FlushInterval: durationFromEnv("CHOWKIDAR_STATSD_FLUSH_INTERVAL", 10*time.Second),
+		conn:          conn,
+		pending:       map[string]*statsdAggregate{},
+		gauges:        map[string]*statsdGauge{},
+	}
+	go statsdListener.listen()
+	go statsdListener.flushLoop()
+	return statsdListener, nil
+}
+
+// GetStatsDStats returns listener counters, or nil when StatsD is disabled
+func GetStatsDStats() *models.StatsDStats {
+	l := statsdListener
+	if l == nil {
+		return nil
+	}
+	stats := &models.StatsDStats{
+		Address:       l.Address,
+		FlushInterval: l.FlushInterval.String(),
+		Packets:       atomic.LoadUint64(&l.packets),
+		Samples:       atomic.LoadUint64(&l.samples),
+		Invalid:       atomic.LoadUint64(&l.invalid),
+		Dropped:       atomic.LoadUint64(&l.dropped),
+	}
+	l.mu.Lock()
+	if !l.lastFlush.IsZero() {
+		lastFlush := l.lastFlush
+		stats.LastFlush = &lastFlush
+	}
+	l.mu.Unlock()
+	return stats
+}
+
+// listen reads datagrams, each holding one or more newline-separated lines
+func (l *StatsDListener) listen() {
+	buf := make([]byte, statsdMaxPacket)
+	for {
+		n, _, err := l.conn.ReadFrom(buf)
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			ReportCollectorError("statsd", err)
+			time.Sleep(100 * time.Millisecond)
+			continue
+		}
+		atomic.AddUint64(&l.packets, 1)
+
+		for _, line := range strings.Split(string(buf[:n]), "\n") {
+			line = strings.TrimSpace(line)
+			if line == "" {
+				continue
+			}
+			sample, err := parseStatsDLine(line)
+			if err != nil {
+				atomic.AddUint64(&l.invalid, 1)
+				l.mu.Lock()
+				l.lastInvalid = fmt.Errorf("%q: %w", line, err)
+				l.mu.Unlock()
+				continue
+			}
+			if sample != nil {
+				l.add(sample)
+			}
+		}
+	}
+}
+
+// parseStatsDLine parses "name:value[:value...]|type[|@rate][|#tag:value,tag]".
+// DogStatsD events and service checks are ignored (nil sample, nil error).
+func parseStatsDLine(line string) (*statsdSample, error) {
+	if strings.HasPrefix(line, "_e{") || strings.HasPrefix(line, "_sc|") {
+		return nil, nil
+	}
+
+	sections := strings.Split(line, "|")
+	if len(sections) < 2 {
+		return nil, errors.New("missing metric type")
+	}
+	name, rawValues, ok := strings.Cut(sections[0], ":")
+	if !ok || name == "" || rawValues == "" {
+		return nil, errors.New("expected name:value")
+	}
+	kind, known := statsdTypes[sections[1]]
+	if !known {
+		return nil, fmt.Errorf("unknown metric type %q", sections[1])
+	}
+
+	sample := &statsdSample{name: name, kind: kind, values: strings.Split(rawValues, ":"), rate: 1}
+	for _, section := range sections[2:] {
+		switch {
+		case strings.HasPrefix(section, "@"):
+			rate, err := strconv.ParseFloat(section[1:], 64)
+			if err != nil || rate <= 0 || rate > 1 {
+				return nil, fmt.Errorf("invalid sample rate %q", section)
+			}
+			sample.rate = rate
+		case strings.HasPrefix(section, "#"):
+			sample.tags = map[string]string{}
+			for _, tag := range strings.Split(section[1:], ",") {
+				key, value, _ := strings.Cut(tag, ":")
+				if key = strings.TrimSpace(key); key != "" {
+					sample.tags[key] = strings.TrimSpace(value)
+				}
+			}
+		}
+		// Other DogStatsD extensions (container id "c:", timestamp "T") are ignored
+	}
+
+	if err := validateCustomName(name, sample.tags); err != nil {
+		return nil, err
+	}
+	for _, value := range sample.values {
+		if value == "" {
+			return nil, errors.New("empty value")
+		}
+		if kind == "set" {
+			continue
+		}
+		// NaN and ±Inf parse, but cannot be stored or sent as JSON
+		if number, err := strconv.ParseFloat(value, 64); err != nil || !finite(number) {
+			return nil, fmt.Errorf("invalid value %q", value)
+		}
+	}
+	return sample, nil
+}
+
+// add aggregates a sample into the current interval
+func (l *StatsDListener) add(sample *statsdSample) {
+	series := CustomSeriesName(sample.name, sample.tags)
+	key := sample.kind + "|" + series
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if sample.kind == "gauge" {
+		gauge, exists := l.gauges[key]
+		if !exists {
+			if !l.roomForSeries(sample.kind) {
+				atomic.AddUint64(&l.dropped, uint64(len(sample.values)))
+				return
+			}
+			gauge = &statsdGauge{name: sample.name, tags: sample.tags}
+			l.gauges[key] = gauge
+			l.series += statsdSeriesPerKey(sample.kind)
+		}
+		for _, raw := range sample.values {
+			value, _ := strconv.ParseFloat(raw, 64)
+			// A leading sign adjusts the gauge instead of setting it
+			if raw[0] == '+' || raw[0] == '-' {
+				gauge.value += value
+			} else {
+				gauge.value = value
+			}
+		}
+		gauge.updated, gauge.lastSeen = true, time.Now()
+		atomic.AddUint64(&l.samples, uint64(len(sample.values)))
+		return
+	}
+
+	agg, exists := l.pending[key]
+	if !exists {
+		if !l.roomForSeries(sample.kind) {
+			atomic.AddUint64(&l.dropped, uint64(len(sample.values)))
+			return
+		}
+		agg = &statsdAggregate{name: sample.name, kind: sample.kind, tags: sample.tags}
+		l.pending[key] = agg
+		l.series += statsdSeriesPerKey(sample.kind)
+	}
+	for _, raw := range sample.values {
+		switch sample.kind {
+		case "set":
+			if agg.unique == nil {
+				agg.unique = map[string]struct{}{}
+			}
+			agg.unique[raw] = struct{}{}
+		case "counter":
+			value, _ := strconv.ParseFloat(raw, 64)
+			agg.count += value / sample.rate
+		default:
+			value, _ := strconv.ParseFloat(raw, 64)
+			agg.count += 1 / sample.rate
+			agg.values = append(agg.values, value)
+		}
+	}
+	atomic.AddUint64(&l.samples, uint64(len(sample.values)))
+}
+
+// roomForSeries reports whether another series of a kind may be aggregated without
+// flushing to more than CHOWKIDAR_CUSTOM_MAX_SERIES custom series (caller holds mu)
+func (l *StatsDListener) roomForSeries(kind string) bool {
+	return l.series+statsdSeriesPerKey(kind) <= historyCollector.maxCustomSeries
+}
+
+// statsdSeriesPerKey is how many custom series one aggregated series of a kind flushes to
+func statsdSeriesPerKey(kind string) int {
+	switch kind {
+	case "counter":
+		return 2 // <name> and <name>.rate
+	case "gauge", "set":
+		return 1
+	}
+	return 7 // Timers, histograms and distributions: count, min, max, mean, p50, p95, p99
+}
+
+// flushLoop records each interval's aggregates in history and pushes them to
+// WebSocket clients on the custom topic
+func (l *StatsDListener) flushLoop() {
+	ticker := time.NewTicker(l.FlushInterval)
+	defer ticker.Stop()
+	for now := range ticker.C {
+		metrics, invalid := l.flush(now)
+		if invalid != nil {
+			log.Printf("[STATSD] Ignoring invalid lines (last: %v)", invalid)
+		}
+		if len(metrics) == 0 {
+			continue
+		}
+		if accepted := recordCustomIncrements(metrics); accepted < len(metrics) {
+			atomic.AddUint64(&l.dropped, uint64(len(metrics)-accepted))
+		}
+		publishCustomMetrics(metrics, now)
+	}
+}
+
+// flush turns the current interval into series values and starts a new interval.
+// Counters are returned as the interval's increments (recordCustomIncrements adds
+// them to the running totals) and their per-second .rate as a gauge.
+func (l *StatsDListener) flush(now time.Time) ([]models.CustomMetric, error) {
+	l.mu.Lock()
+	pending := l.pending
+	l.pending = map[string]*statsdAggregate{}
+	invalid := l.lastInvalid
+	l.lastInvalid = nil
+	l.lastFlush = now
+
+	metrics := []models.CustomMetric{}
+	emit := func(name, kind string, tags map[string]string, value float64) {
+		metrics = append(metrics, models.CustomMetric{
+			Name:      CustomSeriesName(name, tags),
+			Type:      kind,
+			Tags:      tags,
+			Value:     value,
+			Timestamp: now,
+		})
+	}
+
+	for key, gauge := range l.gauges {
+		if gauge.updated {
+			emit(gauge.name, "gauge", gauge.tags, gauge.value)
+			gauge.updated = false
+		} else if now.Sub(gauge.lastSeen) > seriesRetention {
+			delete(l.gauges, key)
+		}
+	}
+	l.series = len(l.gauges)
+	l.mu.Unlock()
+
+	seconds := l.FlushInterval.Seconds()
+	for _, agg := range pending {
+		switch agg.kind {
+		case "counter":
+			emit(agg.name, agg.kind, agg.tags, agg.count)
+			emit(agg.name+".rate", "gauge", agg.tags, agg.count/seconds)
+		case "set":
+			emit(agg.name, agg.kind, agg.tags, float64(len(agg.unique)))
+		default:
+			values := agg.values
+			sort.Float64s(values)
+			sum := 0.0
+			for _, value := range values {
+				sum += value
+			}
+			emit(agg.name+".count", agg.kind, agg.tags, agg.count)
+			emit(agg.name+".min", agg.kind, agg.tags, values[0])
+			emit(agg.name+".max", agg.kind, agg.tags, values[len(values)-1])
+			emit(agg.name+".mean", agg.kind, agg.tags, sum/float64(len(values)))
+			emit(agg.name+".p50", agg.kind, agg.tags, percentile(values, 50))
+			emit(agg.name+".p95", agg.kind, agg.tags, percentile(values, 95))
+			emit(agg.name+".p99", agg.kind, agg.tags, percentile(values, 99))
+		}
+	}
+
+	sort.Slice(metrics, func(i, j int) bool {
+		return metrics[i].Name < metrics[j].Name
+	})
+	return metrics, invalid
+}
+
+// percentile returns the nearest-rank percentile of sorted values
+func percentile(sorted []float64, p float64) float64 {
+	rank := int(math.Ceil(p / 100 * float64(len(sorted))))
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
@@ -0,0 +1,153 @@
+package services
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseStatsDLine(t *testing.T) {
+	tests := []struct {
+		line    string
+		want    *statsdSample
+		wantErr bool
+	}{
+		{line: "api.requests:1|c", want: &statsdSample{name: "api.requests", kind: "counter", values: []string{"1"}, rate: 1}},
+		{line: "api.requests:3|c|@0.5", want: &statsdSample{name: "api.requests", kind: "counter", values: []string{"3"}, rate: 0.5}},
+		{line: "queue.depth:-4|g", want: &statsdSample{name: "queue.depth", kind: "gauge", values: []string{"-4"}, rate: 1}},
+		{line: "queue.depth:+2|g", want: &statsdSample{name: "queue.depth", kind: "gauge", values: []string{"+2"}, rate: 1}},
+		{line: "checkout.latency:320:280|ms", want: &statsdSample{name: "checkout.latency", kind: "timer", values: []string{"320", "280"}, rate: 1}},
+		{line: "payload.size:512|h", want: &statsdSample{name: "payload.size", kind: "histogram", values: []string{"512"}, rate: 1}},
+		{line: "payload.size:512|d", want: &statsdSample{name: "payload.size", kind: "distribution", values: []string{"512"}, rate: 1}},
+		{line: "users.online:alice|s", want: &statsdSample{name: "users.online", kind: "set", values: []string{"alice"}, rate: 1}},
+		{
+			line: "api.requests:1|c|@0.1|#env:prod,canary, region : eu",
+			want: &statsdSample{name: "api.requests", kind: "counter", values: []string{"1"}, rate: 0.1,
+				tags: map[string]string{"env": "prod", "canary": "", "region": "eu"}},
+		},
+		{line: "api.requests:1|c|c:abc123|T1700000000", want: &statsdSample{name: "api.requests", kind: "counter", values: []string{"1"}, rate: 1}},
+		{line: "_e{5,4}:title|text"},
+		{line: "_sc|db.up|0"},
+		{line: "api.requests:1", wantErr: true},
+		{line: "api.requests|c", wantErr: true},
+		{line: ":1|c", wantErr: true},
+		{line: "api.requests:|c", wantErr: true},
+		{line: "api.requests:1|x", wantErr: true},
+		{line: "api.requests:abc|c", wantErr: true},
+		{line: "api.requests:1:|c", wantErr: true},
+		{line: "api.requests:1|c|@0", wantErr: true},
+		{line: "api.requests:1|c|@1.5", wantErr: true},
+		{line: "api.requests:1|c|@fast", wantErr: true},
+		{line: "api requests:1|c", wantErr: true},
+		{line: "x:NaN|g", wantErr: true},
+		{line: "x:nan|c", wantErr: true},
+		{line: "x:Inf|g", wantErr: true},
+		{line: "x:-inf|ms", wantErr: true},
+		{line: "x:+Infinity|g", wantErr: true},
+		{line: "x:1:NaN|h", wantErr: true},
+		{line: "x:1e309|c", wantErr: true},
+		{line: "api.requests:1|c|#region:{eu}", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := parseStatsDLine(tt.line)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("parseStatsDLine(%q) = %+v, want an error", tt.line, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parseStatsDLine(%q): %v", tt.line, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parseStatsDLine(%q) = %+v, want %+v", tt.line, got, tt.want)
+		}
+	}
+}
+
+func TestStatsDFlush(t *testing.T) {
+	l := &StatsDListener{
+		FlushInterval: 10 * time.Second,
+		pending:       map[string]*statsdAggregate{},
+		gauges:        map[string]*statsdGauge{},
+	}
+	for _, line := range []string{"hits:5|c", "hits:1|c|@0.2", "temp:20|g", "temp:+1.5|g", "latency:10:30:20|ms"} {
+		sample, err := parseStatsDLine(line)
+		if err != nil {
+			t.Fatalf("parseStatsDLine(%q): %v", line, err)
+		}
+		l.add(sample)
+	}
+	if l.series != 2+1+7 {
+		t.Errorf("series = %d, want 10 (counter 2, gauge 1, timer 7)", l.series)
+	}
+
+	metrics, _ := l.flush(time.Now())
+	want := map[string]struct {
+		kind  string
+		value float64
+	}{
+		"hits":          {"counter", 10},
+		"hits.rate":     {"gauge", 1},
+		"temp":          {"gauge", 21.5},
+		"latency.count": {"timer", 3},
+		"latency.min":   {"timer", 10},
+		"latency.max":   {"timer", 30},
+		"latency.mean":  {"timer", 20},
+		"latency.p50":   {"timer", 20},
+		"latency.p95":   {"timer", 30},
+		"latency.p99":   {"timer", 30},
+	}
+	if len(metrics) != len(want) {
+		t.Errorf("flush returned %d metrics, want %d: %+v", len(metrics), len(want), metrics)
+	}
+	for _, metric := range metrics {
+		expected, ok := want[metric.Name]
+		if !ok {
+			t.Errorf("unexpected series %s", metric.Name)
+			continue
+		}
+		if metric.Type != expected.kind || metric.Value != expected.value {
+			t.Errorf("%s = %s %v, want %s %v", metric.Name, metric.Type, metric.Value, expected.kind, expected.value)
+		}
+	}
+
+	// Only gauges outlive a flush
+	if l.series != 1 {
+		t.Errorf("series after flush = %d, want 1", l.series)
+	}
+	if metrics, _ := l.flush(time.Now()); len(metrics) != 0 {
+		t.Errorf("second flush returned %+v, want nothing", metrics)
+	}
+}
+
+func TestStatsDSeriesLimit(t *testing.T) {
+	limit := historyCollector.maxCustomSeries
+	historyCollector.maxCustomSeries = 10
+	defer func() { historyCollector.maxCustomSeries = limit }()
+
+	l := &StatsDListener{pending: map[string]*statsdAggregate{}, gauges: map[string]*statsdGauge{}}
+	tests := []struct {
+		line    string
+		dropped uint64 // So far
+	}{
+		{line: "a:1|ms"},                  // 7 series
+		{line: "b:1|c"},                   // 9
+		{line: "c:1|c", dropped: 1},       // Would be 11
+		{line: "d:1|g", dropped: 1},       // 10
+		{line: "e:1|s", dropped: 2},       // Full
+		{line: "a:2|ms", dropped: 2},      // Existing series still aggregate
+		{line: "a:3|ms|#x:y", dropped: 3}, // New tags are a new series
+	}
+	for _, tt := range tests {
+		sample, err := parseStatsDLine(tt.line)
+		if err != nil {
+			t.Fatalf("parseStatsDLine(%q): %v", tt.line, err)
+		}
+		l.add(sample)
+		if l.dropped != tt.dropped {
+			t.Errorf("after %q: dropped = %d, want %d", tt.line, l.dropped, tt.dropped)
+		}
+	}
+}
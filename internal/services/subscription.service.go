@@ -0,0 +1,173 @@
+package services
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// WebSocket topics a client can subscribe to
+const (
+	TopicCPU       = "cpu"
+	TopicMemory    = "memory"
+	TopicDisk      = "disk"
+	TopicNetwork   = "network"
+	TopicProcesses = "processes"
+	TopicAlerts    = "alerts"
+	TopicEvents    = "events"
+	TopicCustom    = "custom"
+)
+
+// Subscription limits
+const (
+	DefaultUpdateInterval = 1 * time.Second
+	MinUpdateInterval     = 1 * time.Second
+	MaxUpdateInterval     = 1 * time.Hour
+)
+
+// statsTopics are the topics carried in the periodic "stats" message, one per
+// registered collector (see RegisterCollector)
+var statsTopics = []string{}
+
+// validTopics lists every topic accepted by subscribe/unsubscribe; collectors add theirs
+var validTopics = map[string]bool{
+	TopicAlerts: true,
+	TopicEvents: true,
+	TopicCustom: true,
+}
+
+// messageTopics maps pushed (non-stats) message types to the topic that gates them.
+// Types not listed here go to every client.
+var messageTopics = map[string]string{
+	"alert":          TopicAlerts,
+	"event":          TopicEvents,
+	"custom_metrics": TopicCustom,
+}
+
+// allStatsTopics returns every stats topic, for collecting full snapshots
+func allStatsTopics() map[string]bool {
+	topics := make(map[string]bool, len(statsTopics))
+	for _, topic := range statsTopics {
+		topics[topic] = true
+	}
+	return topics
+}
+
+// ValidTopics returns all subscribable topic names, sorted
+func ValidTopics() []string {
+	topics := make([]string, 0, len(validTopics))
+	for topic := range validTopics {
+		topics = append(topics, topic)
+	}
+	sort.Strings(topics)
+	return topics
+}
+
+// initSubscription subscribes a new client to everything at the default rate
+func (c *ClientConnection) initSubscription() {
+	c.subMu.Lock()
+	defer c.subMu.Unlock()
+	if c.topics != nil {
+		return
+	}
+	c.topics = make(map[string]bool, len(validTopics))
+	for topic := range validTopics {
+		c.topics[topic] = true
+	}
+	c.interval = DefaultUpdateInterval
+}
+
+// Subscribe replaces the client's topics (if any are given) and update interval (if non-zero)
+func (c *ClientConnection) Subscribe(topics []string, interval time.Duration) error {
+	for _, topic := range topics {
+		if !validTopics[topic] {
+			return fmt.Errorf("unknown topic %q", topic)
+		}
+	}
+	if interval != 0 && (interval < MinUpdateInterval || interval > MaxUpdateInterval) {
+		return fmt.Errorf("interval must be between %s and %s", MinUpdateInterval, MaxUpdateInterval)
+	}
+
+	c.initSubscription()
+
+	c.subMu.Lock()
+	defer c.subMu.Unlock()
+	if len(topics) > 0 {
+		c.topics = make(map[string]bool, len(topics))
+		for _, topic := range topics {
+			c.topics[topic] = true
+		}
+	}
+	if interval != 0 {
+		c.interval = interval
+		c.nextSend = time.Time{} // Apply the new rate from the next tick
+	}
+	return nil
+}
+
+// Unsubscribe removes topics from the client's subscription
+func (c *ClientConnection) Unsubscribe(topics []string) error {
+	for _, topic := range topics {
+		if !validTopics[topic] {
+			return fmt.Errorf("unknown topic %q", topic)
+		}
+	}
+
+	c.initSubscription()
+
+	c.subMu.Lock()
+	defer c.subMu.Unlock()
+	for _, topic := range topics {
+		delete(c.topics, topic)
+	}
+	return nil
+}
+
+// Subscription returns the client's topics (sorted) and update interval
+func (c *ClientConnection) Subscription() ([]string, time.Duration) {
+	c.initSubscription()
+
+	c.subMu.Lock()
+	defer c.subMu.Unlock()
+	topics := make([]string, 0, len(c.topics))
+	for topic := range c.topics {
+		topics = append(topics, topic)
+	}
+	sort.Strings(topics)
+	return topics, c.interval
+}
+
+// Subscribed reports whether the client receives a topic
+func (c *ClientConnection) Subscribed(topic string) bool {
+	c.initSubscription()
+
+	c.subMu.Lock()
+	defer c.subMu.Unlock()
+	return c.topics[topic]
+}
+
+// dueStatsTopics returns the stats topics to send this tick, or nil if the client
+// is not due yet (or wants no stats). Advances the client's schedule when due.
+func (c *ClientConnection) dueStatsTopics(now time.Time) map[string]bool {
+	c.initSubscription()
+
+	c.subMu.Lock()
+	defer c.subMu.Unlock()
+	if now.Before(c.nextSend) {
+		return nil
+	}
+
+	due := map[string]bool{}
+	for _, topic := range statsTopics {
+		if c.topics[topic] {
+			due[topic] = true
+		}
+	}
+	if len(due) == 0 {
+		return nil
+	}
+
+	// Allow for ticker jitter so a 1s interval fires on every 1s tick
+	c.nextSend = now.Add(c.interval - c.interval/10)
+	return due
+}
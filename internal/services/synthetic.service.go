@@ -0,0 +1,311 @@
+package services
+
+import (
+	"chowkidar/internal/models"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// syntheticBodyMax is how much of an HTTP response body is read and matched
+const syntheticBodyMax = 1 << 20
+
+// configureCheck validates a check's type-specific settings and, for the
+// synthetic types, sets the probe that runs it
+func configureCheck(check *scheduledCheck) error {
+	config := &check.config
+	if config.Type == "" {
+		config.Type = models.CheckTypeExec
+	}
+	if config.Type != models.CheckTypeExec && len(config.Command) > 0 {
+		return fmt.Errorf("command only applies to exec checks")
+	}
+
+	var err error
+	if config.WarnLatency != "" {
+		if check.warnLatency, err = time.ParseDuration(config.WarnLatency); err != nil || check.warnLatency <= 0 {
+			return fmt.Errorf("invalid warn_latency %q", config.WarnLatency)
+		}
+	}
+	if config.CritLatency != "" {
+		if check.critLatency, err = time.ParseDuration(config.CritLatency); err != nil || check.critLatency <= 0 {
+			return fmt.Errorf("invalid crit_latency %q", config.CritLatency)
+		}
+	}
+
+	switch config.Type {
+	case models.CheckTypeExec:
+		if len(config.Command) == 0 || config.Command[0] == "" {
+			return fmt.Errorf("command is required")
+		}
+	case models.CheckTypeHTTP:
+		parsed, err := url.Parse(config.URL)
+		if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+			return fmt.Errorf("url must be an http:// or https:// URL")
+		}
+		config.Method = strings.ToUpper(config.Method)
+		if config.Method == "" {
+			config.Method = http.MethodGet
+		}
+		for _, status := range config.ExpectStatus {
+			if status < 100 || status > 599 {
+				return fmt.Errorf("invalid expect_status %d", status)
+			}
+		}
+		if config.ExpectBody != "" {
+			if check.bodyPattern, err = regexp.Compile(config.ExpectBody); err != nil {
+				return fmt.Errorf("invalid expect_body: %v", err)
+			}
+		}
+		check.client = &http.Client{
+			Transport: &http.Transport{
+				TLSClientConfig:   &tls.Config{InsecureSkipVerify: config.InsecureSkipVerify},
+				DisableKeepAlives: true, // Every probe pays for a fresh connection, as clients do
+			},
+			CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		}
+		check.probe = check.probeHTTP
+	case models.CheckTypeTCP, models.CheckTypeTLS:
+		if _, port, err := net.SplitHostPort(config.Address); err != nil || port == "" {
+			return fmt.Errorf("address must be host:port")
+		}
+		check.probe = check.probeTCP
+		if config.Type == models.CheckTypeTLS {
+			if config.WarnDays == 0 {
+				config.WarnDays = 30
+			}
+			if config.CritDays == 0 {
+				config.CritDays = 7
+			}
+			if config.CritDays < 0 || config.CritDays > config.WarnDays {
+				return fmt.Errorf("crit_days must be between 0 and warn_days")
+			}
+			check.probe = check.probeTLS
+		}
+	case models.CheckTypeDNS:
+		if config.Host == "" {
+			return fmt.Errorf("host is required")
+		}
+		check.resolver = net.DefaultResolver
+		if server := config.Server; server != "" {
+			if _, _, err := net.SplitHostPort(server); err != nil {
+				server = net.JoinHostPort(server, "53")
+			}
+			check.resolver = &net.Resolver{
+				PreferGo: true,
+				Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+					var dialer net.Dialer
+					return dialer.DialContext(ctx, network, server)
+				},
+			}
+		}
+		check.probe = check.probeDNS
+	default:
+		return fmt.Errorf("unknown type %q (expected exec, http, tcp, dns or tls)", config.Type)
+	}
+	return nil
+}
+
+// checkTarget is what a synthetic check probes, for /checks
+func checkTarget(config models.CheckConfig) string {
+	switch config.Type {
+	case models.CheckTypeHTTP:
+		return config.URL
+	case models.CheckTypeDNS:
+		return config.Host
+	}
+	return config.Address
+}
+
+// probeHTTP requests the URL and checks the status, body and response time
+func (c *scheduledCheck) probeHTTP(ctx context.Context) (int, string, []models.PerfData) {
+	req, err := http.NewRequestWithContext(ctx, c.config.Method, c.config.URL, nil)
+	if err != nil {
+		return probeResult("HTTP", 3, err.Error())
+	}
+	req.Header.Set("User-Agent", "chowkidar-check")
+
+	start := time.Now()
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return c.probeFailed("HTTP", ctx, err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, syntheticBodyMax))
+	elapsed := time.Since(start)
+	if err != nil {
+		return c.probeFailed("HTTP", ctx, err)
+	}
+
+	perfData := []string{c.latencyPerfData(elapsed), fmt.Sprintf("size=%dB;;;0", len(body))}
+	if !c.statusExpected(resp.StatusCode) {
+		return probeResult("HTTP", 2, fmt.Sprintf("unexpected status %s in %.3fs", resp.Status, elapsed.Seconds()), perfData...)
+	}
+	if c.bodyPattern != nil && !c.bodyPattern.Match(body) {
+		return probeResult("HTTP", 2, fmt.Sprintf("body does not match %q", c.config.ExpectBody), perfData...)
+	}
+	return probeResult("HTTP", c.latencyState(elapsed), fmt.Sprintf("%s in %.3fs", resp.Status, elapsed.Seconds()), perfData...)
+}
+
+// statusExpected reports whether an HTTP status passes (default: below 400)
+func (c *scheduledCheck) statusExpected(status int) bool {
+	if len(c.config.ExpectStatus) == 0 {
+		return status < 400
+	}
+	for _, expected := range c.config.ExpectStatus {
+		if status == expected {
+			return true
+		}
+	}
+	return false
+}
+
+// probeTCP opens and closes a connection
+func (c *scheduledCheck) probeTCP(ctx context.Context) (int, string, []models.PerfData) {
+	var dialer net.Dialer
+	start := time.Now()
+	conn, err := dialer.DialContext(ctx, "tcp", c.config.Address)
+	if err != nil {
+		return c.probeFailed("TCP", ctx, err)
+	}
+	elapsed := time.Since(start)
+	conn.Close()
+	return probeResult("TCP", c.latencyState(elapsed),
+		fmt.Sprintf("connected to %s in %.3fs", c.config.Address, elapsed.Seconds()), c.latencyPerfData(elapsed))
+}
+
+// probeDNS resolves the host and checks the expected addresses are returned
+func (c *scheduledCheck) probeDNS(ctx context.Context) (int, string, []models.PerfData) {
+	start := time.Now()
+	addresses, err := c.resolver.LookupHost(ctx, c.config.Host)
+	if err != nil {
+		return c.probeFailed("DNS", ctx, err)
+	}
+	elapsed := time.Since(start)
+
+	perfData := []string{c.latencyPerfData(elapsed), fmt.Sprintf("addresses=%d;;;0", len(addresses))}
+	found := map[string]bool{}
+	for _, address := range addresses {
+		found[normalizeIP(address)] = true
+	}
+	for _, expected := range c.config.ExpectAddresses {
+		if !found[normalizeIP(expected)] {
+			return probeResult("DNS", 2, fmt.Sprintf("%s resolves to %s, expected %s", c.config.Host, strings.Join(addresses, ", "), expected), perfData...)
+		}
+	}
+	return probeResult("DNS", c.latencyState(elapsed),
+		fmt.Sprintf("%s resolves to %s in %.3fs", c.config.Host, strings.Join(addresses, ", "), elapsed.Seconds()), perfData...)
+}
+
+// probeTLS completes a TLS handshake and checks how long the certificate has left.
+// The chain is verified after the handshake rather than during it, so an expired
+// or untrusted certificate still reports its days left.
+func (c *scheduledCheck) probeTLS(ctx context.Context) (int, string, []models.PerfData) {
+	host, _, _ := net.SplitHostPort(c.config.Address)
+	var verifyErr error
+	dialer := tls.Dialer{Config: &tls.Config{
+		ServerName:         host,
+		InsecureSkipVerify: true,
+		VerifyConnection: func(state tls.ConnectionState) error {
+			if !c.config.InsecureSkipVerify && len(state.PeerCertificates) > 0 {
+				verifyErr = verifyCertificate(host, state.PeerCertificates)
+			}
+			return nil
+		},
+	}}
+	conn, err := dialer.DialContext(ctx, "tcp", c.config.Address)
+	if err != nil {
+		return c.probeFailed("TLS", ctx, err)
+	}
+	defer conn.Close()
+
+	certs := conn.(*tls.Conn).ConnectionState().PeerCertificates
+	if len(certs) == 0 {
+		return probeResult("TLS", 2, "no certificate presented")
+	}
+	cert := certs[0]
+	days := time.Until(cert.NotAfter).Hours() / 24
+	perfData := fmt.Sprintf("days=%.2f;%d;%d", days, c.config.WarnDays, c.config.CritDays)
+	subject := cert.Subject.CommonName
+	if subject == "" && len(cert.DNSNames) > 0 {
+		subject = cert.DNSNames[0]
+	}
+	expiry := cert.NotAfter.UTC().Format("2006-01-02")
+
+	switch {
+	case days < 0:
+		return probeResult("TLS", 2, fmt.Sprintf("certificate for %s expired on %s", subject, expiry), perfData)
+	case verifyErr != nil:
+		return probeResult("TLS", 2, fmt.Sprintf("certificate for %s failed verification: %v", subject, verifyErr), perfData)
+	case days < float64(c.config.CritDays):
+		return probeResult("TLS", 2, fmt.Sprintf("certificate for %s expires in %.0f days (%s)", subject, days, expiry), perfData)
+	case days < float64(c.config.WarnDays):
+		return probeResult("TLS", 1, fmt.Sprintf("certificate for %s expires in %.0f days (%s)", subject, days, expiry), perfData)
+	}
+	return probeResult("TLS", 0, fmt.Sprintf("certificate for %s expires in %.0f days (%s)", subject, days, expiry), perfData)
+}
+
+// verifyCertificate checks a presented chain against the system roots and the host name
+func verifyCertificate(host string, certs []*x509.Certificate) error {
+	intermediates := x509.NewCertPool()
+	for _, cert := range certs[1:] {
+		intermediates.AddCert(cert)
+	}
+	_, err := certs[0].Verify(x509.VerifyOptions{DNSName: host, Intermediates: intermediates})
+	return err
+}
+
+// probeFailed reports a failed probe as CRITICAL
+func (c *scheduledCheck) probeFailed(kind string, ctx context.Context, err error) (int, string, []models.PerfData) {
+	if ctx.Err() == context.DeadlineExceeded {
+		return probeResult(kind, 2, fmt.Sprintf("timed out after %s", c.timeout))
+	}
+	return probeResult(kind, 2, err.Error())
+}
+
+// latencyState applies warn_latency and crit_latency to a response time
+func (c *scheduledCheck) latencyState(elapsed time.Duration) int {
+	switch {
+	case c.critLatency > 0 && elapsed >= c.critLatency:
+		return 2
+	case c.warnLatency > 0 && elapsed >= c.warnLatency:
+		return 1
+	}
+	return 0
+}
+
+// latencyPerfData formats a response time and its thresholds as "time" perfdata
+func (c *scheduledCheck) latencyPerfData(elapsed time.Duration) string {
+	threshold := func(limit time.Duration) string {
+		if limit <= 0 {
+			return ""
+		}
+		return fmt.Sprintf("%.6f", limit.Seconds())
+	}
+	return fmt.Sprintf("time=%.6fs;%s;%s;0", elapsed.Seconds(), threshold(c.warnLatency), threshold(c.critLatency))
+}
+
+// probeResult formats a probe outcome like plugin output, e.g. "TCP OK - connected
+// to db:5432 in 0.001s" and "time=0.001000s;;;0". The text is kept apart from the
+// perfdata, so a "|" in it (an error, a body pattern) is not mistaken for one.
+func probeResult(kind string, code int, text string, perfData ...string) (int, string, []models.PerfData) {
+	return code, fmt.Sprintf("%s %s - %s", kind, models.CheckStates[code], text), parsePerfData(strings.Join(perfData, " "))
+}
+
+// normalizeIP returns the canonical form of an IP address, or the input unchanged
+func normalizeIP(address string) string {
+	if ip := net.ParseIP(address); ip != nil {
+		return ip.String()
+	}
+	return address
+}
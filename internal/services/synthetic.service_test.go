@@ -0,0 +1,284 @@
+package services
+
+import (
+	"chowkidar/internal/models"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/binary"
+	"fmt"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// runProbe configures a synthetic check and probes it once
+func runProbe(t *testing.T, config models.CheckConfig) (string, string, []models.PerfData) {
+	t.Helper()
+	check := &scheduledCheck{config: config, timeout: 2 * time.Second}
+	if err := configureCheck(check); err != nil {
+		t.Fatalf("configureCheck(%+v): %v", config, err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), check.timeout)
+	defer cancel()
+	code, text, perfData := check.probe(ctx)
+	return models.CheckStates[code], text, perfData
+}
+
+// perfDataLabels lists the labels of perfdata entries
+func perfDataLabels(perfData []models.PerfData) string {
+	labels := []string{}
+	for _, entry := range perfData {
+		labels = append(labels, entry.Label)
+	}
+	return strings.Join(labels, ",")
+}
+
+func TestProbeHTTP(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/health":
+			fmt.Fprint(w, "status: healthy")
+		case "/moved":
+			http.Redirect(w, r, "/health", http.StatusFound)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name   string
+		config models.CheckConfig
+		state  string
+		text   string // Substring of the output
+	}{
+		{name: "ok", config: models.CheckConfig{URL: server.URL + "/health"}, state: models.CheckOK, text: "HTTP OK - 200 OK in"},
+		{name: "not found", config: models.CheckConfig{URL: server.URL + "/missing"}, state: models.CheckCritical, text: "unexpected status 404 Not Found"},
+		{name: "expected status", config: models.CheckConfig{URL: server.URL + "/missing", ExpectStatus: []int{404}}, state: models.CheckOK},
+		{name: "redirect not followed", config: models.CheckConfig{URL: server.URL + "/moved", ExpectStatus: []int{200}}, state: models.CheckCritical, text: "302 Found"},
+		{name: "body matches", config: models.CheckConfig{URL: server.URL + "/health", ExpectBody: "ok|healthy"}, state: models.CheckOK},
+		{
+			name:   "body pattern with a pipe",
+			config: models.CheckConfig{URL: server.URL + "/health", ExpectBody: "up|running"},
+			state:  models.CheckCritical, text: `body does not match "up|running"`,
+		},
+		{name: "slow", config: models.CheckConfig{URL: server.URL + "/health", WarnLatency: "1ns"}, state: models.CheckWarning},
+		{name: "very slow", config: models.CheckConfig{URL: server.URL + "/health", WarnLatency: "1ns", CritLatency: "1ns"}, state: models.CheckCritical},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.config.Type = models.CheckTypeHTTP
+			state, text, perfData := runProbe(t, tt.config)
+			if state != tt.state || !strings.Contains(text, tt.text) {
+				t.Errorf("probe = %s %q, want %s containing %q", state, text, tt.state, tt.text)
+			}
+			if labels := perfDataLabels(perfData); labels != "time,size" {
+				t.Errorf("perfdata labels = %q, want time,size", labels)
+			}
+		})
+	}
+
+	server.Close()
+	state, text, _ := runProbe(t, models.CheckConfig{Type: models.CheckTypeHTTP, URL: server.URL})
+	if state != models.CheckCritical || !strings.HasPrefix(text, "HTTP CRITICAL - ") {
+		t.Errorf("probe of a closed server = %s %q, want CRITICAL", state, text)
+	}
+}
+
+func TestProbeTCP(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	address := listener.Addr().String()
+
+	state, text, perfData := runProbe(t, models.CheckConfig{Type: models.CheckTypeTCP, Address: address})
+	if state != models.CheckOK || !strings.Contains(text, "connected to "+address) {
+		t.Errorf("probe = %s %q, want OK", state, text)
+	}
+	if labels := perfDataLabels(perfData); labels != "time" {
+		t.Errorf("perfdata labels = %q, want time", labels)
+	}
+
+	listener.Close()
+	if state, text, _ := runProbe(t, models.CheckConfig{Type: models.CheckTypeTCP, Address: address}); state != models.CheckCritical {
+		t.Errorf("probe of a closed port = %s %q, want CRITICAL", state, text)
+	}
+}
+
+// serveTLS accepts TLS connections with a fresh self-signed certificate for
+// localhost, valid until notAfter, and returns the listener's address
+func serveTLS(t *testing.T, notAfter time.Time) string {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "localhost"},
+		DNSNames:     []string{"localhost"},
+		NotBefore:    notAfter.Add(-365 * 24 * time.Hour),
+		NotAfter:     notAfter,
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	listener, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{
+		Certificates: []tls.Certificate{{Certificate: [][]byte{der}, PrivateKey: key}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			conn.(*tls.Conn).Handshake()
+			conn.Close()
+		}
+	}()
+	_, port, _ := net.SplitHostPort(listener.Addr().String())
+	return net.JoinHostPort("localhost", port)
+}
+
+func TestProbeTLS(t *testing.T) {
+	valid := serveTLS(t, time.Now().Add(90*24*time.Hour))
+	expired := serveTLS(t, time.Now().Add(-24*time.Hour))
+
+	tests := []struct {
+		name   string
+		config models.CheckConfig
+		state  string
+		text   string // Substring of the output
+	}{
+		{name: "ok", config: models.CheckConfig{Address: valid, InsecureSkipVerify: true}, state: models.CheckOK, text: "expires in 90 days"},
+		{name: "untrusted", config: models.CheckConfig{Address: valid}, state: models.CheckCritical, text: "certificate for localhost failed verification"},
+		{name: "warning", config: models.CheckConfig{Address: valid, InsecureSkipVerify: true, WarnDays: 100}, state: models.CheckWarning, text: "expires in 90 days"},
+		{name: "critical", config: models.CheckConfig{Address: valid, InsecureSkipVerify: true, WarnDays: 100, CritDays: 95}, state: models.CheckCritical, text: "expires in 90 days"},
+		{name: "expired", config: models.CheckConfig{Address: expired}, state: models.CheckCritical, text: "certificate for localhost expired on"},
+		{name: "expired, unverified", config: models.CheckConfig{Address: expired, InsecureSkipVerify: true}, state: models.CheckCritical, text: "expired on"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.config.Type = models.CheckTypeTLS
+			state, text, perfData := runProbe(t, tt.config)
+			if state != tt.state || !strings.HasPrefix(text, "TLS "+tt.state+" - ") || !strings.Contains(text, tt.text) {
+				t.Errorf("probe = %s %q, want %s containing %q", state, text, tt.state, tt.text)
+			}
+			// The expiry is reported even when the certificate fails verification
+			if len(perfData) != 1 || perfData[0].Label != "days" {
+				t.Errorf("perfdata = %+v, want days", perfData)
+			}
+		})
+	}
+
+	if state, text, _ := runProbe(t, models.CheckConfig{Type: models.CheckTypeTLS, Address: "127.0.0.1:1"}); state != models.CheckCritical {
+		t.Errorf("probe of a closed port = %s %q, want CRITICAL", state, text)
+	}
+}
+
+// serveDNS answers A queries for the given names over UDP (NXDOMAIN for others,
+// no records for other types) and returns the server's address
+func serveDNS(t *testing.T, records map[string]net.IP) string {
+	t.Helper()
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	go func() {
+		buf := make([]byte, 512)
+		for {
+			n, addr, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			query := buf[:n]
+			if len(query) < 12 {
+				continue
+			}
+			// Question: labels up to a zero byte, then type and class
+			end := 12
+			labels := []string{}
+			for end < len(query) && query[end] != 0 {
+				size := int(query[end])
+				if end+1+size > len(query) {
+					break
+				}
+				labels = append(labels, string(query[end+1:end+1+size]))
+				end += 1 + size
+			}
+			end += 5
+			if end > len(query) {
+				continue
+			}
+			qtype := binary.BigEndian.Uint16(query[end-4 : end-2])
+
+			reply := append([]byte{}, query[:2]...)                   // ID
+			reply = append(reply, 0x81, 0x80, 0, 1, 0, 0, 0, 0, 0, 0) // Response, recursion; 1 question
+			reply = append(reply, query[12:end]...)
+			ip, known := records[strings.ToLower(strings.Join(labels, "."))]
+			switch {
+			case !known:
+				reply[3] |= 3 // NXDOMAIN
+			case qtype == 1:
+				reply[7] = 1 // 1 answer
+				reply = append(reply, 0xc0, 12, 0, 1, 0, 1, 0, 0, 0, 60, 0, 4)
+				reply = append(reply, ip.To4()...)
+			}
+			conn.WriteTo(reply, addr)
+		}
+	}()
+	return conn.LocalAddr().String()
+}
+
+func TestProbeDNS(t *testing.T) {
+	server := serveDNS(t, map[string]net.IP{"web.example.test": net.IPv4(192, 0, 2, 10)})
+
+	tests := []struct {
+		name     string
+		config   models.CheckConfig
+		state    string
+		text     string // Substring of the output
+		noAnswer bool   // Failed lookups have no perfdata
+	}{
+		{name: "resolves", config: models.CheckConfig{Host: "web.example.test"}, state: models.CheckOK, text: "web.example.test resolves to 192.0.2.10 in"},
+		{name: "expected address", config: models.CheckConfig{Host: "web.example.test", ExpectAddresses: []string{"192.0.2.10"}}, state: models.CheckOK},
+		{
+			name:   "unexpected address",
+			config: models.CheckConfig{Host: "web.example.test", ExpectAddresses: []string{"192.0.2.99"}},
+			state:  models.CheckCritical, text: "resolves to 192.0.2.10, expected 192.0.2.99",
+		},
+		{name: "slow", config: models.CheckConfig{Host: "web.example.test", WarnLatency: "1ns"}, state: models.CheckWarning},
+		{name: "unknown name", config: models.CheckConfig{Host: "missing.example.test"}, state: models.CheckCritical, text: "no such host", noAnswer: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.config.Type = models.CheckTypeDNS
+			tt.config.Server = server
+			state, text, perfData := runProbe(t, tt.config)
+			if state != tt.state || !strings.HasPrefix(text, "DNS "+tt.state+" - ") || !strings.Contains(text, tt.text) {
+				t.Errorf("probe = %s %q, want %s containing %q", state, text, tt.state, tt.text)
+			}
+			if labels := perfDataLabels(perfData); !tt.noAnswer && labels != "time,addresses" {
+				t.Errorf("perfdata labels = %q, want time,addresses", labels)
+			}
+		})
+	}
+}
@@ -2,9 +2,10 @@ package services
 
 import (
 	"chowkidar/internal/models"
-	"encoding/json"
 	"log"
+	"os"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/gorilla/websocket"
@@ -17,30 +18,118 @@ type WebSocketMessage struct {
 	Data      interface{} `json:"data,omitempty"` // Can be json.RawMessage or map[string]interface{}
 	Error     string      `json:"error,omitempty"`
 	Token     string      `json:"token,omitempty"` // For auth messages from client
+
+	// Subscription fields ("subscribe"/"unsubscribe" from client, "subscribed" reply)
+	Topics     []string `json:"topics,omitempty"`
+	IntervalMs int64    `json:"interval_ms,omitempty"`
+	Mode       string   `json:"mode,omitempty"` // "full" or "delta"
+
+	// Replay window ("replay" from client), e.g. "15m"
+	Duration string `json:"duration,omitempty"`
+
+	// Stats sequencing: every stats/stats_delta message is numbered per client;
+	// a delta applies on top of the state at BaseSeq
+	Seq     uint64 `json:"seq,omitempty"`
+	BaseSeq uint64 `json:"base_seq,omitempty"`
+
+	// Agent a message came from, set on the hub-mode /fleet/ws stream
+	Server string `json:"server,omitempty"`
+	// Pairs tunnelled "request"/"response" messages on push connections
+	ID string `json:"id,omitempty"`
 }
 
 // StatsPayload represents real-time system stats
+// Only the client's subscribed topics are filled in.
 type StatsPayload struct {
-	CPU       *models.CPUStatus               `json:"cpu"`
-	Memory    *models.MemoryStatus            `json:"memory"`
-	Disk      *models.DiskStatus              `json:"disk"`
-	Network   *models.AggregatedNetworkStatus `json:"network"`
+	CPU       *models.CPUStatus               `json:"cpu,omitempty"`
+	Memory    *models.MemoryStatus            `json:"memory,omitempty"`
+	Disk      *models.DiskStatus              `json:"disk,omitempty"`
+	Network   *models.AggregatedNetworkStatus `json:"network,omitempty"`
 	Processes []models.ProcessStatus          `json:"processes,omitempty"`
-	Timestamp time.Time                       `json:"timestamp"`
+	// Latest samples of the requested collectors, by collector name (all of them
+	// for exporters; see filter for what is sent)
+	Collectors map[string][]models.Sample `json:"collectors,omitempty"`
+	Timestamp  time.Time                  `json:"timestamp"`
 }
 
 // ClientConnection represents a connected WebSocket client
 type ClientConnection struct {
-	ID    string
-	Conn  *websocket.Conn
-	Send  chan WebSocketMessage
-	Close chan bool
+	ID         string
+	IP         string
+	ServerName string
+	TokenID    string
+	Encoding   string // Wire encoding picked by subprotocol (see encoding.service.go)
+	Conn       *websocket.Conn
+	Send       chan WebSocketMessage
+	Close      chan bool
+
+	// Subscription state, guarded by subMu (see subscription.service.go)
+	subMu    sync.Mutex
+	topics   map[string]bool
+	interval time.Duration
+	nextSend time.Time
+
+	// Stats sequencing and delta state (see delta.service.go)
+	seq          uint64
+	deltaMode    bool
+	lastSnapshot map[string]interface{}
+	snapshotSeq  uint64 // seq of the message lastSnapshot was sent in
+
+	// Messages that did not fit in Send, in total and in the current slow-consumer window
+	dropped     uint64
+	windowStart time.Time
+	windowDrops int
+
+	// Set when the hub evicts the client (guarded by subMu)
+	evicted     chan struct{}
+	closeCode   int
+	closeReason string
+}
+
+// Dropped returns how many messages were discarded because the client fell behind
+func (c *ClientConnection) Dropped() uint64 {
+	return atomic.LoadUint64(&c.dropped)
+}
+
+// CloseReason returns the close code and reason set when the hub evicted the client
+func (c *ClientConnection) CloseReason() (int, string) {
+	c.subMu.Lock()
+	defer c.subMu.Unlock()
+	return c.closeCode, c.closeReason
+}
+
+// topicMessage is a pushed message gated by a topic ("" reaches every client)
+type topicMessage struct {
+	topic string
+	msg   WebSocketMessage
 }
 
 // WebSocketHub manages all connected WebSocket clients
 type WebSocketHub struct {
+	// AuthTimeout is how long an unauthenticated ("auth-first") socket may take
+	// to send a valid auth message; 0 requires the token on the upgrade request
+	AuthTimeout time.Duration
+	// AllowQueryToken accepts ?token= on upgrade (legacy, leaks into access logs)
+	AllowQueryToken bool
+	// Compression negotiates permessage-deflate (RFC 7692) with clients that offer it
+	Compression      bool
+	CompressionLevel int
+	// PongWait is how long a socket may stay silent (no pong or message) before it is reaped;
+	// PingPeriod must be shorter so live clients always answer in time
+	PongWait   time.Duration
+	PingPeriod time.Duration
+	// WriteTimeout bounds each frame write to a client
+	WriteTimeout time.Duration
+	// Clients dropping MaxDropped messages within SlowWindow are disconnected (0 = never)
+	MaxDropped int
+	SlowWindow time.Duration
+	// Relay hubs only pass on messages published to them; they never gather
+	// local stats or replay local history (used for the hub-mode fleet stream)
+	Relay bool
+
 	clients    map[string]*ClientConnection
-	broadcast  chan WebSocketMessage
+	broadcast  chan topicMessage
+	replay     chan replayRequest
 	register   chan *ClientConnection
 	unregister chan string
 	mu         sync.RWMutex
@@ -52,24 +141,50 @@ var wsHub *WebSocketHub
 
 // InitWebSocketHub initializes the WebSocket hub
 func InitWebSocketHub() *WebSocketHub {
-	wsHub = &WebSocketHub{
-		clients:    make(map[string]*ClientConnection),
-		broadcast:  make(chan WebSocketMessage, 256),
-		register:   make(chan *ClientConnection),
-		unregister: make(chan string),
-		done:       make(chan bool),
+	wsHub = newWebSocketHub(false)
+	go wsHub.forwardEvents(SubscribeEvents(256))
+	return wsHub
+}
+
+// newWebSocketHub builds a hub from the CHOWKIDAR_WS_* settings and starts its event loop
+func newWebSocketHub(relay bool) *WebSocketHub {
+	authTimeout := durationFromEnv("CHOWKIDAR_WS_AUTH_TIMEOUT", 10*time.Second)
+	if os.Getenv("CHOWKIDAR_WS_AUTH_TIMEOUT") == "0" {
+		authTimeout = 0 // Auth-first disabled
 	}
 
-	// Start the hub
-	go wsHub.run()
+	pongWait := durationFromEnv("CHOWKIDAR_WS_PONG_WAIT", 60*time.Second)
+
+	hub := &WebSocketHub{
+		AuthTimeout:      authTimeout,
+		AllowQueryToken:  os.Getenv("CHOWKIDAR_WS_QUERY_TOKEN") != "false",
+		Compression:      os.Getenv("CHOWKIDAR_WS_COMPRESSION") != "false",
+		CompressionLevel: intFromEnv("CHOWKIDAR_WS_COMPRESSION_LEVEL", 1),
+		PongWait:         pongWait,
+		PingPeriod:       pongWait * 9 / 10,
+		WriteTimeout:     durationFromEnv("CHOWKIDAR_WS_WRITE_TIMEOUT", 10*time.Second),
+		MaxDropped:       intFromEnv("CHOWKIDAR_WS_MAX_DROPPED", 30),
+		SlowWindow:       durationFromEnv("CHOWKIDAR_WS_SLOW_WINDOW", time.Minute),
+		Relay:            relay,
+		clients:          make(map[string]*ClientConnection),
+		broadcast:        make(chan topicMessage, 256),
+		replay:           make(chan replayRequest),
+		register:         make(chan *ClientConnection),
+		unregister:       make(chan string),
+		done:             make(chan bool),
+	}
 
-	return wsHub
+	// Start the hub
+	go hub.run()
+	return hub
 }
 
 // run manages the hub's event loop
 func (h *WebSocketHub) run() {
-	// Broadcast stats every second
-	h.ticker = time.NewTicker(1 * time.Second)
+	// Tick every second while clients are connected; each client is sent stats on
+	// its own interval. With no clients the ticker is paused and nothing is gathered.
+	h.ticker = time.NewTicker(MinUpdateInterval)
+	h.ticker.Stop()
 	defer h.ticker.Stop()
 
 	for {
@@ -78,97 +193,313 @@ func (h *WebSocketHub) run() {
 			return
 
 		case client := <-h.register:
+			client.initSubscription()
 			h.mu.Lock()
 			h.clients[client.ID] = client
+			total := len(h.clients)
 			h.mu.Unlock()
-			log.Printf("[WS] Client connected: %s (total: %d)", client.ID, len(h.clients))
+			if total == 1 && !h.Relay {
+				h.ticker.Reset(MinUpdateInterval)
+			}
+			log.Printf("[WS] Client connected: %s (total: %d)", client.ID, total)
 
 		case clientID := <-h.unregister:
-			h.mu.Lock()
-			if client, exists := h.clients[clientID]; exists {
-				delete(h.clients, clientID)
-				close(client.Send)
-			}
-			h.mu.Unlock()
-			log.Printf("[WS] Client disconnected: %s (total: %d)", clientID, len(h.clients))
+			h.removeClient(clientID)
 
-		case msg := <-h.broadcast:
+		case tm := <-h.broadcast:
+			var slow []*ClientConnection
 			h.mu.RLock()
 			for _, client := range h.clients {
-				select {
-				case client.Send <- msg:
-				default:
-					// Client's send channel is full, skip this message
+				if tm.topic != "" && !client.Subscribed(tm.topic) {
+					continue
+				}
+				if !h.deliver(client, tm.msg) && h.tooSlow(client) {
+					slow = append(slow, client)
 				}
 			}
 			h.mu.RUnlock()
+			h.disconnectSlow(slow)
 
-		case <-h.ticker.C:
-			// Broadcast current stats to all clients
-			stats := h.gatherStats()
-			data, err := json.Marshal(stats)
-			if err != nil {
-				log.Printf("[WS] Error marshaling stats: %v", err)
-				continue
-			}
+		case req := <-h.replay:
+			h.disconnectSlow(h.sendReplay(req))
+
+		case now := <-h.ticker.C:
+			h.disconnectSlow(h.sendDueStats(now))
+		}
+
+		h.mu.RLock()
+		idle := len(h.clients) == 0
+		h.mu.RUnlock()
+		if idle {
+			h.ticker.Stop()
+		}
+	}
+}
+
+// deliver queues a message for a client without blocking the hub and reports
+// whether it fit; misses are counted towards the slow-consumer policy
+func (h *WebSocketHub) deliver(client *ClientConnection, msg WebSocketMessage) bool {
+	select {
+	case client.Send <- msg:
+		return true
+	default:
+		// Client's send channel is full, skip this message
+		client.countDrop(h.SlowWindow)
+		return false
+	}
+}
+
+// tooSlow reports whether a client has dropped MaxDropped messages within the current window
+func (h *WebSocketHub) tooSlow(client *ClientConnection) bool {
+	client.subMu.Lock()
+	defer client.subMu.Unlock()
+	return h.MaxDropped > 0 && client.windowDrops >= h.MaxDropped
+}
+
+// countDrop records a dropped message, starting a new window when the last one has expired
+func (c *ClientConnection) countDrop(window time.Duration) {
+	atomic.AddUint64(&c.dropped, 1)
+
+	c.subMu.Lock()
+	defer c.subMu.Unlock()
+	now := time.Now()
+	if now.Sub(c.windowStart) > window {
+		c.windowStart = now
+		c.windowDrops = 0
+	}
+	c.windowDrops++
+}
+
+// disconnectSlow evicts clients that stopped draining their send queue
+func (h *WebSocketHub) disconnectSlow(clients []*ClientConnection) {
+	for _, client := range clients {
+		h.mu.Lock()
+		_, exists := h.clients[client.ID]
+		delete(h.clients, client.ID)
+		h.mu.Unlock()
+		if !exists {
+			continue
+		}
+
+		log.Printf("[WS] ⚠️  Disconnecting slow client %s (%d messages dropped)", client.ID, client.Dropped())
+		client.evict(websocket.CloseTryAgainLater, "slow consumer")
+	}
+}
+
+// removeClient drops a client from the hub and closes its send queue
+func (h *WebSocketHub) removeClient(clientID string) {
+	h.mu.Lock()
+	client, exists := h.clients[clientID]
+	if exists {
+		delete(h.clients, clientID)
+		close(client.Send)
+	}
+	total := len(h.clients)
+	h.mu.Unlock()
+
+	if exists {
+		log.Printf("[WS] Client disconnected: %s (dropped: %d, total: %d)", clientID, client.Dropped(), total)
+	}
+}
+
+// evict asks the client's write pump to close the socket with the given code.
+// Send stays open because the read pump may still be replying on it.
+func (c *ClientConnection) evict(code int, reason string) {
+	c.subMu.Lock()
+	defer c.subMu.Unlock()
+	if c.evicted == nil {
+		c.evicted = make(chan struct{})
+	}
+	select {
+	case <-c.evicted:
+		return // Already evicted
+	default:
+	}
+	c.closeCode, c.closeReason = code, reason
+	close(c.evicted)
+}
+
+// Evicted is closed when the hub drops the client; CloseReason then holds the close frame to send
+func (c *ClientConnection) Evicted() <-chan struct{} {
+	c.subMu.Lock()
+	defer c.subMu.Unlock()
+	if c.evicted == nil {
+		c.evicted = make(chan struct{})
+	}
+	return c.evicted
+}
 
-			msg := WebSocketMessage{
-				Type:      "stats",
-				Timestamp: time.Now(),
-				Data:      json.RawMessage(data),
+// sendDueStats sends each due client a stats message holding only its subscribed topics.
+// Metrics are gathered once per tick, and only for topics some due client wants.
+// It returns the clients that have fallen too far behind.
+func (h *WebSocketHub) sendDueStats(now time.Time) []*ClientConnection {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	due := map[*ClientConnection]map[string]bool{}
+	wanted := map[string]bool{}
+	for _, client := range h.clients {
+		topics := client.dueStatsTopics(now)
+		if topics == nil {
+			continue
+		}
+		due[client] = topics
+		for topic := range topics {
+			wanted[topic] = true
+		}
+	}
+	if len(due) == 0 {
+		return nil
+	}
+
+	var slow []*ClientConnection
+	stats := h.gatherStats(wanted)
+	for client, topics := range due {
+		if !h.deliver(client, client.statsMessage(stats.filter(topics))) {
+			client.statsDropped()
+			if h.tooSlow(client) {
+				slow = append(slow, client)
 			}
+		}
+	}
+	return slow
+}
+
+// typedStatsTopics are the built-in collectors whose readings have their own
+// StatsPayload field; on the wire their samples are not repeated in Collectors
+var typedStatsTopics = map[string]bool{
+	TopicCPU:       true,
+	TopicMemory:    true,
+	TopicDisk:      true,
+	TopicNetwork:   true,
+	TopicProcesses: true,
+}
 
-			select {
-			case h.broadcast <- msg:
-			default:
-				// Channel full, skip this broadcast
+// filter returns a copy of the payload holding only the given topics, as sent to
+// clients and the fleet hub: built-ins travel in their typed fields only
+func (p *StatsPayload) filter(topics map[string]bool) *StatsPayload {
+	filtered := &StatsPayload{Timestamp: p.Timestamp}
+	if topics[TopicCPU] {
+		filtered.CPU = p.CPU
+	}
+	if topics[TopicMemory] {
+		filtered.Memory = p.Memory
+	}
+	if topics[TopicDisk] {
+		filtered.Disk = p.Disk
+	}
+	if topics[TopicNetwork] {
+		filtered.Network = p.Network
+	}
+	if topics[TopicProcesses] {
+		filtered.Processes = p.Processes
+	}
+	for name, samples := range p.Collectors {
+		if topics[name] && !typedStatsTopics[name] {
+			if filtered.Collectors == nil {
+				filtered.Collectors = map[string][]models.Sample{}
 			}
+			filtered.Collectors[name] = samples
 		}
 	}
+	return filtered
+}
+
+// gatherStats collects current system statistics for the requested topics.
+// Topics of disabled collectors are left out.
+func (h *WebSocketHub) gatherStats(requested map[string]bool) *StatsPayload {
+	return h.collectStats(requested, true)
+}
+
+// backgroundStats gathers a full snapshot for push and export. It does not count
+// as a process reader, so the process scan keeps its idle rate.
+func (h *WebSocketHub) backgroundStats() *StatsPayload {
+	return h.collectStats(allStatsTopics(), false)
 }
 
-// gatherStats collects current system statistics
-func (h *WebSocketHub) gatherStats() *StatsPayload {
-	cpu, _ := GetCachedCPU()
-	memory, _ := GetCachedMemory()
-	disk, _ := GetCachedDisk()
-	networkInterfaces, _ := GetCachedNetwork()
-	processes, _, _, _ := GetCachedProcesses()
+// collectStats builds the payload; live marks process demand like other readers
+func (h *WebSocketHub) collectStats(requested map[string]bool, live bool) *StatsPayload {
+	stats := &StatsPayload{Timestamp: time.Now()}
+
+	topics := make(map[string]bool, len(requested))
+	for topic := range requested {
+		topics[topic] = CollectorEnabled(topic)
+	}
+
+	if topics[TopicCPU] {
+		stats.CPU, _ = GetCachedCPU()
+	}
+	if topics[TopicMemory] {
+		stats.Memory, _ = GetCachedMemory()
+	}
+	if topics[TopicDisk] {
+		stats.Disk, _ = GetCachedDisk()
+	}
 
 	// Build aggregated network data with real-time rates
-	var aggregatedNet *models.AggregatedNetworkStatus
-	if networkInterfaces != nil && len(networkInterfaces) > 0 {
-		totalBytesSent := uint64(0)
-		totalBytesRecv := uint64(0)
-		for _, iface := range networkInterfaces {
-			totalBytesSent += iface.BytesSent
-			totalBytesRecv += iface.BytesRecv
-		}
+	if topics[TopicNetwork] {
+		networkInterfaces, _ := GetCachedNetwork()
+		if len(networkInterfaces) > 0 {
+			totalBytesSent := uint64(0)
+			totalBytesRecv := uint64(0)
+			for _, iface := range networkInterfaces {
+				totalBytesSent += iface.BytesSent
+				totalBytesRecv += iface.BytesRecv
+			}
 
-		sentRate, recvRate := GetNetworkRates()
-		aggregatedNet = &models.AggregatedNetworkStatus{
-			BytesSent:     totalBytesSent,
-			BytesRecv:     totalBytesRecv,
-			BytesSentRate: sentRate,
-			BytesRecvRate: recvRate,
-			Interfaces:    networkInterfaces,
+			sentRate, recvRate := GetNetworkRates()
+			stats.Network = &models.AggregatedNetworkStatus{
+				BytesSent:     totalBytesSent,
+				BytesRecv:     totalBytesRecv,
+				BytesSentRate: sentRate,
+				BytesRecvRate: recvRate,
+				Interfaces:    networkInterfaces,
+			}
 		}
 	}
 
 	// Limit processes to top 10 to reduce payload
-	topProcesses := processes
-	if len(topProcesses) > 10 {
-		topProcesses = topProcesses[:10]
+	if topics[TopicProcesses] {
+		var processes []models.ProcessStatus
+		if live {
+			processes, _, _, _ = GetCachedProcesses()
+		} else {
+			processes, _, _, _ = peekCachedProcesses()
+		}
+		if len(processes) > 10 {
+			processes = processes[:10]
+		}
+		stats.Processes = processes
 	}
 
-	return &StatsPayload{
-		CPU:       cpu,
-		Memory:    memory,
-		Disk:      disk,
-		Network:   aggregatedNet,
-		Processes: topProcesses,
-		Timestamp: time.Now(),
+	for name, samples := range latestCollectorSamples() {
+		if topics[name] {
+			if stats.Collectors == nil {
+				stats.Collectors = map[string][]models.Sample{}
+			}
+			stats.Collectors[name] = samples
+		}
 	}
+
+	return stats
+}
+
+// forwardEvents pushes bus events to clients: threshold crossings as "alert"
+// messages on the alerts topic, everything else as "event" messages on the events topic
+func (h *WebSocketHub) forwardEvents(sub *EventSubscription) {
+	for event := range sub.C {
+		msg := eventMessage(event)
+		h.PublishToTopic(messageTopics[msg.Type], msg)
+	}
+}
+
+// eventMessage wraps a bus event as an "alert" (threshold crossings) or "event" message
+func eventMessage(event models.Event) WebSocketMessage {
+	msg := WebSocketMessage{Type: "event", Timestamp: event.Timestamp, Data: event}
+	if event.Type == models.EventThresholdCrossed {
+		msg.Type = "alert"
+	}
+	return msg
 }
 
 // Register adds a new client to the hub
@@ -181,9 +512,22 @@ func (h *WebSocketHub) Unregister(clientID string) {
 	h.unregister <- clientID
 }
 
-// Broadcast sends a message to all connected clients
+// Broadcast sends a message to all connected clients. "alert" and "event" messages
+// only reach clients subscribed to the alerts/events topics.
 func (h *WebSocketHub) Broadcast(msg WebSocketMessage) {
-	h.broadcast <- msg
+	h.broadcast <- topicMessage{topic: messageTopics[msg.Type], msg: msg}
+}
+
+// PublishToTopic sends a message to clients subscribed to a topic without blocking
+func (h *WebSocketHub) PublishToTopic(topic string, msg WebSocketMessage) {
+	if msg.Timestamp.IsZero() {
+		msg.Timestamp = time.Now()
+	}
+	select {
+	case h.broadcast <- topicMessage{topic: topic, msg: msg}:
+	default:
+		// Broadcast queue full, drop rather than stall the publisher
+	}
 }
 
 // GetHub returns the WebSocket hub
@@ -198,10 +542,10 @@ func SendMessage(clientID string, msg WebSocketMessage) error {
 		return nil // Hub not initialized yet
 	}
 
+	// Hold the read lock while sending so the hub cannot close Send underneath us
 	hub.mu.RLock()
+	defer hub.mu.RUnlock()
 	client, exists := hub.clients[clientID]
-	hub.mu.RUnlock()
-
 	if !exists {
 		return nil // Client not connected
 	}
@@ -210,6 +554,7 @@ func SendMessage(clientID string, msg WebSocketMessage) error {
 	case client.Send <- msg:
 		return nil
 	default:
+		client.countDrop(hub.SlowWindow)
 		return nil // Send channel full
 	}
 }
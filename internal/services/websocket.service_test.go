@@ -0,0 +1,34 @@
+package services
+
+import (
+	"chowkidar/internal/models"
+	"testing"
+	"time"
+)
+
+func TestStatsPayloadFilter(t *testing.T) {
+	stats := &StatsPayload{
+		CPU:    &models.CPUStatus{UsagePercent: 10},
+		Memory: &models.MemoryStatus{UsagePercent: 20},
+		Collectors: map[string][]models.Sample{
+			TopicCPU:    {{Name: "usage_percent", Value: 10}},
+			TopicMemory: {{Name: "usage_percent", Value: 20}},
+			"load":      {{Name: "load1", Value: 0.5}},
+		},
+		Timestamp: time.Now(),
+	}
+
+	filtered := stats.filter(map[string]bool{TopicCPU: true, "load": true})
+	if filtered.CPU == nil || filtered.Memory != nil {
+		t.Errorf("typed fields: cpu %v, memory %v; want cpu only", filtered.CPU, filtered.Memory)
+	}
+	if _, ok := filtered.Collectors[TopicCPU]; ok {
+		t.Error("cpu samples sent next to the typed cpu field")
+	}
+	if len(filtered.Collectors) != 1 || len(filtered.Collectors["load"]) != 1 {
+		t.Errorf("collectors = %v, want load only", filtered.Collectors)
+	}
+	if len(stats.Collectors) != 3 {
+		t.Error("filter modified the full payload exporters read")
+	}
+}
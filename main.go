@@ -3,9 +3,11 @@ package main
 import (
 	"chowkidar/internal/controllers"
 	"chowkidar/internal/middleware"
+	"chowkidar/internal/models"
 	"chowkidar/internal/routes"
 	"chowkidar/internal/services"
 	"flag"
+	"fmt"
 	"log"
 	"net"
 	"os"
@@ -17,8 +19,20 @@ import (
 
 func main() {
 	printTokenOnly := flag.Bool("print-token", false, "print a token and exit")
+	serverName := flag.String("server-name", "chowkidar-agent", "server name in tokens printed by --print-token (push agents are listed under it)")
+	listBans := flag.Bool("list-bans", false, "list active IP bans and exit")
+	unbanIP := flag.String("unban", "", "lift the ban for an IP and exit")
 	flag.Parse()
 
+	// "agent" (default) monitors this machine; "hub" also federates registered agents
+	mode := strings.TrimSpace(os.Getenv("CHOWKIDAR_MODE"))
+	if mode == "" {
+		mode = "agent"
+	}
+	if mode != "agent" && mode != "hub" {
+		log.Fatalf("Invalid CHOWKIDAR_MODE=%q (expected agent or hub)", mode)
+	}
+
 	// ============================================================
 	// Initialize Services
 	// ============================================================
@@ -27,12 +41,48 @@ func main() {
 	_ = services.InitAuthService(secretKey, 365*24*time.Hour)
 	log.Println("✓ Auth service initialized")
 
+	// Initialize security audit log (JSON lines, size-based rotation)
+	if _, err := services.InitAuditLog(""); err != nil {
+		log.Printf("⚠️  Audit log disabled: %v", err)
+	} else {
+		defer services.CloseAuditLog()
+	}
+
+	// Initialize lockout service (brute-force protection, persisted bans)
+	_ = services.InitLockoutService("")
+
+	// Ban management only touches the ban file; a running agent picks up the change
+	if *listBans {
+		bans := services.ListBans()
+		if len(bans) == 0 {
+			fmt.Println("No active bans")
+		}
+		for _, ban := range bans {
+			fmt.Printf("%s\tuntil %s\tstrikes=%d\t%s\n", ban.IP, ban.ExpiresAt.Format(time.RFC3339), ban.Strikes, ban.Reason)
+		}
+		return
+	}
+	if *unbanIP != "" {
+		removed, err := services.Unban(*unbanIP)
+		if err != nil {
+			log.Fatalf("Failed to unban %s: %v", *unbanIP, err)
+		}
+		if !removed {
+			fmt.Printf("No ban found for %s\n", *unbanIP)
+			return
+		}
+		fmt.Printf("Unbanned %s\n", *unbanIP)
+		return
+	}
+	services.StartLockoutJanitor(15 * time.Second)
+	log.Println("✓ Lockout service initialized")
+
 	// Initialize WebSocket hub for real-time stats
 	_ = services.InitWebSocketHub()
 	log.Println("✓ WebSocket hub initialized")
 
 	// Initialize security services
-	rateLimiter := middleware.NewRateLimiter()
+	middleware.InitRateLimiters()      // Per-route-group token buckets (metrics, history, ws, auth, default)
 	_ = middleware.NewSecurityLogger() // Initializes global security logger
 	log.Println("✓ Security middleware initialized")
 
@@ -68,10 +118,22 @@ func main() {
 
 	// Generate token only when explicitly requested
 	if *printTokenOnly {
-		token, err := services.GenerateToken("chowkidar-agent")
+		if !middleware.NewInputValidator().ValidateServerName(*serverName) {
+			log.Fatalf("Invalid --server-name %q", *serverName)
+		}
+		token, err := services.GenerateToken(*serverName)
 		if err != nil {
 			log.Fatalf("Failed to generate token: %v", err)
 		}
+		if claims, err := services.ValidateToken(token); err == nil {
+			services.RecordAudit(models.AuditEvent{
+				Type:       "token_generated",
+				Outcome:    services.AuditSuccess,
+				IP:         "cli",
+				TokenID:    claims.ID,
+				ServerName: claims.ServerName,
+			})
+		}
 		log.Println(token)
 		return
 	}
@@ -102,8 +164,8 @@ func main() {
 	// Add security headers to all responses
 	r.Use(middleware.SecurityHeadersMiddleware())
 
-	// Add rate limiting to all endpoints
-	r.Use(middleware.RateLimitMiddleware(rateLimiter))
+	// Reject banned IPs before doing any other work
+	r.Use(middleware.BanMiddleware())
 
 	// Configure CORS - dynamic allow when CHOWKIDAR_ALLOWED_ORIGINS is unset
 	allowedOrigins := []string{}
@@ -118,24 +180,121 @@ func main() {
 	}
 	r.Use(middleware.CORSMiddleware(allowedOrigins))
 
+	// IP allow/deny lists (addresses or CIDRs, IPv4 and IPv6).
+	// /ws inherits the REST lists unless CHOWKIDAR_WS_* lists are set.
+	restAllowed := parseListEnv("CHOWKIDAR_ALLOWED_IPS")
+	restDenied := parseListEnv("CHOWKIDAR_DENIED_IPS")
+	restWhitelist, err := middleware.NewIPWhitelist(restAllowed, restDenied)
+	if err != nil {
+		log.Fatalf("Invalid CHOWKIDAR_ALLOWED_IPS/CHOWKIDAR_DENIED_IPS: %v", err)
+	}
+	wsAllowed := parseListEnv("CHOWKIDAR_WS_ALLOWED_IPS")
+	wsDenied := parseListEnv("CHOWKIDAR_WS_DENIED_IPS")
+	if len(wsAllowed) == 0 && len(wsDenied) == 0 {
+		wsAllowed, wsDenied = restAllowed, restDenied
+	}
+	wsWhitelist, err := middleware.NewIPWhitelist(wsAllowed, wsDenied)
+	if err != nil {
+		log.Fatalf("Invalid CHOWKIDAR_WS_ALLOWED_IPS/CHOWKIDAR_WS_DENIED_IPS: %v", err)
+	}
+	if !restWhitelist.IsEmpty() || !wsWhitelist.IsEmpty() {
+		log.Println("✓ IP allowlisting enabled")
+	}
+
 	// ============================================================
 	// Background Services
 	// ============================================================
 	// Start metric collectors (1-second for real-time, 1-minute for 1h history)
-	services.StartProcessCollector(time.Second)
+	if names, err := services.StartCollectors(); err != nil {
+		log.Fatalf("Invalid collector settings: %v", err)
+	} else {
+		log.Printf("✓ Collectors: %s", strings.Join(names, ", "))
+	}
+	if services.CollectorEnabled(services.TopicProcesses) {
+		services.StartProcessCollector(time.Second, 30*time.Second)
+	}
+	if names, err := services.StartOutputs(); err != nil {
+		log.Fatalf("Invalid output settings: %v", err)
+	} else if len(names) > 0 {
+		log.Printf("✓ Outputs: %s", strings.Join(names, ", "))
+	}
 	services.StartHistoryCollector(1 * time.Minute)
+	if listener, err := services.StartStatsDListener(); err != nil {
+		log.Fatalf("Failed to start StatsD listener: %v", err)
+	} else if listener != nil {
+		log.Printf("✓ StatsD listening on %s (flush every %s)", listener.Address, listener.FlushInterval)
+	}
+	if runner, err := services.StartChecks(); err != nil {
+		log.Fatalf("Invalid checks file: %v", err)
+	} else if runner != nil {
+		log.Printf("✓ Checks: %d from %s (at most %d at a time)", runner.Checks(), runner.Path, runner.Concurrency)
+	}
+	services.StartMountWatcher(30 * time.Second)
+	services.StartKernelLogWatcher()
+	if err := services.StartAlertEvaluator(); err != nil {
+		log.Fatalf("Invalid CHOWKIDAR_ALERT_RULES: %v", err)
+	}
+	if exporter, err := services.StartOTLPExporter(); err != nil {
+		log.Fatalf("Invalid OTLP exporter settings: %v", err)
+	} else if exporter != nil {
+		log.Printf("✓ Exporting OTLP metrics to %s every %s", exporter.Endpoint, exporter.Interval)
+	}
+
+	// Hub mode: connect to every registered agent
+	if mode == "hub" {
+		if _, err := services.InitFleet(""); err != nil {
+			log.Fatalf("Failed to start hub mode: %v", err)
+		}
+		log.Println("✓ Hub mode enabled")
+	}
 
 	// ============================================================
 	// API Routes
 	// ============================================================
-	routes.RegisterMonitorRoutes(r) // /metrics/* endpoints
-	routes.RegisterProcessRoutes(r) // /processes/* endpoints
+	api := r.Group("/", middleware.IPWhitelistMiddleware(restWhitelist))
+	routes.RegisterMonitorRoutes(api)  // /metrics/* endpoints
+	routes.RegisterProcessRoutes(api)  // /processes/* endpoints
+	routes.RegisterSecurityRoutes(api) // /security/* endpoints
+	routes.RegisterEventRoutes(api)    // /events
+	routes.RegisterCheckRoutes(api)    // /checks
+
+	// Unknown paths get the default limit so scanning for routes is throttled too
+	r.NoRoute(middleware.RateLimit(middleware.RateLimitDefault))
+
+	// WebSocket endpoint with its own IP lists and upgrade rate limit
+	r.GET("/ws", middleware.IPWhitelistMiddleware(wsWhitelist), middleware.RateLimit(middleware.RateLimitWS), controllers.HandleWebSocket)
 
-	// WebSocket endpoint with rate limiting
-	r.GET("/ws", middleware.RateLimitMiddleware(rateLimiter), controllers.HandleWebSocket)
+	// Server-Sent Events alternative to /ws for proxies that break WebSocket upgrades
+	r.GET("/stream", middleware.IPWhitelistMiddleware(wsWhitelist), middleware.RateLimit(middleware.RateLimitWS), middleware.AuthMiddleware(), controllers.HandleStream)
+
+	// Hub mode: fleet registry, merged metrics and a merged stream tagged by server
+	if mode == "hub" {
+		routes.RegisterFleetRoutes(api)
+		r.GET("/fleet/ws", middleware.IPWhitelistMiddleware(wsWhitelist), middleware.RateLimit(middleware.RateLimitWS), controllers.HandleFleetWebSocket)
+		r.GET("/fleet/push", middleware.IPWhitelistMiddleware(wsWhitelist), middleware.RateLimit(middleware.RateLimitWS), middleware.AuthMiddleware(), controllers.HandleFleetPush)
+	}
+
+	// Push mode: stream to a hub over an outbound connection (CHOWKIDAR_PUSH_URL)
+	if pusher, err := services.StartPushClient(r); err != nil {
+		log.Fatalf("Failed to start push mode: %v", err)
+	} else if pusher != nil {
+		log.Printf("✓ Pushing to %s as %s", pusher.URL, pusher.Name)
+	}
 
 	// ============================================================
 	// Start Server
 	// ============================================================
 	r.Run(bindAddr)
 }
+
+// parseListEnv splits a comma-separated environment variable into trimmed, non-empty entries
+func parseListEnv(name string) []string {
+	values := []string{}
+	for _, value := range strings.Split(os.Getenv(name), ",") {
+		trimmed := strings.TrimSpace(value)
+		if trimmed != "" {
+			values = append(values, trimmed)
+		}
+	}
+	return values
+}